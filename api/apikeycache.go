@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"sns-api/domain"
+	"sns-api/usecase"
+	"sync"
+	"time"
+)
+
+// apiKeyCacheTTL is how long a verified token is accepted, and a rejected one refused, without
+// asking the key store. Rotating or revoking a key through this process takes effect at once,
+// through other processes within the TTL.
+const apiKeyCacheTTL = 30 * time.Second
+
+// maxCachedAPIKeys bounds the tokens remembered, which include every invalid token sent.
+const maxCachedAPIKeys = 10000
+
+type cachedAPIKey struct {
+	// key is nil for a rejected token
+	key     *domain.APIKey
+	expires time.Time
+}
+
+// apiKeyCache remembers the results of Authenticate by the hash of the token, so that every
+// request does not read the key store and the routes not reading MySQL keep working while
+// it is unavailable. Failures of the store are not remembered.
+type apiKeyCache struct {
+	usecase.APIKeyUseCase
+	ttl time.Duration
+	now func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]cachedAPIKey
+	// generation counts the resets, so that a lookup started before one is not stored
+	generation int
+}
+
+func newAPIKeyCache(au usecase.APIKeyUseCase, ttl time.Duration) *apiKeyCache {
+	return &apiKeyCache{
+		APIKeyUseCase: au,
+		ttl:           ttl,
+		now:           time.Now,
+		keys:          map[string]cachedAPIKey{},
+	}
+}
+
+func (ac *apiKeyCache) Authenticate(ctx context.Context, token string) (*domain.APIKey, error) {
+	hash := domain.HashAPIKeySecret(token)
+	ac.mu.Lock()
+	cached, ok := ac.keys[hash]
+	generation := ac.generation
+	ac.mu.Unlock()
+	if ok && ac.now().Before(cached.expires) {
+		if cached.key == nil {
+			return nil, domain.ErrInvalidAPIKey
+		}
+		return cached.key, nil
+	}
+	key, err := ac.APIKeyUseCase.Authenticate(ctx, token)
+	if err != nil && err != domain.ErrInvalidAPIKey {
+		return nil, err
+	}
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if generation == ac.generation {
+		now := ac.now()
+		if len(ac.keys) >= maxCachedAPIKeys {
+			ac.evict(now)
+		}
+		ac.keys[hash] = cachedAPIKey{key: key, expires: now.Add(ac.ttl)}
+	}
+	return key, err
+}
+
+func (ac *apiKeyCache) Rotate(ctx context.Context, id string) (*domain.APIKey, string, error) {
+	defer ac.reset()
+	return ac.APIKeyUseCase.Rotate(ctx, id)
+}
+
+func (ac *apiKeyCache) Revoke(ctx context.Context, id string) error {
+	defer ac.reset()
+	return ac.APIKeyUseCase.Revoke(ctx, id)
+}
+
+// reset forgets every token, as the tokens of a key are not known from its id.
+func (ac *apiKeyCache) reset() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.keys = map[string]cachedAPIKey{}
+	ac.generation++
+}
+
+// evict drops the expired tokens or, if none expired, all of them. ac.mu must be held.
+func (ac *apiKeyCache) evict(now time.Time) {
+	for hash, cached := range ac.keys {
+		if !now.Before(cached.expires) {
+			delete(ac.keys, hash)
+		}
+	}
+	if len(ac.keys) >= maxCachedAPIKeys {
+		ac.keys = map[string]cachedAPIKey{}
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sns-api/domain"
+	"sns-api/usecase"
+	"testing"
+	"time"
+)
+
+type stubAPIKeyUseCase struct {
+	usecase.APIKeyUseCase
+	key   *domain.APIKey
+	err   error
+	calls int
+}
+
+func (s *stubAPIKeyUseCase) Authenticate(ctx context.Context, token string) (*domain.APIKey, error) {
+	s.calls++
+	return s.key, s.err
+}
+
+func (s *stubAPIKeyUseCase) Revoke(ctx context.Context, id string) error {
+	return nil
+}
+
+func Test_apiKeyCache_Authenticate(t *testing.T) {
+	key := &domain.APIKey{ID: "k1"}
+	errStore := errors.New("connection refused")
+	tests := []struct {
+		name string
+		key  *domain.APIKey
+		err  error
+		// between is run between the two calls of Authenticate
+		between   func(ac *apiKeyCache, now *time.Time)
+		wantKey   *domain.APIKey
+		wantErr   error
+		wantCalls int
+	}{
+		{
+			name:      "検証済みのキーはストアを読まない",
+			key:       key,
+			wantKey:   key,
+			wantCalls: 1,
+		},
+		{
+			name:      "無効なキーも記憶する",
+			err:       domain.ErrInvalidAPIKey,
+			wantErr:   domain.ErrInvalidAPIKey,
+			wantCalls: 1,
+		},
+		{
+			name:      "ストアの障害は記憶しない",
+			err:       errStore,
+			wantErr:   errStore,
+			wantCalls: 2,
+		},
+		{
+			name: "TTLを過ぎると検証し直す",
+			key:  key,
+			between: func(ac *apiKeyCache, now *time.Time) {
+				*now = now.Add(time.Minute)
+			},
+			wantKey:   key,
+			wantCalls: 2,
+		},
+		{
+			name: "失効させると検証し直す",
+			key:  key,
+			between: func(ac *apiKeyCache, now *time.Time) {
+				_ = ac.Revoke(context.Background(), key.ID)
+			},
+			wantKey:   key,
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubAPIKeyUseCase{key: tt.key, err: tt.err}
+			now := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+			ac := newAPIKeyCache(stub, apiKeyCacheTTL)
+			ac.now = func() time.Time { return now }
+
+			_, _ = ac.Authenticate(context.Background(), "k1.secret")
+			if tt.between != nil {
+				tt.between(ac, &now)
+			}
+			got, err := ac.Authenticate(context.Background(), "k1.secret")
+			if err != tt.wantErr {
+				t.Errorf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.wantKey {
+				t.Errorf("Authenticate() got = %v, want %v", got, tt.wantKey)
+			}
+			if stub.calls != tt.wantCalls {
+				t.Errorf("Authenticate() read the store %d times, want %d", stub.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sns-api/domain"
+	"sns-api/infrastructure/file"
+	"sns-api/infrastructure/mysql/corpus"
+	"sns-api/usecase"
+	"strings"
+)
+
+// apiKeyContextKey is the gin context key the authenticated *domain.APIKey is stored under.
+const apiKeyContextKey = "api_key"
+
+// NewAPIKeyStore creates the key store selected by Auth.Store.
+func (s *server) NewAPIKeyStore() {
+	var repository domain.APIKeyRepository
+	switch s.config.Auth.Store {
+	case "file":
+		r, err := file.NewAPIKeyRepository(s.logger, s.config.Auth.File)
+		if err != nil {
+			s.logger.Fatalf(fmt.Sprintf("cannot load api keys from %s: %v", s.config.Auth.File, err))
+		}
+		repository = r
+	case "mysql":
+		repository = corpus.NewAPIKeyRepository(s.logger, s.corpus)
+	default:
+		s.logger.Fatalf(fmt.Sprintf("unknown api key store: %s", s.config.Auth.Store))
+	}
+	s.apiKeys = newAPIKeyCache(usecase.NewAPIKeyUseCase(s.logger, repository), apiKeyCacheTTL)
+}
+
+// Authenticate resolves the api key sent as "Authorization: Bearer <key>" or "X-API-Key: <key>"
+// and stores it in the gin context. With Auth.Enabled off every request passes anonymously.
+func (s *server) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.config.Auth.Enabled {
+			c.Next()
+			return
+		}
+		token := c.GetHeader("X-API-Key")
+		if h := c.GetHeader("Authorization"); token == "" && strings.HasPrefix(h, "Bearer ") {
+			token = strings.TrimPrefix(h, "Bearer ")
+		}
+		if token == "" {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.Error(errors.New("api key is required")).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusUnauthorized)
+			c.Abort()
+			return
+		}
+		key, err := s.apiKeys.Authenticate(c.Request.Context(), token)
+		if err == domain.ErrInvalidAPIKey {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusUnauthorized)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+			c.Abort()
+			return
+		}
+		c.Set(apiKeyContextKey, key)
+		c.Request = c.Request.WithContext(domain.WithAPIKey(c.Request.Context(), key))
+		c.Next()
+	}
+}
+
+// RequireScope fails the request with 403 unless the authenticated key has scope.
+func (s *server) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.config.Auth.Enabled {
+			c.Next()
+			return
+		}
+		if key := apiKeyOf(c.Keys); key == nil || !key.HasScope(scope) {
+			c.Error(fmt.Errorf("api key does not have the %s scope", scope)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// apiKeyOf returns the key Authenticate stored in keys, the gin context keys, if any.
+func apiKeyOf(keys map[string]interface{}) *domain.APIKey {
+	key, _ := keys[apiKeyContextKey].(*domain.APIKey)
+	return key
+}
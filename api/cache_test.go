@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleCacheHeaders(t *testing.T) {
+	s := &server{}
+	r := gin.New()
+	r.Use(s.HandleError())
+	r.GET("/ok", s.HandleCacheHeaders(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"hits": 1})
+	})
+	r.GET("/stream", s.HandleCacheHeaders(), func(c *gin.Context) {
+		c.String(http.StatusOK, "1\n")
+		c.Writer.Flush()
+		c.String(http.StatusOK, "2\n")
+	})
+	r.GET("/error", s.HandleCacheHeaders(), func(c *gin.Context) {
+		c.Error(errors.New("failed")).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+	})
+
+	tests := []struct {
+		name        string
+		path        string
+		ifNoneMatch func(etag string) string
+		wantCode    int
+		wantBody    string
+		wantETag    bool
+		wantControl string
+	}{
+		{
+			name:        "ETagを付ける",
+			path:        "/ok",
+			wantCode:    http.StatusOK,
+			wantBody:    `{"hits":1}`,
+			wantETag:    true,
+			wantControl: "no-cache",
+		},
+		{
+			name:        "一致するIf-None-Matchには304",
+			path:        "/ok",
+			ifNoneMatch: func(etag string) string { return "\"other\", " + etag },
+			wantCode:    http.StatusNotModified,
+			wantETag:    true,
+			wantControl: "no-cache",
+		},
+		{
+			name:     "ストリーミングはETagなし",
+			path:     "/stream",
+			wantCode: http.StatusOK,
+			wantBody: "1\n2\n",
+		},
+		{
+			name:     "エラーはそのまま",
+			path:     "/error",
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":{"code":"invalid_parameter","message":"failed"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.ifNoneMatch != nil {
+				first := httptest.NewRecorder()
+				r.ServeHTTP(first, httptest.NewRequest(http.MethodGet, tt.path, nil))
+				req.Header.Set("If-None-Match", tt.ifNoneMatch(first.Header().Get("ETag")))
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rec.Body.String(), tt.wantBody)
+			}
+			if (rec.Header().Get("ETag") != "") != tt.wantETag {
+				t.Errorf("ETag = %q", rec.Header().Get("ETag"))
+			}
+			if rec.Header().Get("Cache-Control") != tt.wantControl {
+				t.Errorf("Cache-Control = %q, want %q", rec.Header().Get("Cache-Control"), tt.wantControl)
+			}
+		})
+	}
+}
@@ -1,16 +1,71 @@
 package api
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"net/http"
+	"sns-api/handler"
 )
 
+const (
+	requestIDHeader     = "X-Request-Id"
+	requestIDContextKey = "request_id"
+	// maxRequestIDLength bounds the ids callers may pass, which end up in the logs.
+	maxRequestIDLength = 128
+)
+
+// HandleRequestID gives every request an id, the X-Request-Id of the caller or a random one,
+// and returns it in the X-Request-Id header and in error responses.
+func (s *server) HandleRequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDContextKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "-"
+	}
+	return hex.EncodeToString(b)
+}
+
+// HandleError answers the last private error that a handler or middleware recorded, with its
+// status as the meta, by a handler.Error under the error key.
 func (s *server) HandleError() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
 		if err := c.Errors.ByType(gin.ErrorTypePrivate).Last(); err != nil {
-			statusCode := c.Errors.ByType(gin.ErrorTypePrivate).Last().Meta.(int)
-			c.AbortWithStatusJSON(statusCode, gin.H{
-				"error": err.Error(),
+			statusCode, _ := err.Meta.(int)
+			// backend errors do not always wrap the context error, so the request context decides as well
+			if errors.Is(err.Err, context.DeadlineExceeded) || errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+				statusCode = http.StatusGatewayTimeout
+			}
+			e := handler.NewError(statusCode, err.Err)
+			e.RequestID = c.GetString(requestIDContextKey)
+			c.AbortWithStatusJSON(e.Status, gin.H{
+				"error": e,
 			})
 		}
 	}
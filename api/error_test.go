@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"sns-api/handler"
+	"testing"
+	"time"
+)
+
+type errorTestForm struct {
+	UserIDs   []uint64 `json:"user_ids" form:"user_ids" binding:"required,max=2"`
+	Count     int      `json:"count" form:"count" binding:"omitempty,min=1,max=100"`
+	OrderBy   string   `json:"order_by" form:"order_by" binding:"omitempty,oneof=created_at retweet_count"`
+	StartDate string   `json:"start_date" form:"start_date" binding:"required"`
+}
+
+func TestHandleError(t *testing.T) {
+	s := &server{}
+	r := gin.New()
+	r.Use(s.HandleRequestID())
+	r.Use(s.HandleError())
+	r.GET("/bind", func(c *gin.Context) {
+		var q errorTestForm
+		if !handler.Bind(c, &q) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"hits": len(q.UserIDs)})
+	})
+	r.GET("/backend", func(c *gin.Context) {
+		c.Error(errors.New("connection refused")).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+	})
+	r.GET("/deadline", func(c *gin.Context) {
+		c.Error(context.DeadlineExceeded).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+	})
+	r.GET("/unknown", func(c *gin.Context) {
+		c.Error(errors.New("failed")).SetType(gin.ErrorTypePrivate)
+	})
+
+	tests := []struct {
+		name      string
+		path      string
+		requestID string
+		wantCode  int
+		wantBody  string
+	}{
+		{
+			name:      "正常時はそのまま",
+			path:      "/bind?user_ids=1&start_date=2020-01-01+00:00",
+			requestID: "abc-1",
+			wantCode:  http.StatusOK,
+			wantBody:  `{"hits":1}`,
+		},
+		{
+			name:      "不正なパラメータをすべてパラメータ名で返す",
+			path:      "/bind?user_ids=1&user_ids=2&user_ids=3&count=101&order_by=id",
+			requestID: "abc-2",
+			wantCode:  http.StatusBadRequest,
+			wantBody: `{"error":{"code":"invalid_parameter","message":"invalid parameters: user_ids: must have at most 2 elements, count: must be at most 100, order_by: must be one of created_at, retweet_count, start_date: is required",` +
+				`"fields":[{"field":"user_ids","message":"must have at most 2 elements"},{"field":"count","message":"must be at most 100"},{"field":"order_by","message":"must be one of created_at, retweet_count"},{"field":"start_date","message":"is required"}],"request_id":"abc-2"}}`,
+		},
+		{
+			name:      "バックエンドの障害",
+			path:      "/backend",
+			requestID: "abc-3",
+			wantCode:  http.StatusServiceUnavailable,
+			wantBody:  `{"error":{"code":"backend_unavailable","message":"connection refused","request_id":"abc-3"}}`,
+		},
+		{
+			name:      "タイムアウト",
+			path:      "/deadline",
+			requestID: "abc-4",
+			wantCode:  http.StatusGatewayTimeout,
+			wantBody:  `{"error":{"code":"timeout","message":"context deadline exceeded","request_id":"abc-4"}}`,
+		},
+		{
+			name:      "ステータスのないエラーは内部エラー",
+			path:      "/unknown",
+			requestID: "abc-5",
+			wantCode:  http.StatusInternalServerError,
+			wantBody:  `{"error":{"code":"internal","message":"failed","request_id":"abc-5"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(requestIDHeader, tt.requestID)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Get(requestIDHeader); got != tt.requestID {
+				t.Errorf("%s = %s, want %s", requestIDHeader, got, tt.requestID)
+			}
+		})
+	}
+}
+
+func TestHandleRequestID(t *testing.T) {
+	s := &server{}
+	r := gin.New()
+	r.Use(s.HandleRequestID())
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantKept  bool
+	}{
+		{name: "呼び出し元のIDを使う", requestID: "7f3c.run-2_a", wantKept: true},
+		{name: "IDがなければ生成する", requestID: ""},
+		{name: "使えない文字を含むIDは生成し直す", requestID: "id with\ttabs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(requestIDHeader, tt.requestID)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			got := rec.Header().Get(requestIDHeader)
+			if tt.wantKept && got != tt.requestID {
+				t.Errorf("%s = %s, want %s", requestIDHeader, got, tt.requestID)
+			}
+			if !tt.wantKept && (got == tt.requestID || !validRequestID(got)) {
+				t.Errorf("%s = %q, want a new id", requestIDHeader, got)
+			}
+		})
+	}
+}
+
+// the deadline of the request decides even when the backend error does not wrap it
+func TestHandleError_requestDeadline(t *testing.T) {
+	s := &server{}
+	r := gin.New()
+	r.Use(s.HandleError())
+	r.GET("/", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+		c.Request = c.Request.WithContext(ctx)
+		c.Error(errors.New("search failed")).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+	})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("code = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+}
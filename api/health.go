@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sns-api/logger"
+	"sync"
+	"time"
+)
+
+const (
+	dependencyElasticSearch = "elasticsearch"
+	dependencyCorpus        = "corpus"
+)
+
+type dependencyStatus struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	Latency   string    `json:"latency"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type dependencyCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// healthMonitor checks the backends in the background so that requests only
+// read the last known status instead of pinging on their own.
+type healthMonitor struct {
+	l        logger.Logging
+	interval time.Duration
+	timeout  time.Duration
+	checks   []dependencyCheck
+
+	mu       sync.RWMutex
+	statuses map[string]*dependencyStatus
+	draining bool
+
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newHealthMonitor(l logger.Logging, interval, timeout time.Duration) *healthMonitor {
+	return &healthMonitor{
+		l:        l,
+		interval: interval,
+		timeout:  timeout,
+		statuses: map[string]*dependencyStatus{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (m *healthMonitor) register(name string, check func(ctx context.Context) error) {
+	m.checks = append(m.checks, dependencyCheck{name: name, check: check})
+}
+
+// start runs the first round of checks before returning, then keeps checking every interval.
+func (m *healthMonitor) start() {
+	m.started = true
+	m.checkAll()
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.checkAll()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (m *healthMonitor) close() {
+	if !m.started {
+		return
+	}
+	close(m.stop)
+	<-m.done
+}
+
+func (m *healthMonitor) checkAll() {
+	var wg sync.WaitGroup
+	for _, dc := range m.checks {
+		wg.Add(1)
+		go func(dc dependencyCheck) {
+			defer wg.Done()
+			m.checkOne(dc)
+		}(dc)
+	}
+	wg.Wait()
+}
+
+func (m *healthMonitor) checkOne(dc dependencyCheck) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	start := time.Now()
+	err := dc.check(ctx)
+	status := &dependencyStatus{
+		Name:      dc.name,
+		Healthy:   err == nil,
+		Latency:   time.Since(start).String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	prev, ok := m.statuses[dc.name]
+	m.statuses[dc.name] = status
+	m.mu.Unlock()
+
+	if !ok || prev.Healthy != status.Healthy {
+		if status.Healthy {
+			m.l.Infof(fmt.Sprintf("%s is healthy", dc.name))
+		} else {
+			m.l.Errorf(fmt.Sprintf("%s is unhealthy: %s", dc.name, status.Error))
+		}
+	}
+}
+
+// drain makes readiness fail so that load balancers stop routing new requests here.
+func (m *healthMonitor) drain() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.draining = true
+}
+
+func (m *healthMonitor) healthy(name string) (bool, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status, ok := m.statuses[name]
+	if !ok {
+		return false, "not checked yet"
+	}
+	return status.Healthy, status.Error
+}
+
+func (m *healthMonitor) snapshot() ([]*dependencyStatus, bool, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ready := !m.draining
+	statuses := make([]*dependencyStatus, 0, len(m.checks))
+	for _, dc := range m.checks {
+		status, ok := m.statuses[dc.name]
+		if !ok {
+			status = &dependencyStatus{Name: dc.name}
+		}
+		s := *status
+		statuses = append(statuses, &s)
+		ready = ready && s.Healthy
+	}
+	return statuses, ready, m.draining
+}
+
+// RequireDependencies fails the request with 503 when one of the named backends is unhealthy.
+func (s *server) RequireDependencies(names ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, name := range names {
+			if ok, reason := s.health.healthy(name); !ok {
+				c.Error(fmt.Errorf("%s is unavailable: %s", name, reason)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func (s *server) live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+func (s *server) ready(c *gin.Context) {
+	statuses, ready, draining := s.health.snapshot()
+	status, code := "ok", http.StatusOK
+	switch {
+	case draining:
+		status, code = "draining", http.StatusServiceUnavailable
+	case !ready:
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":       status,
+		"dependencies": statuses,
+	})
+}
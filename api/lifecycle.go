@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Run serves until SIGINT or SIGTERM, then drains in-flight requests and releases
+// the backend connections.
+func (s *server) Run() error {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%s", s.config.Port),
+		Handler:      s.router,
+		ReadTimeout:  s.config.Server.ReadTimeout,
+		WriteTimeout: s.config.Server.WriteTimeout,
+		IdleTimeout:  s.config.Server.IdleTimeout,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.Infof(fmt.Sprintf("listening on %s", srv.Addr))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	select {
+	case err := <-errCh:
+		s.Close()
+		return err
+	case sig := <-quit:
+		s.logger.Infof(fmt.Sprintf("received %s, shutting down", sig))
+	}
+	return s.shutdown(srv)
+}
+
+func (s *server) shutdown(srv *http.Server) error {
+	// let load balancers see the failing readiness probe before the listener goes away
+	s.health.drain()
+	time.Sleep(s.config.Server.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Server.GracePeriod)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		s.logger.Errorf(fmt.Sprintf("failed to drain in-flight requests: %v", err))
+		_ = srv.Close()
+	}
+	s.Close()
+	s.logger.Info("server stopped")
+	return err
+}
+
+// Close stops the export workers and releases the backend connections and the access log.
+// The health monitor goes first so that it does not report the closed clients as failures.
+func (s *server) Close() {
+	if s.health != nil {
+		s.health.close()
+	}
+	if s.indices != nil {
+		s.indices.Close()
+	}
+	// running exports record their failure in the corpus database
+	if s.exports != nil {
+		s.exports.Close()
+	}
+	if s.corpus != nil {
+		if err := s.corpus.Close(); err != nil {
+			s.logger.Errorf(fmt.Sprintf("failed to close corpus client: %v", err))
+		}
+	}
+	if s.esTransport != nil {
+		s.esTransport.CloseIdleConnections()
+	}
+	if s.accessLog != nil {
+		if err := s.accessLog.Close(); err != nil {
+			s.logger.Errorf(fmt.Sprintf("failed to close access log: %v", err))
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sns-api/datetime"
+	"sns-api/handler"
+	"sns-api/handler/hashtag"
+	"sns-api/handler/tweet"
+	"sns-api/infrastructure/elastic"
+	"sns-api/metrics"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// costCountUnit and costUserUnit scale the cost of a query with its count and number of user ids;
+	// a query costs one unit per monthly index it searches, plus as much again per costCountUnit
+	// requested documents and per costUserUnit user ids.
+	costCountUnit = 1000
+	costUserUnit  = 100
+	// idleBucketTTL is how long an unused bucket is kept before it is dropped as full.
+	idleBucketTTL = 10 * time.Minute
+)
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket per client. A request takes as many tokens as it costs;
+// the balance may go negative, which makes the following requests wait until it is refilled.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	maxWait time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(rate, burst float64, maxWait time.Duration) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   burst,
+		maxWait: maxWait,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// reserve takes cost tokens from the bucket of client and returns how long the request has to wait
+// for them. When the wait would exceed maxWait nothing is taken and false is returned.
+func (l *rateLimiter) reserve(client string, cost float64, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+	wait := time.Duration(0)
+	if missing := cost - b.tokens; missing > 0 {
+		wait = time.Duration(missing / l.rate * float64(time.Second))
+	}
+	if wait > l.maxWait {
+		return wait, false
+	}
+	b.tokens -= cost
+	return wait, true
+}
+
+// refund returns the tokens of a reservation that was given up while waiting.
+func (l *rateLimiter) refund(client string, cost float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[client]; ok {
+		b.tokens = math.Min(l.burst, b.tokens+cost)
+	}
+}
+
+// sweep drops the buckets that have been idle long enough to be full again.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleBucketTTL {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if now.Sub(b.last) > idleBucketTTL && b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// defaultCounts are the counts of the routes whose handlers default to another count than
+// handler.DefaultCount, by full route path.
+var defaultCounts = map[string]int{
+	"/api/v1/tweets/user":           tweet.DefaultTimelineCount,
+	"/api/v1/tweets/users":          tweet.DefaultTimelineCount,
+	"/api/v1/tweets/domain":         tweet.DefaultTimelineCount,
+	"/api/v1/tweets/media":          tweet.DefaultTimelineCount,
+	"/api/v1/tweets/transition":     tweet.DefaultTransitionCount,
+	"/api/v1/hashtags/":             hashtag.DefaultRankingCount,
+	"/api/v1/hashtags/cooccurrence": hashtag.DefaultCooccurrenceCount,
+}
+
+// costParams are the request parameters the cost of a query is estimated from.
+type costParams struct {
+	StartDate string   `json:"start_date"`
+	EndDate   string   `json:"end_date"`
+	Count     int      `json:"count"`
+	UserIDs   []uint64 `json:"user_ids"`
+}
+
+// estimateCost estimates the backend cost of a request from its date range, count and user ids,
+// reading them from the query string or the body like the handlers do. Parameters that are
+// missing or malformed count as the smallest value; the handlers reject them later anyway.
+// It also names the parameter that multiplies the cost the most, end_date for the date range.
+func estimateCost(c *gin.Context) (float64, string) {
+	var p costParams
+	if c.Request.Method == http.MethodPost && c.ContentType() == gin.MIMEJSON {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err == nil {
+			_ = json.Unmarshal(body, &p)
+		}
+		// the handler binds the body again
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	} else if err := c.Request.ParseForm(); err == nil {
+		form := c.Request.Form
+		p.StartDate = form.Get("start_date")
+		p.EndDate = form.Get("end_date")
+		p.Count, _ = strconv.Atoi(form.Get("count"))
+		p.UserIDs = make([]uint64, len(form["user_ids"]))
+	}
+
+	months := 1
+	start, okStart := parseCostDate(p.StartDate)
+	end, okEnd := parseCostDate(p.EndDate)
+	if okStart && okEnd {
+		months = elastic.IndexSpan(start, end)
+	}
+	count := p.Count
+	if count <= 0 {
+		count = handler.DefaultCount
+		if n, ok := defaultCounts[c.FullPath()]; ok {
+			count = n
+		}
+	}
+	factors := []struct {
+		param  string
+		factor float64
+	}{
+		{"end_date", float64(months)},
+		{"count", 1 + float64(count)/costCountUnit},
+		{"user_ids", 1 + float64(len(p.UserIDs))/costUserUnit},
+	}
+	cost, param, largest := 1.0, "", 0.0
+	for _, f := range factors {
+		cost *= f.factor
+		if f.factor > largest {
+			param, largest = f.param, f.factor
+		}
+	}
+	return cost, param
+}
+
+// parseCostDate reads a date in any form the handlers accept. The zone hardly moves the
+// number of months a range spans, so the dates are read in UTC.
+func parseCostDate(s string) (time.Time, bool) {
+	if t, err := datetime.Parse(s, time.UTC); err == nil {
+		return t, true
+	}
+	if t, err := datetime.ParseDate(s, time.UTC); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// clientOf identifies the caller by the api key, or by the client IP without authentication.
+func clientOf(c *gin.Context) string {
+	if key := apiKeyOf(c.Keys); key != nil {
+		return "key:" + key.ID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// HandleRateLimit charges every request its estimated cost against the bucket of its client.
+// Requests wait up to RateLimit.MaxWait for their budget and are rejected with 429 beyond that.
+func (s *server) HandleRateLimit() gin.HandlerFunc {
+	cfg := s.config.RateLimit
+	limiter := newRateLimiter(cfg.Rate, cfg.Burst, cfg.MaxWait)
+	return func(c *gin.Context) {
+		if !cfg.Enabled {
+			c.Next()
+			return
+		}
+		cost, param := estimateCost(c)
+		// a request costing more than a full bucket would never pass, so it is refused as invalid
+		if cost > cfg.Burst {
+			metrics.ObserveRateLimited(c.FullPath())
+			err := fmt.Errorf("query cost %.1f exceeds the budget of %.1f, narrow the date range, lower count or send fewer user ids", cost, cfg.Burst)
+			c.Error(handler.InvalidParameter(param, err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+			c.Abort()
+			return
+		}
+		client := clientOf(c)
+		wait, ok := limiter.reserve(client, cost, time.Now())
+		if !ok {
+			metrics.ObserveRateLimited(c.FullPath())
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.Error(fmt.Errorf("rate limit exceeded, retry in %s", wait.Round(time.Second))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusTooManyRequests)
+			c.Abort()
+			return
+		}
+		if wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-c.Request.Context().Done():
+				t.Stop()
+				limiter.refund(client, cost)
+				c.Error(c.Request.Context().Err()).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
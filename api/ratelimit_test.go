@@ -0,0 +1,225 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"sns-api/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_rateLimiter_reserve(t *testing.T) {
+	now := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	type call struct {
+		after    time.Duration
+		cost     float64
+		wantWait time.Duration
+		wantOK   bool
+	}
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "バースト内は待たない",
+			calls: []call{
+				{cost: 6, wantOK: true},
+				{cost: 4, wantOK: true},
+			},
+		},
+		{
+			name: "不足分は補充を待つ",
+			calls: []call{
+				{cost: 10, wantOK: true},
+				{cost: 2, wantWait: time.Second, wantOK: true},
+			},
+		},
+		{
+			name: "待ち時間が上限を超えると拒否して消費しない",
+			calls: []call{
+				{cost: 10, wantOK: true},
+				{cost: 8, wantWait: 4 * time.Second, wantOK: false},
+				{after: 2 * time.Second, cost: 4, wantOK: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(2, 10, 2*time.Second)
+			at := now
+			for i, c := range tt.calls {
+				at = at.Add(c.after)
+				wait, ok := l.reserve("key:test", c.cost, at)
+				if wait != c.wantWait || ok != c.wantOK {
+					t.Errorf("call %d: reserve() = %v, %v, want %v, %v", i, wait, ok, c.wantWait, c.wantOK)
+				}
+			}
+		})
+	}
+}
+
+func Test_estimateCost(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		route  string
+		target string
+		body   string
+		want   float64
+		// wantParam is the parameter named when the cost exceeds the budget
+		wantParam string
+	}{
+		{
+			name:      "1ヶ月10件",
+			method:    http.MethodGet,
+			target:    "/?start_date=2020-08-01+00:00&end_date=2020-08-31+23:59",
+			want:      1.01,
+			wantParam: "count",
+		},
+		{
+			name:      "1年10000件",
+			method:    http.MethodGet,
+			target:    "/?start_date=2020-01-01+00:00&end_date=2020-12-31+23:59&count=10000",
+			want:      132,
+			wantParam: "end_date",
+		},
+		{
+			name:      "日付のみの形式",
+			method:    http.MethodGet,
+			target:    "/?start_date=2020-01-01&end_date=2020-03-31&count=1000",
+			want:      6,
+			wantParam: "end_date",
+		},
+		{
+			name:      "クエリのユーザーID",
+			method:    http.MethodGet,
+			target:    "/?start_date=2020-08-01+00:00&end_date=2020-08-31+23:59&count=1000&user_ids=1&user_ids=2",
+			want:      2.04,
+			wantParam: "count",
+		},
+		{
+			name:      "JSONボディのユーザーID",
+			method:    http.MethodPost,
+			target:    "/",
+			body:      `{"user_ids":[` + strings.Repeat("1,", 99) + `1],"start_date":"2020-08-01 00:00","end_date":"2020-09-30 23:59"}`,
+			want:      4.04,
+			wantParam: "end_date",
+		},
+		{
+			name:      "ユーザーIDが最も大きい",
+			method:    http.MethodGet,
+			target:    "/?start_date=2020-08-01+00:00&end_date=2020-08-31+23:59" + strings.Repeat("&user_ids=1", 300),
+			want:      4.04,
+			wantParam: "user_ids",
+		},
+		{
+			name:      "日付なし",
+			method:    http.MethodGet,
+			target:    "/",
+			want:      1.01,
+			wantParam: "count",
+		},
+		{
+			name:      "ルートごとの既定の件数",
+			method:    http.MethodGet,
+			route:     "/api/v1/hashtags/",
+			target:    "/api/v1/hashtags/?start_date=2020-08-01+00:00&end_date=2020-08-31+23:59",
+			want:      2,
+			wantParam: "count",
+		},
+		{
+			name:      "件数を指定すればルートの既定は使わない",
+			method:    http.MethodGet,
+			route:     "/api/v1/hashtags/",
+			target:    "/api/v1/hashtags/?start_date=2020-08-01+00:00&end_date=2020-08-31+23:59&count=10",
+			want:      1.01,
+			wantParam: "count",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := tt.route
+			if route == "" {
+				route = "/"
+			}
+			var got float64
+			var gotParam string
+			r := gin.New()
+			r.Handle(tt.method, route, func(c *gin.Context) {
+				got, gotParam = estimateCost(c)
+				if tt.body != "" {
+					if b, _ := c.GetRawData(); string(b) != tt.body {
+						t.Errorf("body was not restored: %s", b)
+					}
+				}
+			})
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", gin.MIMEJSON)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			if d := got - tt.want; d > 1e-9 || d < -1e-9 {
+				t.Errorf("estimateCost() = %v, want %v", got, tt.want)
+			}
+			if gotParam != tt.wantParam {
+				t.Errorf("estimateCost() param = %v, want %v", gotParam, tt.wantParam)
+			}
+		})
+	}
+}
+
+func TestHandleRateLimit(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Rate = 1
+	cfg.RateLimit.Burst = 10
+	cfg.RateLimit.MaxWait = time.Second
+	s := &server{config: cfg}
+	r := gin.New()
+	r.Use(s.HandleError())
+	r.GET("/", s.HandleRateLimit(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"hits": 1})
+	})
+
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "予算内",
+			target:   "/?start_date=2020-08-01+00:00&end_date=2020-08-31+23:59",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "予算を超える期間はパラメータ名で返す",
+			target:   "/?start_date=2020-01-01+00:00&end_date=2020-12-31+23:59",
+			wantCode: http.StatusBadRequest,
+			wantBody: `"field":"end_date"`,
+		},
+		{
+			name:     "予算を超える件数はパラメータ名で返す",
+			target:   "/?count=20000",
+			wantCode: http.StatusBadRequest,
+			wantBody: `"field":"count"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want %s", rec.Body.String(), tt.wantBody)
+			}
+			if rec.Header().Get("Retry-After") != "" {
+				t.Errorf("Retry-After = %s, want none", rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
@@ -1,26 +1,48 @@
 package api
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"sns-api/domain"
+	"sns-api/handler/apikey"
+	"sns-api/handler/exportjob"
 	"sns-api/handler/hashtag"
 	"sns-api/handler/tweet"
 	"sns-api/handler/user"
+	"sns-api/infrastructure/cache"
 	"sns-api/infrastructure/elastic"
+	"sns-api/infrastructure/file"
 	"sns-api/infrastructure/mysql/corpus"
+	"sns-api/metrics"
 	"sns-api/usecase"
 )
 
 func (s *server) NewRouter() {
+	s.router.Use(s.HandleRequestID())
 	s.router.Use(s.HandleAccessLog())
+	s.router.Use(s.HandleMetrics())
 	s.router.Use(s.HandleError())
-	s.router.Use(s.NewElasticSearchClient())
-	s.router.Use(s.NewCorpusDatabaseClient())
+	s.router.Use(s.HandleTimeout())
+	s.router.Use(s.HandleTimezone())
+
+	s.NewElasticSearchClient()
+	s.NewCorpusDatabaseClient()
+	s.NewAPIKeyStore()
+	s.NewCacheStore()
+	s.health.start()
+	s.indices.Start()
+
+	s.router.GET("/metrics", gin.WrapH(metrics.Handler()))
 
 	apiV1 := s.router.Group("api/v1")
 	s.healthRoutes(apiV1)
-	s.tweetsRoutes(apiV1)
-	s.hashtagsRoutes(apiV1)
-	s.usersRoutes(apiV1)
+
+	authenticated := apiV1.Group("", s.Authenticate(), s.HandleRateLimit())
+	s.tweetsRoutes(authenticated)
+	s.hashtagsRoutes(authenticated)
+	s.usersRoutes(authenticated)
+	s.exportsRoutes(authenticated)
+	s.adminRoutes(authenticated)
 }
 
 func (s *server) healthRoutes(api *gin.RouterGroup) {
@@ -31,49 +53,141 @@ func (s *server) healthRoutes(api *gin.RouterGroup) {
 				"message": "success",
 			})
 		})
+		healthRoutes.GET("/live", s.live)
+		healthRoutes.GET("/ready", s.ready)
 	}
 }
 
 func (s *server) tweetsRoutes(api *gin.RouterGroup) {
-	tweetsRoutes := api.Group("/tweets")
+	tweetsRoutes := api.Group("/tweets", s.HandleCacheHeaders(), s.RequireScope(domain.ScopeTweetsRead))
 	{
-		tweetRepository := elastic.NewTweetRepository(s.logger, s.es)
+		es := s.RequireDependencies(dependencyElasticSearch)
+		db := s.RequireDependencies(dependencyCorpus)
+
+		var tweetRepository domain.TweetRepository = elastic.NewTweetRepository(s.logger, s.es, s.indices)
+		if s.config.Cache.Enabled {
+			tweetRepository = cache.NewTweetRepository(s.logger, s.cacheStore, s.cachePolicy, tweetRepository)
+		}
+		var userRepository domain.UserRepository = elastic.NewUserRepository(s.logger, s.es, s.indices)
+		if s.config.Cache.Enabled {
+			userRepository = cache.NewUserRepository(s.logger, s.cacheStore, s.cachePolicy, userRepository)
+		}
 		corpusTweetRepository := corpus.NewTweetRepository(s.logger, s.corpus)
-		tweetUseCase := usecase.NewTweetUseCase(s.logger, tweetRepository, corpusTweetRepository)
+		tweetUseCase := usecase.NewTweetUseCase(s.logger, tweetRepository, corpusTweetRepository, userRepository)
 		tweetHandler := tweet.NewTweetHandler(s.logger, tweetUseCase)
 
 		tweetsRoutes.GET("/", tweetHandler.Get)
-		tweetsRoutes.GET("/user", tweetHandler.GetByUser)
-		tweetsRoutes.GET("/users", tweetHandler.GetByUsers)
-		tweetsRoutes.POST("/users", tweetHandler.GetByUsers)
-		tweetsRoutes.GET("/domain", tweetHandler.GetByDomain)
-		tweetsRoutes.GET("/media", tweetHandler.GetByMediaType)
-		tweetsRoutes.GET("/transition", tweetHandler.GetTransitionByUser)
+		tweetsRoutes.GET("/user", es, tweetHandler.GetByUser)
+		tweetsRoutes.GET("/user/stats", es, tweetHandler.Stats)
+		tweetsRoutes.GET("/users", es, tweetHandler.GetByUsers)
+		tweetsRoutes.POST("/users", es, tweetHandler.GetByUsers)
+		tweetsRoutes.GET("/domain", es, tweetHandler.GetByDomain)
+		tweetsRoutes.GET("/media", es, tweetHandler.GetByMediaType)
+		tweetsRoutes.GET("/transition", db, tweetHandler.GetTransitionByUser)
+		tweetsRoutes.GET("/search", es, tweetHandler.Search)
+		tweetsRoutes.GET("/heatmap", es, tweetHandler.Heatmap)
 	}
 }
 
 func (s *server) hashtagsRoutes(api *gin.RouterGroup) {
-	hashtagsRoutes := api.Group("/hashtags")
+	middleware := []gin.HandlerFunc{s.HandleCacheHeaders(), s.RequireScope(domain.ScopeHashtagsRead), s.RequireDependencies(dependencyElasticSearch)}
+	hashtagsRoutes := api.Group("/hashtags", middleware...)
+	// the routes of a single hashtag have a group of their own, as the router cannot match
+	// a parameter next to the static paths of /hashtags
+	hashtagRoutes := api.Group("/hashtag/:hashtag", middleware...)
 	{
-		hashtagRepository := elastic.NewHashtagRepository(s.logger, s.es)
-		hashtagUseCase := usecase.NewHashtagUseCase(s.logger, hashtagRepository)
+		var hashtagRepository domain.HashtagRepository = elastic.NewHashtagRepository(s.logger, s.es, s.indices)
+		if s.config.Cache.Enabled {
+			hashtagRepository = cache.NewHashtagRepository(s.logger, s.cacheStore, s.cachePolicy, hashtagRepository)
+		}
+		var userRepository domain.UserRepository = elastic.NewUserRepository(s.logger, s.es, s.indices)
+		if s.config.Cache.Enabled {
+			userRepository = cache.NewUserRepository(s.logger, s.cacheStore, s.cachePolicy, userRepository)
+		}
+		hashtagUseCase := usecase.NewHashtagUseCase(s.logger, hashtagRepository, userRepository)
 		hashtagHandler := hashtag.NewHashtagHandler(s.logger, hashtagUseCase)
 
 		hashtagsRoutes.GET("/", hashtagHandler.Get)
 		hashtagsRoutes.GET("/search", hashtagHandler.Search)
+		hashtagsRoutes.GET("/suggest", hashtagHandler.Suggest)
+		hashtagsRoutes.GET("/timeseries", hashtagHandler.Timeseries)
+		hashtagsRoutes.GET("/trending", hashtagHandler.Trending)
+		hashtagsRoutes.GET("/cooccurrence", hashtagHandler.Cooccurrence)
+		hashtagRoutes.GET("/users", hashtagHandler.Contributors)
 	}
 }
 
 func (s *server) usersRoutes(api *gin.RouterGroup) {
-	usersRoutes := api.Group("/users")
+	usersRoutes := api.Group("/users", s.HandleCacheHeaders(), s.RequireScope(domain.ScopeUsersRead))
 	{
-		userRepository := elastic.NewUserRepository(s.logger, s.es)
-		userUseCase := usecase.NewUserUseCase(s.logger, userRepository)
+		es := s.RequireDependencies(dependencyElasticSearch)
+		db := s.RequireDependencies(dependencyCorpus)
+
+		var userRepository domain.UserRepository = elastic.NewUserRepository(s.logger, s.es, s.indices)
+		if s.config.Cache.Enabled {
+			userRepository = cache.NewUserRepository(s.logger, s.cacheStore, s.cachePolicy, userRepository)
+		}
+		var tweetRepository domain.TweetRepository = elastic.NewTweetRepository(s.logger, s.es, s.indices)
+		if s.config.Cache.Enabled {
+			tweetRepository = cache.NewTweetRepository(s.logger, s.cacheStore, s.cachePolicy, tweetRepository)
+		}
+		corpusTweetRepository := corpus.NewTweetRepository(s.logger, s.corpus)
+		userUseCase := usecase.NewUserUseCase(s.logger, userRepository, corpusTweetRepository, tweetRepository)
 		userHandler := user.NewUserHandler(s.logger, userUseCase)
 
-		usersRoutes.GET("/search", userHandler.Search)
-		usersRoutes.GET("/id", userHandler.GetById)
-		usersRoutes.GET("/ids", userHandler.GetByIds)
-		usersRoutes.POST("/ids", userHandler.GetByIds)
+		usersRoutes.GET("/search", es, userHandler.Search)
+		usersRoutes.GET("/id", es, userHandler.GetById)
+		usersRoutes.GET("/ids", es, userHandler.GetByIds)
+		usersRoutes.POST("/ids", es, userHandler.GetByIds)
+		usersRoutes.GET("/growth", db, userHandler.Growth)
+		// growth is reported as failed rather than refused when only the corpus is down
+		usersRoutes.GET("/compare", es, userHandler.Compare)
+		usersRoutes.POST("/compare", es, userHandler.Compare)
+	}
+}
+
+// exportsRoutes serve the export jobs. They read the repositories without the cache, whose entries
+// the pages of a large export would only evict. The creating routes are per kind so that each
+// requires the scope of the documents it exports.
+func (s *server) exportsRoutes(api *gin.RouterGroup) {
+	exportsRoutes := api.Group("/exports", s.RequireDependencies(dependencyCorpus))
+	{
+		es := s.RequireDependencies(dependencyElasticSearch)
+
+		files, err := file.NewExportFileStore(s.config.Export.Dir)
+		if err != nil {
+			s.logger.Fatalf(fmt.Sprintf("cannot create export directory %s: %v", s.config.Export.Dir, err))
+		}
+		s.exports = usecase.NewExportUseCase(s.logger, corpus.NewExportJobRepository(s.logger, s.corpus), files,
+			elastic.NewTweetRepository(s.logger, s.es, s.indices), elastic.NewHashtagRepository(s.logger, s.es, s.indices),
+			s.config.Export.Workers, s.config.Export.QueueSize, s.config.Export.Timeout)
+		s.exports.Start()
+		exportHandler := exportjob.NewExportHandler(s.logger, s.exports)
+
+		exportsRoutes.POST("/tweets", s.RequireScope(domain.ScopeTweetsRead), es, exportHandler.Tweets)
+		exportsRoutes.POST("/hashtags", s.RequireScope(domain.ScopeHashtagsRead), es, exportHandler.Hashtags)
+		exportsRoutes.GET("/:id", exportHandler.Get)
+		exportsRoutes.GET("/:id/download", exportHandler.Download)
+	}
+}
+
+// adminRoutes manage the api keys. Without Auth.Enabled every request would pass RequireScope,
+// so the routes are not served at all then.
+func (s *server) adminRoutes(api *gin.RouterGroup) {
+	if !s.config.Auth.Enabled {
+		s.logger.Infof("admin routes are disabled without auth")
+		return
+	}
+	adminRoutes := api.Group("/admin", s.RequireScope(domain.ScopeAdmin))
+	if s.config.Auth.Store == "mysql" {
+		adminRoutes.Use(s.RequireDependencies(dependencyCorpus))
+	}
+	{
+		apiKeyHandler := apikey.NewAPIKeyHandler(s.logger, s.apiKeys)
+
+		adminRoutes.GET("/keys", apiKeyHandler.List)
+		adminRoutes.POST("/keys", apiKeyHandler.Create)
+		adminRoutes.POST("/keys/:id/rotate", apiKeyHandler.Rotate)
+		adminRoutes.DELETE("/keys/:id", apiKeyHandler.Revoke)
 	}
 }
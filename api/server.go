@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v7"
@@ -9,17 +10,34 @@ import (
 	"net/http"
 	"os"
 	"sns-api/config"
+	"sns-api/datetime"
+	"sns-api/handler"
+	"sns-api/infrastructure/cache"
+	"sns-api/infrastructure/elastic"
 	"sns-api/logger"
+	"sns-api/metrics"
+	"sns-api/usecase"
 	"strings"
 	"time"
 )
 
 type server struct {
-	router *gin.Engine
-	config *config.Config
-	logger logger.Logging
-	es     *elasticsearch.Client
-	corpus *sql.DB
+	router  *gin.Engine
+	config  *config.Config
+	logger  logger.Logging
+	es      *elasticsearch.Client
+	indices *elastic.IndexCatalog
+	corpus  *sql.DB
+	health  *healthMonitor
+	apiKeys usecase.APIKeyUseCase
+	exports usecase.ExportUseCase
+
+	cacheStore  cache.Store
+	cachePolicy *cache.Policy
+
+	// resources released by Close
+	esTransport *http.Transport
+	accessLog   *os.File
 }
 
 func NewServer(e *gin.Engine, c *config.Config, l logger.Logging) *server {
@@ -27,6 +45,7 @@ func NewServer(e *gin.Engine, c *config.Config, l logger.Logging) *server {
 		router: e,
 		config: c,
 		logger: l,
+		health: newHealthMonitor(l, c.Health.Interval, c.Health.Timeout),
 	}
 }
 
@@ -35,10 +54,17 @@ func (s *server) HandleAccessLog() gin.HandlerFunc {
 	if err != nil {
 		s.logger.Fatalf(fmt.Sprintf("error opening file: %v", err))
 	}
+	s.accessLog = f
 	return gin.LoggerWithConfig(gin.LoggerConfig{
 		Formatter: func(param gin.LogFormatterParams) string {
-			return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
+			// the key id takes the place of the user in the common log format
+			keyID := "-"
+			if key := apiKeyOf(param.Keys); key != nil {
+				keyID = key.ID
+			}
+			return fmt.Sprintf("%s %s [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
 				param.ClientIP,
+				keyID,
 				param.TimeStamp.Format(time.RFC1123),
 				param.Method,
 				param.Path,
@@ -54,38 +80,98 @@ func (s *server) HandleAccessLog() gin.HandlerFunc {
 	})
 }
 
-func (s *server) NewElasticSearchClient() gin.HandlerFunc {
+// HandleMetrics records the count and latency of every request by its matched route.
+// It runs outside HandleError so that the status written for private errors is the one recorded.
+func (s *server) HandleMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			// unmatched paths are arbitrary user input and would blow up the label set
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(route, c.Request.Method, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// HandleTimeout bounds the request context by the timeout configured for the matched route.
+// Repositories receive the context, so a deadline or a client disconnect cancels the backend work.
+func (s *server) HandleTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := s.config.Timeout.Default
+		if d, ok := s.config.Timeout.Routes[c.FullPath()]; ok {
+			timeout = d
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// HandleTimezone stores the zone dates of the request are read and created_at is rendered in
+// in the request context: the tz parameter, such as Asia/Tokyo or UTC, or the configured default.
+func (s *server) HandleTimezone() gin.HandlerFunc {
+	defaultLocation, err := datetime.LoadLocation(s.config.Timezone)
+	if err != nil {
+		s.logger.Fatalf(fmt.Sprintf("invalid timezone %s: %v", s.config.Timezone, err))
+	}
+	return func(c *gin.Context) {
+		loc := defaultLocation
+		if tz := c.Query("tz"); tz != "" {
+			var err error
+			if loc, err = datetime.LoadLocation(tz); err != nil {
+				c.Error(handler.InvalidParameter("tz", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+				c.Abort()
+				return
+			}
+		}
+		c.Request = c.Request.WithContext(datetime.WithLocation(c.Request.Context(), loc))
+		c.Next()
+	}
+}
+
+// NewElasticSearchClient creates the client shared by every repository.
+func (s *server) NewElasticSearchClient() {
+	s.esTransport = http.DefaultTransport.(*http.Transport).Clone()
 	cfg := elasticsearch.Config{
 		Addresses: []string{s.config.DB.ElasticSearch.Address},
+		Transport: s.esTransport,
 	}
 	es, err := elasticsearch.NewClient(cfg)
 	if err != nil {
 		s.logger.Fatalf(fmt.Sprintf("cannot create elasticserch client: %v", err))
 	}
 	s.es = es
-	return func(c *gin.Context) {
-		_, err := s.es.Ping()
+	s.indices, err = elastic.NewIndexCatalog(s.logger, s.es, s.config.Indices.Refresh, s.config.Indices.Partitions)
+	if err != nil {
+		s.logger.Fatalf(fmt.Sprintf("cannot create index catalog: %v", err))
+	}
+	s.health.register(dependencyElasticSearch, func(ctx context.Context) error {
+		res, err := s.es.Ping(s.es.Ping.WithContext(ctx))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return err
 		}
-		c.Next()
-	}
+		defer res.Body.Close()
+		if res.IsError() {
+			return fmt.Errorf("ping returned %s", res.Status())
+		}
+		return nil
+	})
 }
 
-func (s *server) NewCorpusDatabaseClient() gin.HandlerFunc {
+// NewCorpusDatabaseClient opens the connection pool shared by every corpus repository.
+func (s *server) NewCorpusDatabaseClient() {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", s.config.DB.Corpus.Username, s.config.DB.Corpus.Password, s.config.DB.Corpus.Host, s.config.DB.Corpus.Port, s.config.DB.Corpus.Database)
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		s.logger.Fatalf(fmt.Sprintf("cannot create corpus client: %v", err))
 	}
 	s.corpus = db
-	// no need to close corpus db connection here
-	return func(c *gin.Context) {
-		if err = s.corpus.Ping(); err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		c.Next()
-	}
+	s.health.register(dependencyCorpus, s.corpus.PingContext)
 }
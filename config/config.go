@@ -3,18 +3,82 @@ package config
 import (
 	"github.com/jinzhu/configor"
 	"strings"
+	"time"
 )
 
 type Config struct {
 	AppName string `default:"sns-api"`
 	Port    string `default:"8080"`
 	Env     string `default:"dev"`
+	// Timezone is the zone request dates are read and created_at is rendered in unless a
+	// request names another with the tz parameter.
+	Timezone string `default:"Asia/Tokyo"`
+	Server   struct {
+		ReadTimeout  time.Duration `default:"15s"`
+		WriteTimeout time.Duration `default:"90s"`
+		IdleTimeout  time.Duration `default:"60s"`
+		// DrainDelay is how long readiness fails before the listener stops accepting requests,
+		// GracePeriod how long in-flight requests may take to finish afterwards.
+		DrainDelay  time.Duration
+		GracePeriod time.Duration `default:"30s"`
+	}
 	Logger  struct {
 		Use         string `default:"zap"`
 		Environment string `default:"dev"`
 		LogLevel    string `default:"debug"`
 		FileName    string `default:"log/app.log"`
 	}
+	Timeout struct {
+		// Default bounds every request, Routes overrides it by full route path such as /api/v1/tweets/search.
+		Default time.Duration `default:"30s"`
+		Routes  map[string]time.Duration
+	}
+	Health struct {
+		// Interval is the period of the background dependency checks, Timeout bounds each check.
+		Interval time.Duration `default:"10s"`
+		Timeout  time.Duration `default:"2s"`
+	}
+	Auth struct {
+		// Enabled requires an api key on every /api/v1 route except health.
+		// Store is mysql, the api_keys table of the corpus database, or file, the JSON file at File.
+		Enabled bool
+		Store   string `default:"mysql"`
+		File    string `default:"config/apikeys.json"`
+	}
+	RateLimit struct {
+		// Every client, an api key or the client IP without one, has a budget of Burst cost units
+		// refilled at Rate units per second. A request waits up to MaxWait for its cost to become
+		// available and is rejected with 429 beyond that. A request costing more than Burst could
+		// never pass and is rejected with 400.
+		Enabled bool
+		Rate    float64       `default:"2"`
+		Burst   float64       `default:"120"`
+		MaxWait time.Duration `default:"2s"`
+	}
+	Cache struct {
+		// Enabled caches the Elasticsearch repository results in memory, bounded by MaxEntries and MaxBytes.
+		// Results for ranges that ended before the current month are kept for ClosedTTL, the rest for OpenTTL.
+		Enabled    bool
+		MaxEntries int           `default:"10000"`
+		MaxBytes   int64         `default:"268435456"`
+		ClosedTTL  time.Duration `default:"24h"`
+		OpenTTL    time.Duration `default:"1m"`
+	}
+	Indices struct {
+		// Refresh is the period the names of the existing indices are reloaded with. Partitions
+		// partitions an index prefix such as sns by month, day or the time layout of the suffix
+		// after its dash; unlisted prefixes are monthly.
+		Refresh    time.Duration `default:"5m"`
+		Partitions map[string]string
+	}
+	Export struct {
+		// Dir holds the files of the export jobs. Workers jobs run at a time, up to QueueSize more
+		// wait for a worker, and Timeout bounds each job.
+		Dir       string        `default:"exports"`
+		Workers   int           `default:"2"`
+		QueueSize int           `default:"100"`
+		Timeout   time.Duration `default:"1h"`
+	}
 	DB struct {
 		Corpus struct{
 			Host     string `default:"mysql"`
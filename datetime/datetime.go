@@ -0,0 +1,85 @@
+package datetime
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Layouts of the dates requests give and the backends store.
+const (
+	// Minute is the layout dates were requested in before RFC 3339 was accepted.
+	Minute = "2006-01-02 15:04"
+	// Second is the layout created_at is stored and rendered in.
+	Second = "2006-01-02 15:04:05"
+	Date   = "2006-01-02"
+)
+
+// storedLayouts are the forms created_at comes back from the backends in, all in UTC
+// unless they carry an offset.
+var storedLayouts = []string{Second, time.RFC3339, time.RubyDate}
+
+// LoadLocation returns the zone called name, such as Asia/Tokyo or UTC. The zone of
+// the server is not accepted, since it differs between hosts.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("unknown tz: %q", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown tz: %s", name)
+	}
+	return loc, nil
+}
+
+// Parse reads s, in RFC 3339 or in the Minute layout in loc, and returns it in UTC.
+func Parse(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.ParseInLocation(Minute, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither RFC 3339 nor %s", s, Minute)
+	}
+	return t.UTC(), nil
+}
+
+// ParseDate returns the start of the day s, in the Date layout, in loc in UTC.
+func ParseDate(s string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation(Date, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date of the form %s", s, Date)
+	}
+	return t.UTC(), nil
+}
+
+// EndOfDay returns the last second of the day starting at start in loc.
+func EndOfDay(start time.Time, loc *time.Location) time.Time {
+	return start.In(loc).AddDate(0, 0, 1).Add(-time.Second).UTC()
+}
+
+// Render converts created_at as a backend stored it to the Second layout in loc.
+// Values of an unknown form are returned as they are.
+func Render(s string, loc *time.Location) string {
+	for _, layout := range storedLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.In(loc).Format(Second)
+		}
+	}
+	return s
+}
+
+type locationContextKey struct{}
+
+// WithLocation returns a copy of ctx carrying the zone dates are read and rendered in.
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, locationContextKey{}, loc)
+}
+
+// LocationFromContext returns the zone WithLocation stored in ctx, or UTC without one.
+func LocationFromContext(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(locationContextKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
@@ -0,0 +1,78 @@
+package datetime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tokyo, err := LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "従来の形式はリクエストのタイムゾーン", s: "2020-01-01 09:00", want: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "RFC 3339はオフセットに従う", s: "2020-01-01T09:00:00+09:00", want: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "RFC 3339のUTC", s: "2020-01-01T09:00:00Z", want: time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)},
+		{name: "不正な形式", s: "2020/01/01 09:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.s, tokyo)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) || (!tt.wantErr && got.Location() != time.UTC) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tokyo, err := LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, err := ParseDate("2020-03-01", tokyo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2020, 2, 29, 15, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("ParseDate() = %v, want %v", start, want)
+	}
+	if got, want := EndOfDay(start, tokyo), time.Date(2020, 3, 1, 14, 59, 59, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("EndOfDay() = %v, want %v", got, want)
+	}
+	if _, err := LoadLocation("Local"); err == nil {
+		t.Errorf("LoadLocation() accepted the zone of the server")
+	}
+}
+
+func TestRender(t *testing.T) {
+	tokyo, err := LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{name: "保存形式", s: "2020-12-31 20:30:00", want: "2021-01-01 05:30:00"},
+		{name: "Twitterの形式", s: "Thu Dec 31 20:30:00 +0000 2020", want: "2021-01-01 05:30:00"},
+		{name: "不明な形式はそのまま", s: "yesterday", want: "yesterday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.s, tokyo); got != tt.want {
+				t.Errorf("Render() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
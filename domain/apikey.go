@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeTweetsRead   = "tweets:read"
+	ScopeUsersRead    = "users:read"
+	ScopeHashtagsRead = "hashtags:read"
+	// ScopeAdmin grants every other scope as well as the key management endpoints.
+	ScopeAdmin = "admin"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+)
+
+// APIKey identifies a caller. Only the hash of the secret is stored; the secret itself is
+// handed out once, as <id>.<secret>, when the key is created or rotated.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	SecretHash string     `json:"secret_hash,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// Localize reports the times of the key in loc.
+func (k *APIKey) Localize(loc *time.Location) {
+	k.CreatedAt = k.CreatedAt.In(loc)
+	if k.RotatedAt != nil {
+		rotatedAt := k.RotatedAt.In(loc)
+		k.RotatedAt = &rotatedAt
+	}
+	if k.RevokedAt != nil {
+		revokedAt := k.RevokedAt.In(loc)
+		k.RevokedAt = &revokedAt
+	}
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify reports whether secret belongs to the key, in constant time.
+func (k *APIKey) Verify(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKeySecret(secret)), []byte(k.SecretHash)) == 1
+}
+
+func HashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// FormatAPIKey returns the token a client sends for the key id and secret.
+func FormatAPIKey(id, secret string) string {
+	return id + "." + secret
+}
+
+// ParseAPIKey splits a token created by FormatAPIKey into the key id and the secret.
+func ParseAPIKey(token string) (string, string, error) {
+	i := strings.Index(token, ".")
+	if i <= 0 || i == len(token)-1 {
+		return "", "", ErrInvalidAPIKey
+	}
+	return token[:i], token[i+1:], nil
+}
+
+type APIKeyRepository interface {
+	Get(ctx context.Context, id string) (*APIKey, error)
+	List(ctx context.Context) ([]*APIKey, error)
+	Create(ctx context.Context, key *APIKey) error
+	Rotate(ctx context.Context, id, secretHash string, rotatedAt time.Time) error
+	Revoke(ctx context.Context, id string, revokedAt time.Time) error
+}
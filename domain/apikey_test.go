@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestParseAPIKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		wantID     string
+		wantSecret string
+		wantErr    bool
+	}{
+		{
+			name:       "idとsecret",
+			token:      FormatAPIKey("3f2a", "c2VjcmV0"),
+			wantID:     "3f2a",
+			wantSecret: "c2VjcmV0",
+		},
+		{
+			name:    "区切りがない",
+			token:   "3f2a",
+			wantErr: true,
+		},
+		{
+			name:    "idがない",
+			token:   ".c2VjcmV0",
+			wantErr: true,
+		},
+		{
+			name:    "secretがない",
+			token:   "3f2a.",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, secret, err := ParseAPIKey(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if id != tt.wantID || secret != tt.wantSecret {
+				t.Errorf("ParseAPIKey() = %v, %v, want %v, %v", id, secret, tt.wantID, tt.wantSecret)
+			}
+		})
+	}
+}
+
+func TestAPIKey_HasScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{name: "付与されたスコープ", scopes: []string{ScopeTweetsRead}, scope: ScopeTweetsRead, want: true},
+		{name: "付与されていないスコープ", scopes: []string{ScopeTweetsRead}, scope: ScopeUsersRead, want: false},
+		{name: "adminは全スコープを持つ", scopes: []string{ScopeAdmin}, scope: ScopeHashtagsRead, want: true},
+		{name: "スコープなし", scopes: nil, scope: ScopeTweetsRead, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &APIKey{Scopes: tt.scopes}
+			if got := k.HasScope(tt.scope); got != tt.want {
+				t.Errorf("HasScope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKey_Verify(t *testing.T) {
+	k := &APIKey{SecretHash: HashAPIKeySecret("secret")}
+	if !k.Verify("secret") {
+		t.Errorf("Verify() = false for the issued secret")
+	}
+	if k.Verify("other") {
+		t.Errorf("Verify() = true for another secret")
+	}
+}
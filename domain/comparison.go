@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Sections of a comparison, named in the errors of the ones that failed.
+const (
+	ComparisonProfiles = "profiles"
+	ComparisonStats    = "stats"
+	ComparisonGrowth   = "growth"
+)
+
+// UserComparison puts several users side by side. A section that failed for a user is left
+// empty and reported in Errors, so that one slow or broken backend does not hide the rest.
+type UserComparison struct {
+	Users  []*UserComparisonEntry `json:"users"`
+	Errors []*ComparisonError     `json:"errors,omitempty"`
+}
+
+// UserComparisonEntry is one user of a comparison. Growth is the change of the profile counters
+// over the range, and the shares are the percentages of the tweets and engagements of all the
+// compared users with statistics.
+type UserComparisonEntry struct {
+	UserID          uint64           `json:"user_id"`
+	User            *User            `json:"user"`
+	Stats           *TweetStats      `json:"stats"`
+	Growth          *UserGrowthPoint `json:"growth"`
+	StatusShare     *float64         `json:"status_share"`
+	EngagementShare *float64         `json:"engagement_share"`
+}
+
+// ComparisonError is a section that could not be fetched, for one user or, without UserID, for all.
+type ComparisonError struct {
+	UserID  uint64 `json:"user_id,omitempty"`
+	Section string `json:"section"`
+	Error   string `json:"error"`
+}
+
+// NewUserComparison returns a comparison with an empty entry per user, in the order given.
+func NewUserComparison(userIDs []uint64) *UserComparison {
+	c := &UserComparison{}
+	for _, id := range userIDs {
+		c.Users = append(c.Users, &UserComparisonEntry{UserID: id})
+	}
+	return c
+}
+
+// SetProfiles attaches the profiles to the entries of their users.
+func (c *UserComparison) SetProfiles(users []*User) {
+	byID := map[string]*User{}
+	for _, u := range users {
+		byID[u.UserID] = u
+	}
+	for _, e := range c.Users {
+		e.User = byID[strconv.FormatUint(e.UserID, 10)]
+	}
+}
+
+// AddError reports a failed section.
+func (c *UserComparison) AddError(userID uint64, section string, err error) {
+	c.Errors = append(c.Errors, &ComparisonError{UserID: userID, Section: section, Error: err.Error()})
+}
+
+// SortErrors orders the errors by user and section, as they are added in completion order.
+func (c *UserComparison) SortErrors() {
+	sort.SliceStable(c.Errors, func(i, j int) bool {
+		if c.Errors[i].UserID != c.Errors[j].UserID {
+			return c.Errors[i].UserID < c.Errors[j].UserID
+		}
+		return c.Errors[i].Section < c.Errors[j].Section
+	})
+}
+
+// SetShares sets the share of voice of every user with statistics.
+func (c *UserComparison) SetShares() {
+	var statuses, engagements float64
+	for _, e := range c.Users {
+		if e.Stats != nil {
+			statuses += float64(e.Stats.StatusCount)
+			engagements += e.Stats.engagements()
+		}
+	}
+	for _, e := range c.Users {
+		if e.Stats == nil {
+			continue
+		}
+		e.StatusShare = share(float64(e.Stats.StatusCount), statuses)
+		e.EngagementShare = share(e.Stats.engagements(), engagements)
+	}
+}
+
+func (s *TweetStats) engagements() float64 {
+	return s.Favorite.Total + s.Retweet.Total + s.Reply.Total + s.Quote.Total
+}
+
+func share(v, total float64) *float64 {
+	p := 0.0
+	if total > 0 {
+		p = v / total * 100
+	}
+	return &p
+}
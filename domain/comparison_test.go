@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUserComparison_SetShares(t *testing.T) {
+	c := NewUserComparison([]uint64{1, 2, 3})
+	c.SetProfiles([]*User{{UserID: "2", UserScreenName: "rival"}})
+	c.Users[0].Stats = &TweetStats{StatusCount: 30, Favorite: TweetMetricStats{Total: 60}, Retweet: TweetMetricStats{Total: 15}}
+	c.Users[1].Stats = &TweetStats{StatusCount: 10, Favorite: TweetMetricStats{Total: 25}}
+	c.AddError(3, ComparisonStats, errors.New("timeout"))
+	c.AddError(0, ComparisonProfiles, errors.New("timeout"))
+	c.SetShares()
+	c.SortErrors()
+
+	tests := []struct {
+		name       string
+		entry      *UserComparisonEntry
+		status     float64
+		engagement float64
+	}{
+		{name: "自社", entry: c.Users[0], status: 75, engagement: 75},
+		{name: "競合", entry: c.Users[1], status: 25, engagement: 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if *tt.entry.StatusShare != tt.status || *tt.entry.EngagementShare != tt.engagement {
+				t.Errorf("shares = %v, %v, want %v, %v", *tt.entry.StatusShare, *tt.entry.EngagementShare, tt.status, tt.engagement)
+			}
+		})
+	}
+	if c.Users[2].StatusShare != nil {
+		t.Errorf("share of a user without stats = %v, want nil", *c.Users[2].StatusShare)
+	}
+	if c.Users[0].User != nil || c.Users[1].User == nil || c.Users[1].User.UserScreenName != "rival" {
+		t.Errorf("profiles were attached to the wrong users")
+	}
+	if c.Errors[0].Section != ComparisonProfiles || c.Errors[1].UserID != 3 {
+		t.Errorf("errors = %+v, want the profiles error first", c.Errors)
+	}
+}
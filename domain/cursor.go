@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Cursor marks the position after the last document of a page.
+// It is handed to clients as an opaque string, see EncodeCursor.
+type Cursor struct {
+	// SearchAfter holds the sort values of the last document, including the tiebreaker.
+	SearchAfter []interface{} `json:"a,omitempty"`
+	// PitID is the point in time the following pages are read from, if the backend supports it.
+	PitID string `json:"p,omitempty"`
+	// Offset is used by results that cannot continue after a sort value, such as aggregation
+	// buckets and collapsed hits.
+	Offset int `json:"o,omitempty"`
+}
+
+// Page describes the part of a result set returned by a repository.
+type Page struct {
+	Hits       int
+	NextCursor *Cursor
+	// Warnings lists the documents that did not match the expected schema.
+	Warnings []*Warning
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// maxPitIDLength bounds the point in time ids a cursor may carry. The ids grow with the
+// number of shards searched, and stay far below this.
+const maxPitIDLength = 8192
+
+func EncodeCursor(c *Cursor) string {
+	if c == nil {
+		return ""
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor returns nil for an empty string, i.e. the first page.
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	d := json.NewDecoder(bytes.NewReader(b))
+	// keep sort values such as long ids exactly as the backend returned them
+	d.UseNumber()
+	if err := d.Decode(&c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Offset < 0 || len(c.SearchAfter) == 0 && c.Offset == 0 {
+		return nil, ErrInvalidCursor
+	}
+	for _, v := range c.SearchAfter {
+		switch v.(type) {
+		case nil, bool, string, json.Number:
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+	if !validPitID(c.PitID) {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// validPitID reports whether id may be a point in time id, which the backend encodes in
+// URL safe base64, so that a cursor cannot forward anything else to it.
+func validPitID(id string) bool {
+	if id == "" {
+		return true
+	}
+	if len(id) > maxPitIDLength {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(id, "="))
+	return err == nil
+}
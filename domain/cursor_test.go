@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	type args struct {
+		s string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *Cursor
+		wantErr bool
+	}{
+		{
+			name: "空文字は先頭ページ",
+			args: args{s: ""},
+			want: nil,
+		},
+		{
+			name: "sort値とtiebreakerを保持する",
+			args: args{s: EncodeCursor(&Cursor{SearchAfter: []interface{}{json.Number("1596240000000"), "1289419191928848384"}, PitID: "pit"})},
+			want: &Cursor{SearchAfter: []interface{}{json.Number("1596240000000"), "1289419191928848384"}, PitID: "pit"},
+		},
+		{
+			name: "オフセット",
+			args: args{s: EncodeCursor(&Cursor{Offset: 20})},
+			want: &Cursor{Offset: 20},
+		},
+		{
+			name:    "base64ではない",
+			args:    args{s: "!!"},
+			wantErr: true,
+		},
+		{
+			name:    "負のオフセット",
+			args:    args{s: EncodeCursor(&Cursor{SearchAfter: []interface{}{"1"}, Offset: -1})},
+			wantErr: true,
+		},
+		{
+			name:    "sort値にオブジェクトを含む",
+			args:    args{s: EncodeCursor(&Cursor{SearchAfter: []interface{}{map[string]interface{}{"a": 1}}})},
+			wantErr: true,
+		},
+		{
+			name: "パディング付きのpoint in time id",
+			args: args{s: EncodeCursor(&Cursor{SearchAfter: []interface{}{"1"}, PitID: "46ToAwMDaWR5BXV1aWQy_-8="})},
+			want: &Cursor{SearchAfter: []interface{}{"1"}, PitID: "46ToAwMDaWR5BXV1aWQy_-8="},
+		},
+		{
+			name:    "base64ではないpoint in time id",
+			args:    args{s: EncodeCursor(&Cursor{SearchAfter: []interface{}{"1"}, PitID: "pit/../_delete"})},
+			wantErr: true,
+		},
+		{
+			name:    "長すぎるpoint in time id",
+			args:    args{s: EncodeCursor(&Cursor{SearchAfter: []interface{}{"1"}, PitID: strings.Repeat("a", maxPitIDLength+1)})},
+			wantErr: true,
+		},
+		{
+			name:    "位置を持たないカーソル",
+			args:    args{s: EncodeCursor(&Cursor{PitID: "pit"})},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCursor(tt.args.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecodeCursor() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeCursor() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Kinds of export jobs.
+const (
+	ExportTweets   = "tweets"
+	ExportHashtags = "hashtags"
+)
+
+// States of an export job. A job is queued until a worker picks it up and ends
+// succeeded or failed.
+const (
+	ExportQueued    = "queued"
+	ExportRunning   = "running"
+	ExportSucceeded = "succeeded"
+	ExportFailed    = "failed"
+)
+
+var (
+	ErrExportNotFound  = errors.New("export not found")
+	ErrExportNotReady  = errors.New("export has not succeeded")
+	ErrExportQueueFull = errors.New("too many exports are waiting, try again later")
+)
+
+// ExportJob writes every document matching Params to a gzip compressed file in Format.
+// KeyID is the api key that created the job, and only that key may see it.
+type ExportJob struct {
+	ID         string          `json:"id"`
+	KeyID      string          `json:"-"`
+	Kind       string          `json:"kind"`
+	Format     string          `json:"format"`
+	BOM        bool            `json:"bom"`
+	Params     json.RawMessage `json:"params"`
+	Status     string          `json:"status"`
+	Rows       int64           `json:"rows"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job is done, either way.
+func (j *ExportJob) Finished() bool {
+	return j.Status == ExportSucceeded || j.Status == ExportFailed
+}
+
+// Localize reports the times of the job in loc.
+func (j *ExportJob) Localize(loc *time.Location) {
+	j.CreatedAt = j.CreatedAt.In(loc)
+	j.UpdatedAt = j.UpdatedAt.In(loc)
+	if j.FinishedAt != nil {
+		finishedAt := j.FinishedAt.In(loc)
+		j.FinishedAt = &finishedAt
+	}
+}
+
+// ExportTweetsParams selects the tweets of an ExportTweets job. Their created_at is written in Timezone.
+type ExportTweetsParams struct {
+	UserIDs   []uint64  `json:"user_ids"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	OrderBy   string    `json:"order_by"`
+	Timezone  string    `json:"tz"`
+}
+
+type ExportJobRepository interface {
+	Create(ctx context.Context, job *ExportJob) error
+	Get(ctx context.Context, id string) (*ExportJob, error)
+	// Update saves the status, row count, error and times of the job.
+	Update(ctx context.Context, job *ExportJob) error
+	// FailUnfinished fails the jobs left queued or running by a previous process.
+	FailUnfinished(ctx context.Context, reason string, at time.Time) (int64, error)
+}
+
+// ExportFileStore keeps the files written by export jobs.
+type ExportFileStore interface {
+	// Create returns a writer compressing into the file of the job, replacing any previous one.
+	Create(job *ExportJob) (io.WriteCloser, error)
+	// Path returns where the compressed file of the job is.
+	Path(job *ExportJob) string
+}
+
+type apiKeyContextKey struct{}
+
+// WithAPIKey returns a copy of ctx carrying the authenticated key.
+func WithAPIKey(ctx context.Context, key *APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext returns the key WithAPIKey stored in ctx, or nil for anonymous requests.
+func APIKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"math"
+	"sort"
+)
+
+// HashtagCooccurrence counts how often the neighbors of some seed hashtags appear with them.
+// Counts holds the number of tweets of every seed and neighbor, Total the number of tweets searched.
+type HashtagCooccurrence struct {
+	Total  uint64
+	Counts map[string]uint64
+	Pairs  []*HashtagPair
+}
+
+// HashtagPair is the number of tweets having both hashtags.
+type HashtagPair struct {
+	Seed     string
+	Neighbor string
+	Count    uint64
+}
+
+// HashtagGraph is the co-occurrence network around seed hashtags.
+type HashtagGraph struct {
+	Nodes []*HashtagNode `json:"nodes"`
+	Edges []*HashtagEdge `json:"edges"`
+
+	nodes map[string]*HashtagNode
+	edges map[[2]string]*HashtagEdge
+}
+
+// HashtagNode is a hashtag of the graph. Hop is 0 for the seeds and the expansion that reached it otherwise.
+type HashtagNode struct {
+	Hashtag     string `json:"hashtag"`
+	StatusCount uint64 `json:"status_count"`
+	Hop         int    `json:"hop"`
+}
+
+// HashtagEdge links two hashtags used in the same tweets. Lift is how many times more often that
+// happens than if they were independent, and PMI its base 2 logarithm.
+type HashtagEdge struct {
+	Source string  `json:"source"`
+	Target string  `json:"target"`
+	Count  uint64  `json:"count"`
+	Lift   float64 `json:"lift"`
+	PMI    float64 `json:"pmi"`
+}
+
+func NewHashtagGraph(seeds []string) *HashtagGraph {
+	g := &HashtagGraph{
+		Nodes: []*HashtagNode{},
+		Edges: []*HashtagEdge{},
+		nodes: map[string]*HashtagNode{},
+		edges: map[[2]string]*HashtagEdge{},
+	}
+	for _, s := range seeds {
+		g.node(s, 0)
+	}
+	return g
+}
+
+func (g *HashtagGraph) node(hashtag string, hop int) (*HashtagNode, bool) {
+	if n, ok := g.nodes[hashtag]; ok {
+		return n, false
+	}
+	n := &HashtagNode{Hashtag: hashtag, Hop: hop}
+	g.nodes[hashtag] = n
+	g.Nodes = append(g.Nodes, n)
+	return n, true
+}
+
+// Expand adds the pairs seen at least minCount times as edges, and their neighbors as nodes of hop.
+// It returns the neighbors that were not in the graph yet, which are the seeds of the next hop.
+func (g *HashtagGraph) Expand(co *HashtagCooccurrence, hop, minCount int) []string {
+	var added []string
+	for _, p := range co.Pairs {
+		if p.Seed == p.Neighbor || p.Count < uint64(minCount) {
+			continue
+		}
+		if _, ok := g.nodes[p.Seed]; !ok {
+			continue
+		}
+		if _, isNew := g.node(p.Neighbor, hop); isNew {
+			added = append(added, p.Neighbor)
+		}
+		// the graph is undirected, so a pair found from both ends is one edge
+		key := [2]string{p.Seed, p.Neighbor}
+		if key[1] < key[0] {
+			key[0], key[1] = key[1], key[0]
+		}
+		if _, ok := g.edges[key]; ok {
+			continue
+		}
+		e := &HashtagEdge{Source: p.Seed, Target: p.Neighbor, Count: p.Count}
+		a, b := co.Counts[p.Seed], co.Counts[p.Neighbor]
+		if a > 0 && b > 0 && co.Total > 0 {
+			e.Lift = float64(p.Count) * float64(co.Total) / (float64(a) * float64(b))
+			e.PMI = math.Log2(e.Lift)
+		}
+		g.edges[key] = e
+		g.Edges = append(g.Edges, e)
+	}
+	for h, c := range co.Counts {
+		if n, ok := g.nodes[h]; ok && n.StatusCount == 0 {
+			n.StatusCount = c
+		}
+	}
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		return g.Edges[i].Count > g.Edges[j].Count
+	})
+	return added
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHashtagGraph_Expand(t *testing.T) {
+	g := NewHashtagGraph([]string{"golang"})
+	added := g.Expand(&HashtagCooccurrence{
+		Total:  1000,
+		Counts: map[string]uint64{"golang": 100, "rust": 50, "python": 400, "tiny": 2},
+		Pairs: []*HashtagPair{
+			{Seed: "golang", Neighbor: "golang", Count: 100},
+			{Seed: "golang", Neighbor: "rust", Count: 20},
+			{Seed: "golang", Neighbor: "python", Count: 40},
+			{Seed: "golang", Neighbor: "tiny", Count: 1},
+		},
+	}, 1, 2)
+	if len(added) != 2 || added[0] != "rust" || added[1] != "python" {
+		t.Fatalf("Expand() added %v, want [rust python]", added)
+	}
+	if len(g.Edges) != 2 || g.Edges[0].Target != "python" {
+		t.Fatalf("Edges = %+v, want python then rust", g.Edges)
+	}
+	// 20 * 1000 / (100 * 50)
+	if rust := g.Edges[1]; rust.Lift != 4 || math.Abs(rust.PMI-2) > 1e-9 {
+		t.Errorf("rust lift = %v, pmi = %v, want 4, 2", rust.Lift, rust.PMI)
+	}
+
+	added = g.Expand(&HashtagCooccurrence{
+		Total:  1000,
+		Counts: map[string]uint64{"rust": 50, "golang": 100, "wasm": 10},
+		Pairs: []*HashtagPair{
+			{Seed: "rust", Neighbor: "golang", Count: 20},
+			{Seed: "rust", Neighbor: "wasm", Count: 5},
+		},
+	}, 2, 2)
+	if len(added) != 1 || added[0] != "wasm" {
+		t.Errorf("Expand() added %v, want [wasm]", added)
+	}
+	if len(g.Edges) != 3 {
+		t.Errorf("got %d edges, want the golang-rust edge only once", len(g.Edges))
+	}
+	for _, n := range g.Nodes {
+		want := map[string]int{"golang": 0, "rust": 1, "python": 1, "wasm": 2}[n.Hashtag]
+		if n.Hop != want || n.StatusCount == 0 {
+			t.Errorf("node %+v, want hop %d", n, want)
+		}
+	}
+}
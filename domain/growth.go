@@ -0,0 +1,258 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// growthMetrics names the counters of a UserGrowthPoint in the order values returns them.
+var growthMetrics = []string{"followers", "friends", "listed", "statuses"}
+
+// transitionLayouts are the forms created_at comes back from tw_fullarchive_user_data in.
+var transitionLayouts = []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05Z07:00", "2006-01-02"}
+
+// madScale makes the median absolute deviation comparable to a standard deviation.
+const madScale = 0.6745
+
+// GrowthValue is a counter at the end of a period and its change since the previous period.
+// Rate is the change relative to the previous count and null when that was zero.
+type GrowthValue struct {
+	Count uint64   `json:"count"`
+	Delta int64    `json:"delta"`
+	Rate  *float64 `json:"rate"`
+}
+
+// UserGrowthPoint is the profile of a user at the end of the period starting at Date.
+// Interpolated is set when no snapshot was taken that day and the counts are estimated
+// from the days around it.
+type UserGrowthPoint struct {
+	Date         time.Time   `json:"date"`
+	Interpolated bool        `json:"interpolated"`
+	Followers    GrowthValue `json:"followers"`
+	Friends      GrowthValue `json:"friends"`
+	Listed       GrowthValue `json:"listed"`
+	Statuses     GrowthValue `json:"statuses"`
+}
+
+func (p *UserGrowthPoint) values() []*GrowthValue {
+	return []*GrowthValue{&p.Followers, &p.Friends, &p.Listed, &p.Statuses}
+}
+
+// GrowthAnomaly is a daily change far from the changes of the days before it.
+// Score is the robust z-score of Delta against their Median and MAD.
+type GrowthAnomaly struct {
+	Date      time.Time `json:"date"`
+	Metric    string    `json:"metric"`
+	Direction string    `json:"direction"`
+	Delta     int64     `json:"delta"`
+	Median    float64   `json:"median"`
+	MAD       float64   `json:"mad"`
+	Score     float64   `json:"score"`
+}
+
+// UserGrowth is the growth of a user per Interval and the anomalies found in the daily changes.
+type UserGrowth struct {
+	UserID    uint64             `json:"user_id"`
+	Interval  string             `json:"interval"`
+	Points    []*UserGrowthPoint `json:"points"`
+	Anomalies []*GrowthAnomaly   `json:"anomalies"`
+}
+
+// DailyGrowth returns one point per day of loc from the first to the last day with a snapshot.
+// The last snapshot of a day wins, and the days without one are linearly interpolated.
+func DailyGrowth(tts []*TweetTransition, loc *time.Location) ([]*UserGrowthPoint, error) {
+	type snapshot struct {
+		at time.Time
+		tt *TweetTransition
+	}
+	days := map[time.Time]snapshot{}
+	for _, tt := range tts {
+		at, err := parseTransitionTime(tt.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		at = at.In(loc)
+		day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, loc)
+		if s, ok := days[day]; !ok || at.After(s.at) {
+			days[day] = snapshot{at: at, tt: tt}
+		}
+	}
+	observed := make([]time.Time, 0, len(days))
+	for day := range days {
+		observed = append(observed, day)
+	}
+	sort.Slice(observed, func(i, j int) bool { return observed[i].Before(observed[j]) })
+
+	var points []*UserGrowthPoint
+	for i, day := range observed {
+		cur := days[day].tt
+		if i > 0 {
+			prevDay := observed[i-1]
+			prev := days[prevDay].tt
+			gap := day.Sub(prevDay).Hours() / 24
+			for d := prevDay.AddDate(0, 0, 1); d.Before(day); d = d.AddDate(0, 0, 1) {
+				f := d.Sub(prevDay).Hours() / 24 / gap
+				points = append(points, &UserGrowthPoint{
+					Date:         d,
+					Interpolated: true,
+					Followers:    GrowthValue{Count: interpolate(prev.FollowerCount, cur.FollowerCount, f)},
+					Friends:      GrowthValue{Count: interpolate(prev.FriendCount, cur.FriendCount, f)},
+					Listed:       GrowthValue{Count: interpolate(prev.ListedCount, cur.ListedCount, f)},
+					Statuses:     GrowthValue{Count: interpolate(prev.StatusCount, cur.StatusCount, f)},
+				})
+			}
+		}
+		points = append(points, &UserGrowthPoint{
+			Date:      day,
+			Followers: GrowthValue{Count: cur.FollowerCount},
+			Friends:   GrowthValue{Count: cur.FriendCount},
+			Listed:    GrowthValue{Count: cur.ListedCount},
+			Statuses:  GrowthValue{Count: cur.StatusCount},
+		})
+	}
+	setGrowthDeltas(points)
+	return points, nil
+}
+
+func parseTransitionTime(s string) (time.Time, error) {
+	for _, layout := range transitionLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid created_at %q in transition", s)
+}
+
+func interpolate(a, b uint64, f float64) uint64 {
+	return uint64(math.Round(float64(a) + (float64(b)-float64(a))*f))
+}
+
+// ResampleGrowth keeps the last day of every week, starting on Monday, or month of a daily series
+// and recomputes the changes between them.
+func ResampleGrowth(daily []*UserGrowthPoint, interval string) ([]*UserGrowthPoint, error) {
+	var period func(t time.Time) time.Time
+	switch interval {
+	case "day":
+		return daily, nil
+	case "week":
+		period = func(t time.Time) time.Time {
+			return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+		}
+	case "month":
+		period = func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		}
+	default:
+		return nil, fmt.Errorf("unknown interval %s", interval)
+	}
+	var points []*UserGrowthPoint
+	for _, p := range daily {
+		start := period(p.Date)
+		resampled := *p
+		resampled.Date = start
+		if n := len(points); n > 0 && points[n-1].Date.Equal(start) {
+			points[n-1] = &resampled
+		} else {
+			points = append(points, &resampled)
+		}
+	}
+	setGrowthDeltas(points)
+	return points, nil
+}
+
+// SummarizeGrowth returns the last point of a series with its changes since the first one,
+// or nil for an empty series.
+func SummarizeGrowth(points []*UserGrowthPoint) *UserGrowthPoint {
+	if len(points) == 0 {
+		return nil
+	}
+	first, last := *points[0], *points[len(points)-1]
+	setGrowthDeltas([]*UserGrowthPoint{&first, &last})
+	return &last
+}
+
+// setGrowthDeltas sets the changes of every point from the one before it.
+// The first point has nothing to compare with and keeps a zero change.
+func setGrowthDeltas(points []*UserGrowthPoint) {
+	for i, p := range points {
+		values := p.values()
+		for m, v := range values {
+			v.Delta, v.Rate = 0, nil
+			if i == 0 {
+				continue
+			}
+			prev := points[i-1].values()[m].Count
+			v.Delta = int64(v.Count) - int64(prev)
+			if prev > 0 {
+				rate := float64(v.Delta) / float64(prev)
+				v.Rate = &rate
+			}
+		}
+	}
+}
+
+// DetectGrowthAnomalies compares the change of every observed day with the changes of up to window
+// days before it and reports the ones whose robust z-score exceeds threshold. A day needs half a
+// window of history to be judged, and a MAD below one is raised to one as the counts are integers.
+func DetectGrowthAnomalies(daily []*UserGrowthPoint, window int, threshold float64) []*GrowthAnomaly {
+	minHistory := window / 2
+	if minHistory < 3 {
+		minHistory = 3
+	}
+	var anomalies []*GrowthAnomaly
+	for i := 1; i < len(daily); i++ {
+		if daily[i].Interpolated || i-1 < minHistory {
+			continue
+		}
+		from := i - window
+		if from < 1 {
+			from = 1
+		}
+		for m, metric := range growthMetrics {
+			history := make([]float64, 0, i-from)
+			for _, p := range daily[from:i] {
+				history = append(history, float64(p.values()[m].Delta))
+			}
+			med := median(history)
+			for j, h := range history {
+				history[j] = math.Abs(h - med)
+			}
+			mad := math.Max(median(history), 1)
+
+			delta := daily[i].values()[m].Delta
+			score := madScale * (float64(delta) - med) / mad
+			if math.Abs(score) <= threshold {
+				continue
+			}
+			direction := "spike"
+			if score < 0 {
+				direction = "drop"
+			}
+			anomalies = append(anomalies, &GrowthAnomaly{
+				Date:      daily[i].Date,
+				Metric:    metric,
+				Direction: direction,
+				Delta:     delta,
+				Median:    med,
+				MAD:       mad,
+				Score:     score,
+			})
+		}
+	}
+	return anomalies
+}
+
+// median sorts values and returns their median.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
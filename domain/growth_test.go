@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func transition(day string, followers uint64) *TweetTransition {
+	return &TweetTransition{FollowerCount: followers, FriendCount: 10, ListedCount: 1, StatusCount: 100, CreatedAt: day}
+}
+
+func TestDailyGrowth(t *testing.T) {
+	points, err := DailyGrowth([]*TweetTransition{
+		transition("2020-01-04 00:00:00", 130),
+		transition("2020-01-02 12:00:00", 105),
+		transition("2020-01-02 00:00:00", 100),
+		transition("2020-01-01 00:00:00", 0),
+	}, time.UTC)
+	if err != nil {
+		t.Fatalf("DailyGrowth() error = %v", err)
+	}
+	if len(points) != 4 {
+		t.Fatalf("got %d points, want 4", len(points))
+	}
+	tests := []struct {
+		name         string
+		point        *UserGrowthPoint
+		count        uint64
+		delta        int64
+		interpolated bool
+	}{
+		{name: "最初の日", point: points[0], count: 0, delta: 0},
+		{name: "同じ日は最後のスナップショット", point: points[1], count: 105, delta: 105},
+		{name: "欠けた日は補間", point: points[2], count: 118, delta: 13, interpolated: true},
+		{name: "欠けた日の次の日", point: points[3], count: 130, delta: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.point
+			if p.Followers.Count != tt.count || p.Followers.Delta != tt.delta || p.Interpolated != tt.interpolated {
+				t.Errorf("point = %v %+v interpolated %v, want count %d delta %d", p.Date, p.Followers, p.Interpolated, tt.count, tt.delta)
+			}
+		})
+	}
+	if points[1].Followers.Rate != nil {
+		t.Errorf("rate after zero followers = %v, want nil", *points[1].Followers.Rate)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local, err := DailyGrowth([]*TweetTransition{transition("2020-01-01 20:00:00", 1)}, tokyo); err != nil || local[0].Date.Day() != 2 {
+		t.Errorf("DailyGrowth() in Asia/Tokyo = %v, %v, want a point on the 2nd", local, err)
+	}
+	if _, err := DailyGrowth([]*TweetTransition{transition("yesterday", 1)}, time.UTC); err == nil {
+		t.Errorf("DailyGrowth() with an invalid created_at did not fail")
+	}
+}
+
+func TestResampleGrowth(t *testing.T) {
+	var tts []*TweetTransition
+	for d := 1; d <= 14; d++ {
+		tts = append(tts, transition(fmt.Sprintf("2020-01-%02d", d), uint64(d*10)))
+	}
+	daily, err := DailyGrowth(tts, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekly, err := ResampleGrowth(daily, "week")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2020-01-01 is a Wednesday
+	want := []struct {
+		date  string
+		count uint64
+		delta int64
+	}{
+		{"2019-12-30", 50, 0},
+		{"2020-01-06", 120, 70},
+		{"2020-01-13", 140, 20},
+	}
+	if len(weekly) != len(want) {
+		t.Fatalf("got %d weeks, want %d", len(weekly), len(want))
+	}
+	for i, w := range want {
+		if got := weekly[i]; got.Date.Format("2006-01-02") != w.date || got.Followers.Count != w.count || got.Followers.Delta != w.delta {
+			t.Errorf("week %d = %v %+v, want %+v", i, got.Date, got.Followers, w)
+		}
+	}
+	if daily[1].Followers.Delta != 10 {
+		t.Errorf("ResampleGrowth() changed the daily series")
+	}
+	if total := SummarizeGrowth(daily); total.Followers.Count != 140 || total.Followers.Delta != 130 || *total.Followers.Rate != 13 {
+		t.Errorf("SummarizeGrowth() = %+v, want 140 up 130 from 10", total.Followers)
+	}
+	if SummarizeGrowth(nil) != nil {
+		t.Errorf("SummarizeGrowth() of an empty series is not nil")
+	}
+	if _, err := ResampleGrowth(daily, "year"); err == nil {
+		t.Errorf("ResampleGrowth() with an unknown interval did not fail")
+	}
+}
+
+func TestDetectGrowthAnomalies(t *testing.T) {
+	followers := []uint64{100, 102, 103, 105, 106, 108, 109, 111, 5111, 5112, 1000}
+	var tts []*TweetTransition
+	for i, f := range followers {
+		tts = append(tts, transition(time.Date(2020, 1, i+1, 0, 0, 0, 0, time.UTC).Format("2006-01-02"), f))
+	}
+	daily, err := DailyGrowth(tts, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anomalies := DetectGrowthAnomalies(daily, 7, 3.5)
+	if len(anomalies) != 2 {
+		t.Fatalf("got %d anomalies, want 2: %+v", len(anomalies), anomalies)
+	}
+	if a := anomalies[0]; a.Metric != "followers" || a.Direction != "spike" || a.Delta != 5000 || a.Date.Day() != 9 {
+		t.Errorf("first anomaly = %+v, want a spike of 5000 on the 9th", a)
+	}
+	if a := anomalies[1]; a.Direction != "drop" || a.Date.Day() != 11 {
+		t.Errorf("second anomaly = %+v, want a drop on the 11th", a)
+	}
+}
@@ -1,6 +1,15 @@
 package domain
 
-import "time"
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// ErrTooManyBuckets is returned when an aggregation would exceed the buckets the cluster allows.
+var ErrTooManyBuckets = errors.New("too many buckets, narrow the date range or use a wider interval")
 
 type Hashtag struct {
 	Hashtag       string  `json:"hashtag"`
@@ -20,7 +29,165 @@ type HashtagBySearch struct {
 	StatusCount   uint64  `json:"status_count"`
 }
 
+// HashtagFilter selects the tweets hashtag statistics are computed over.
+// Zero counts leave that side of a range open.
+type HashtagFilter struct {
+	Keyword         string
+	Hashtag         []string
+	TweetType       []int
+	RetweetMin      int
+	RetweetMax      int
+	QuoteMin        int
+	QuoteMax        int
+	FavoriteMin     int
+	FavoriteMax     int
+	UserInclude     []string
+	UserExclude     []string
+	HashtagInclude  []string
+	HashtagExclude  []string
+	UserFollowerMin int
+	UserFollowerMax int
+	UserStatusMin   int
+	UserStatusMax   int
+	StartDate       time.Time
+	EndDate         time.Time
+}
+
+// HashtagInterval is the bucket width of a hashtag time series.
+type HashtagInterval string
+
+const (
+	HashtagIntervalHour HashtagInterval = "hour"
+	HashtagIntervalDay  HashtagInterval = "day"
+	HashtagIntervalWeek HashtagInterval = "week"
+)
+
+// HashtagTimeseries is the activity of one hashtag per interval.
+type HashtagTimeseries struct {
+	Hashtag string           `json:"hashtag"`
+	Buckets []*HashtagBucket `json:"buckets"`
+}
+
+type HashtagBucket struct {
+	Date          string  `json:"date"`
+	StatusCount   uint64  `json:"status_count"`
+	RetweetAvg    float64 `json:"retweet_avg"`
+	RetweetCount  uint64  `json:"retweet_count"`
+	FavoriteAvg   float64 `json:"favorite_avg"`
+	FavoriteCount uint64  `json:"favorite_count"`
+	ReplyAvg      float64 `json:"reply_avg"`
+	ReplyCount    uint64  `json:"reply_count"`
+	QuoteAvg      float64 `json:"quote_avg"`
+	QuoteCount    uint64  `json:"quote_count"`
+}
+
+// HashtagTrendCounts are the tweet counts of a target window and of the baseline window before it.
+type HashtagTrendCounts struct {
+	TargetTotal   uint64
+	BaselineTotal uint64
+	Hashtags      []*HashtagWindowCount
+}
+
+type HashtagWindowCount struct {
+	Hashtag       string
+	TargetCount   uint64
+	BaselineCount uint64
+}
+
+// HashtagTrend is a hashtag used more in the target window than its baseline predicts.
+type HashtagTrend struct {
+	Hashtag       string  `json:"hashtag"`
+	StatusCount   uint64  `json:"status_count"`
+	BaselineCount uint64  `json:"baseline_count"`
+	ExpectedCount float64 `json:"expected_count"`
+	Score         float64 `json:"score"`
+}
+
+// ScoreHashtagTrends ranks the hashtags with at least minCount tweets in the target window by burst score.
+// A hashtag is expected to keep its baseline share of all tweets, so changes in the overall volume do not
+// make every hashtag trend. The score is the deviation from the expected count in Poisson standard
+// deviations; the +1 keeps hashtags that are new in the target window from dividing by zero.
+// Hashtags at or below their expected count are left out.
+func ScoreHashtagTrends(counts *HashtagTrendCounts, minCount int) []*HashtagTrend {
+	trends := []*HashtagTrend{}
+	for _, h := range counts.Hashtags {
+		if h.TargetCount < uint64(minCount) {
+			continue
+		}
+		var expected float64
+		if counts.BaselineTotal > 0 {
+			expected = float64(h.BaselineCount) * float64(counts.TargetTotal) / float64(counts.BaselineTotal)
+		}
+		score := (float64(h.TargetCount) - expected) / math.Sqrt(expected+1)
+		if score <= 0 {
+			continue
+		}
+		trends = append(trends, &HashtagTrend{
+			Hashtag:       h.Hashtag,
+			StatusCount:   h.TargetCount,
+			BaselineCount: h.BaselineCount,
+			ExpectedCount: expected,
+			Score:         score,
+		})
+	}
+	sort.SliceStable(trends, func(i, j int) bool {
+		if trends[i].Score != trends[j].Score {
+			return trends[i].Score > trends[j].Score
+		}
+		return trends[i].Hashtag < trends[j].Hashtag
+	})
+	return trends
+}
+
+// HashtagContributors are the accounts tweeting a hashtag the most and drawing the most engagement with it.
+// Engagement is the sum of the retweets, favorites, replies and quotes of the tweets.
+type HashtagContributors struct {
+	Hashtag         string                `json:"hashtag"`
+	StatusCount     uint64                `json:"status_count"`
+	EngagementCount uint64                `json:"engagement_count"`
+	ByStatus        []*HashtagContributor `json:"by_status"`
+	ByEngagement    []*HashtagContributor `json:"by_engagement"`
+}
+
+// HashtagContributor is an account's part of a hashtag. User is nil when its profile is not indexed in the range.
+type HashtagContributor struct {
+	UserID          string  `json:"user_id"`
+	User            *User   `json:"user"`
+	StatusCount     uint64  `json:"status_count"`
+	EngagementCount uint64  `json:"engagement_count"`
+	StatusShare     float64 `json:"status_share"`
+	EngagementShare float64 `json:"engagement_share"`
+}
+
+// SetShares sets the part of the hashtag's volume and engagement each contributor accounts for.
+func (h *HashtagContributors) SetShares() {
+	for _, list := range [][]*HashtagContributor{h.ByStatus, h.ByEngagement} {
+		for _, c := range list {
+			if h.StatusCount > 0 {
+				c.StatusShare = float64(c.StatusCount) / float64(h.StatusCount)
+			}
+			if h.EngagementCount > 0 {
+				c.EngagementShare = float64(c.EngagementCount) / float64(h.EngagementCount)
+			}
+		}
+	}
+}
+
 type HashtagRepository interface {
-	Get(keyword string, hashtag []string, tweetType []int, retweetMin, retweetMax, quoteMin, quoteMax, favoriteMin, favoriteMax int, userInclude, userExclude, hashtagInclude, hashtagExclude []string, userFollowerMin, userFollowerMax, userStatusMin, userStatusMax, count int, startDate, endDate time.Time) ([]*Hashtag, int, error)
-	Search(hashtag string, startDate, endDate time.Time, count int) ([]*HashtagBySearch, int, error)
+	Get(ctx context.Context, filter *HashtagFilter, count int, cursor *Cursor) ([]*Hashtag, *Page, error)
+	// GetByName returns count hashtags of filter in the order of their names, continuing after cursor.
+	// Unlike Get, whose ranking ends at the bucket limit, it pages through every hashtag.
+	GetByName(ctx context.Context, filter *HashtagFilter, count int, cursor *Cursor) ([]*Hashtag, *Page, error)
+	Search(ctx context.Context, hashtag string, startDate, endDate time.Time, count int, cursor *Cursor) ([]*HashtagBySearch, *Page, error)
+	Timeseries(ctx context.Context, hashtags []string, filter *HashtagFilter, interval HashtagInterval) ([]*HashtagTimeseries, error)
+	// Trending counts the tweets of the hashtags most used from targetStart to filter.EndDate,
+	// and of the same hashtags from filter.StartDate to targetStart.
+	Trending(ctx context.Context, filter *HashtagFilter, targetStart time.Time, candidates int) (*HashtagTrendCounts, error)
+	// Cooccurrence returns up to size hashtags most used with each seed.
+	Cooccurrence(ctx context.Context, seeds []string, filter *HashtagFilter, size int) (*HashtagCooccurrence, error)
+	// Contributors returns the count accounts with the most tweets and the most engagement with hashtag,
+	// without their profiles.
+	Contributors(ctx context.Context, hashtag string, filter *HashtagFilter, count int) (*HashtagContributors, error)
+	// Suggest returns the hashtags starting with any of prefixes, the most used first.
+	Suggest(ctx context.Context, prefixes []string, startDate, endDate time.Time, count int) ([]*HashtagBySearch, error)
 }
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestScoreHashtagTrends(t *testing.T) {
+	tests := []struct {
+		name     string
+		counts   *HashtagTrendCounts
+		minCount int
+		want     []string
+	}{
+		{
+			name: "基準より増えた順",
+			counts: &HashtagTrendCounts{
+				TargetTotal:   100,
+				BaselineTotal: 700,
+				Hashtags: []*HashtagWindowCount{
+					{Hashtag: "steady", TargetCount: 30, BaselineCount: 210},
+					{Hashtag: "burst", TargetCount: 40, BaselineCount: 70},
+					{Hashtag: "new", TargetCount: 20, BaselineCount: 0},
+				},
+			},
+			minCount: 10,
+			want:     []string{"new", "burst"},
+		},
+		{
+			name: "全体の件数が倍になっても比率が同じなら対象外",
+			counts: &HashtagTrendCounts{
+				TargetTotal:   200,
+				BaselineTotal: 100,
+				Hashtags: []*HashtagWindowCount{
+					{Hashtag: "steady", TargetCount: 20, BaselineCount: 10},
+				},
+			},
+			minCount: 1,
+			want:     []string{},
+		},
+		{
+			name: "最低件数未満は対象外",
+			counts: &HashtagTrendCounts{
+				TargetTotal:   100,
+				BaselineTotal: 700,
+				Hashtags: []*HashtagWindowCount{
+					{Hashtag: "small", TargetCount: 5, BaselineCount: 0},
+				},
+			},
+			minCount: 10,
+			want:     []string{},
+		},
+		{
+			name: "基準期間にツイートがない",
+			counts: &HashtagTrendCounts{
+				TargetTotal: 10,
+				Hashtags: []*HashtagWindowCount{
+					{Hashtag: "a", TargetCount: 3},
+					{Hashtag: "b", TargetCount: 7},
+				},
+			},
+			minCount: 1,
+			want:     []string{"b", "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScoreHashtagTrends(tt.counts, tt.minCount)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ScoreHashtagTrends() returned %d trends, want %d", len(got), len(tt.want))
+			}
+			for i, h := range tt.want {
+				if got[i].Hashtag != h {
+					t.Errorf("ScoreHashtagTrends()[%d] = %s, want %s", i, got[i].Hashtag, h)
+				}
+			}
+		})
+	}
+}
+
+func TestHashtagContributors_SetShares(t *testing.T) {
+	c := &HashtagContributors{
+		StatusCount:     200,
+		EngagementCount: 0,
+		ByStatus:        []*HashtagContributor{{UserID: "1", StatusCount: 50}},
+		ByEngagement:    []*HashtagContributor{{UserID: "2", StatusCount: 10}},
+	}
+	c.SetShares()
+	if c.ByStatus[0].StatusShare != 0.25 || c.ByEngagement[0].StatusShare != 0.05 {
+		t.Errorf("StatusShare = %v, %v, want 0.25, 0.05", c.ByStatus[0].StatusShare, c.ByEngagement[0].StatusShare)
+	}
+	if c.ByStatus[0].EngagementShare != 0 {
+		t.Errorf("EngagementShare = %v without engagement, want 0", c.ByStatus[0].EngagementShare)
+	}
+}
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// halfwidthKatakana maps U+FF61 to U+FF9F to their fullwidth forms.
+var halfwidthKatakana = []rune("。「」、・ヲァィゥェォャュョッーアイウエオカキクケコサシスセソタチツテトナニヌネノハヒフヘホマミムメモヤユヨラリルレロワン゛゜")
+
+const (
+	halfwidthVoiced     = 'ﾞ'
+	halfwidthSemiVoiced = 'ﾟ'
+)
+
+// NormalizeWidth folds the width variants NFKC folds that matter for hashtags typed in Japanese:
+// fullwidth ASCII becomes ASCII and halfwidth katakana becomes fullwidth, voiced marks included.
+func NormalizeWidth(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == '　':
+			r = ' '
+		case r >= '！' && r <= '～':
+			r -= 0xFEE0
+		case r >= '｡' && r <= 'ﾟ':
+			r = halfwidthKatakana[r-'｡']
+			if next, n := utf8.DecodeRuneInString(s[i:]); next == halfwidthVoiced || next == halfwidthSemiVoiced {
+				if v, ok := voice(r, next == halfwidthSemiVoiced); ok {
+					r = v
+					i += n
+				}
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// voice returns the katakana with a dakuten, or a handakuten when semi, if it has one.
+func voice(r rune, semi bool) (rune, bool) {
+	switch {
+	case semi && strings.ContainsRune("ハヒフヘホ", r):
+		return r + 2, true
+	case semi:
+		return r, false
+	case r == 'ウ':
+		return 'ヴ', true
+	case strings.ContainsRune("カキクケコサシスセソタチツテトハヒフヘホ", r):
+		return r + 1, true
+	}
+	return r, false
+}
+
+// ToKatakana converts hiragana to katakana, leaving everything else as is.
+func ToKatakana(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'ぁ' && r <= 'ゖ' {
+			return r + 0x60
+		}
+		return r
+	}, s)
+}
+
+// ToHiragana converts katakana to hiragana, leaving everything else as is.
+func ToHiragana(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'ァ' && r <= 'ヶ' {
+			return r - 0x60
+		}
+		return r
+	}, s)
+}
+
+// HashtagPrefixVariants returns the spellings a hashtag starting with prefix may have been indexed with:
+// the width normalized prefix, lower cased, each in hiragana and in katakana.
+func HashtagPrefixVariants(prefix string) []string {
+	normalized := NormalizeWidth(strings.TrimPrefix(strings.TrimSpace(prefix), "#"))
+	var variants []string
+	seen := map[string]bool{}
+	for _, p := range []string{normalized, strings.ToLower(normalized)} {
+		for _, v := range []string{p, ToKatakana(p), ToHiragana(p)} {
+			if v != "" && !seen[v] {
+				seen[v] = true
+				variants = append(variants, v)
+			}
+		}
+	}
+	return variants
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeWidth(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{name: "全角英数", s: "ＧｏＬａｎｇ２０２０", want: "GoLang2020"},
+		{name: "半角カナ", s: "ｺﾛﾅ", want: "コロナ"},
+		{name: "濁点", s: "ｶﾞｯｺｳ", want: "ガッコウ"},
+		{name: "半濁点", s: "ﾎﾟｹﾓﾝ", want: "ポケモン"},
+		{name: "ヴ", s: "ｳﾞｨｰｶﾞﾝ", want: "ヴィーガン"},
+		{name: "濁点が付かない文字", s: "ｱﾞ", want: "ア゛"},
+		{name: "そのまま", s: "東京オリンピック", want: "東京オリンピック"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeWidth(tt.s); got != tt.want {
+				t.Errorf("NormalizeWidth() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashtagPrefixVariants(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{name: "ひらがな", prefix: "#ころな", want: []string{"ころな", "コロナ"}},
+		{name: "半角カナ", prefix: "ｺﾛﾅ", want: []string{"コロナ", "ころな"}},
+		{name: "英字", prefix: "Ｇｏ", want: []string{"Go", "go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HashtagPrefixVariants(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("HashtagPrefixVariants() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
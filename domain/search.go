@@ -0,0 +1,304 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SearchOperator is the kind of a node in a parsed tweet search query.
+type SearchOperator int
+
+const (
+	SearchTerm SearchOperator = iota
+	SearchAnd
+	SearchOr
+	SearchNot
+)
+
+// SearchField is the tweet attribute a search term is matched against.
+type SearchField string
+
+const (
+	SearchFieldText    SearchField = "text"
+	SearchFieldFrom    SearchField = "from"
+	SearchFieldHashtag SearchField = "hashtag"
+	SearchFieldDomain  SearchField = "domain"
+	SearchFieldHas     SearchField = "has"
+)
+
+// SearchHasValues are the values accepted by the has: operator.
+var SearchHasValues = []string{"media", "photo", "video", "gif"}
+
+// SearchQuery is a node of a parsed tweet search query.
+// Term nodes carry Field/Value, operator nodes carry Children.
+type SearchQuery struct {
+	Operator SearchOperator `json:"operator"`
+	Field    SearchField    `json:"field,omitempty"`
+	Value    string         `json:"value,omitempty"`
+	Phrase   bool           `json:"phrase,omitempty"`
+	Children []*SearchQuery `json:"children,omitempty"`
+}
+
+type searchTokenKind int
+
+const (
+	tokenTerm searchTokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type searchToken struct {
+	kind   searchTokenKind
+	field  SearchField
+	value  string
+	phrase bool
+}
+
+// ParseSearchQuery parses a tweet search expression such as `"新商品" OR #lawson -from:akiko_lawson has:media`.
+// Terms separated by whitespace are combined with AND; OR binds looser than AND,
+// NOT (or a leading "-") negates the following term or group.
+func ParseSearchQuery(s string) (*SearchQuery, error) {
+	tokens, err := tokenizeSearchQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("search query is empty")
+	}
+	p := &searchParser{tokens: tokens}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s in search query", p.tokens[p.pos].describe())
+	}
+	return q, nil
+}
+
+func tokenizeSearchQuery(s string) ([]searchToken, error) {
+	var tokens []searchToken
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, searchToken{kind: tokenLParen})
+			i++
+		case r == ')':
+			tokens = append(tokens, searchToken{kind: tokenRParen})
+			i++
+		case r == '-' && i+1 < len(rs) && !unicode.IsSpace(rs[i+1]):
+			tokens = append(tokens, searchToken{kind: tokenNot})
+			i++
+		case r == '"':
+			value, next, err := readQuoted(rs, i)
+			if err != nil {
+				return nil, err
+			}
+			if value != "" {
+				tokens = append(tokens, searchToken{kind: tokenTerm, field: SearchFieldText, value: value, phrase: true})
+			}
+			i = next
+		default:
+			start := i
+			for i < len(rs) && !unicode.IsSpace(rs[i]) && rs[i] != '(' && rs[i] != ')' && rs[i] != '"' {
+				i++
+			}
+			word := string(rs[start:i])
+			switch word {
+			case "AND":
+				tokens = append(tokens, searchToken{kind: tokenAnd})
+				continue
+			case "OR":
+				tokens = append(tokens, searchToken{kind: tokenOr})
+				continue
+			case "NOT":
+				tokens = append(tokens, searchToken{kind: tokenNot})
+				continue
+			}
+			// field:"quoted value"
+			quoted := false
+			if strings.HasSuffix(word, ":") && i < len(rs) && rs[i] == '"' {
+				value, next, err := readQuoted(rs, i)
+				if err != nil {
+					return nil, err
+				}
+				word += value
+				i = next
+				quoted = true
+			}
+			t, err := parseSearchTerm(word, quoted)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func readQuoted(rs []rune, start int) (string, int, error) {
+	for i := start + 1; i < len(rs); i++ {
+		if rs[i] == '"' {
+			return strings.TrimSpace(string(rs[start+1 : i])), i + 1, nil
+		}
+	}
+	return "", 0, errors.New("unterminated quote in search query")
+}
+
+func parseSearchTerm(word string, quoted bool) (searchToken, error) {
+	if strings.HasPrefix(word, "#") {
+		tag := strings.TrimPrefix(word, "#")
+		if tag == "" {
+			return searchToken{}, errors.New("empty hashtag in search query")
+		}
+		return searchToken{kind: tokenTerm, field: SearchFieldHashtag, value: tag}, nil
+	}
+	if idx := strings.Index(word, ":"); idx > 0 {
+		field := SearchField(strings.ToLower(word[:idx]))
+		value := word[idx+1:]
+		switch field {
+		case SearchFieldFrom, SearchFieldDomain, SearchFieldHas:
+			if value == "" {
+				return searchToken{}, fmt.Errorf("missing value for %s: in search query", field)
+			}
+			if field == SearchFieldFrom {
+				value = strings.TrimPrefix(value, "@")
+			}
+			if field == SearchFieldHas {
+				value = strings.ToLower(value)
+				if !containsString(SearchHasValues, value) {
+					return searchToken{}, fmt.Errorf("has:%s is not supported, use one of %s", value, strings.Join(SearchHasValues, ", "))
+				}
+			}
+			return searchToken{kind: tokenTerm, field: field, value: value, phrase: quoted}, nil
+		}
+	}
+	return searchToken{kind: tokenTerm, field: SearchFieldText, value: word, phrase: quoted}, nil
+}
+
+func (t searchToken) describe() string {
+	switch t.kind {
+	case tokenAnd:
+		return "AND"
+	case tokenOr:
+		return "OR"
+	case tokenNot:
+		return "NOT"
+	case tokenLParen:
+		return "\"(\""
+	case tokenRParen:
+		return "\")\""
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+}
+
+func (p *searchParser) peek() (searchToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return searchToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *searchParser) parseOr() (*SearchQuery, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []*SearchQuery{left}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != tokenOr {
+			break
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	if len(children) == 1 {
+		return left, nil
+	}
+	return &SearchQuery{Operator: SearchOr, Children: children}, nil
+}
+
+func (p *searchParser) parseAnd() (*SearchQuery, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	children := []*SearchQuery{left}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokenOr || t.kind == tokenRParen {
+			break
+		}
+		if t.kind == tokenAnd {
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	if len(children) == 1 {
+		return left, nil
+	}
+	return &SearchQuery{Operator: SearchAnd, Children: children}, nil
+}
+
+func (p *searchParser) parseUnary() (*SearchQuery, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of search query")
+	}
+	switch t.kind {
+	case tokenNot:
+		p.pos++
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &SearchQuery{Operator: SearchNot, Children: []*SearchQuery{child}}, nil
+	case tokenLParen:
+		p.pos++
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != tokenRParen {
+			return nil, errors.New("missing \")\" in search query")
+		}
+		p.pos++
+		return q, nil
+	case tokenTerm:
+		p.pos++
+		return &SearchQuery{Operator: SearchTerm, Field: t.field, Value: t.value, Phrase: t.phrase}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s in search query", t.describe())
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func term(field SearchField, value string, phrase bool) *SearchQuery {
+	return &SearchQuery{Operator: SearchTerm, Field: field, Value: value, Phrase: phrase}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	type args struct {
+		s string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *SearchQuery
+		wantErr bool
+	}{
+		{
+			name: "単一キーワード",
+			args: args{s: "ニュース"},
+			want: term(SearchFieldText, "ニュース", false),
+		},
+		{
+			name: "暗黙のAND",
+			args: args{s: "ニュース 天気"},
+			want: &SearchQuery{Operator: SearchAnd, Children: []*SearchQuery{
+				term(SearchFieldText, "ニュース", false),
+				term(SearchFieldText, "天気", false),
+			}},
+		},
+		{
+			name: "ORはANDより優先度が低い",
+			args: args{s: "a b OR c"},
+			want: &SearchQuery{Operator: SearchOr, Children: []*SearchQuery{
+				{Operator: SearchAnd, Children: []*SearchQuery{
+					term(SearchFieldText, "a", false),
+					term(SearchFieldText, "b", false),
+				}},
+				term(SearchFieldText, "c", false),
+			}},
+		},
+		{
+			name: "フレーズと演算子",
+			args: args{s: `"新商品 発売" AND (from:@akiko_lawson OR #ローソン) -has:media`},
+			want: &SearchQuery{Operator: SearchAnd, Children: []*SearchQuery{
+				term(SearchFieldText, "新商品 発売", true),
+				{Operator: SearchOr, Children: []*SearchQuery{
+					term(SearchFieldFrom, "akiko_lawson", false),
+					term(SearchFieldHashtag, "ローソン", false),
+				}},
+				{Operator: SearchNot, Children: []*SearchQuery{
+					term(SearchFieldHas, "media", false),
+				}},
+			}},
+		},
+		{
+			name: "NOTとdomain",
+			args: args{s: `NOT domain:"www.lawson.co.jp"`},
+			want: &SearchQuery{Operator: SearchNot, Children: []*SearchQuery{
+				term(SearchFieldDomain, "www.lawson.co.jp", true),
+			}},
+		},
+		{
+			name: "未知のフィールドはキーワード扱い",
+			args: args{s: "https://example.com"},
+			want: term(SearchFieldText, "https://example.com", false),
+		},
+		{
+			name:    "空のクエリ",
+			args:    args{s: "  "},
+			wantErr: true,
+		},
+		{
+			name:    "閉じていない引用符",
+			args:    args{s: `"ニュース`},
+			wantErr: true,
+		},
+		{
+			name:    "閉じていない括弧",
+			args:    args{s: "(a OR b"},
+			wantErr: true,
+		},
+		{
+			name:    "末尾のOR",
+			args:    args{s: "a OR"},
+			wantErr: true,
+		},
+		{
+			name:    "未対応のhas",
+			args:    args{s: "has:poll"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSearchQuery(tt.args.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSearchQuery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSearchQuery() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
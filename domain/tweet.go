@@ -1,6 +1,10 @@
 package domain
 
-import "time"
+import (
+	"context"
+	"sns-api/datetime"
+	"time"
+)
 
 type Tweet struct {
 	UserID         string            `json:"user_id"`
@@ -16,6 +20,11 @@ type Tweet struct {
 	NestedURL      []*TweetNestedURL `json:"nested_url"`
 }
 
+// Localize renders CreatedAt, which the repositories return in UTC, in loc.
+func (t *Tweet) Localize(loc *time.Location) {
+	t.CreatedAt = datetime.Render(t.CreatedAt, loc)
+}
+
 type TweetNestedURL struct {
 	CanonicalURL string `json:"canonical_url"`
 	Domain       string `json:"domain"`
@@ -49,14 +58,148 @@ type TweetTransition struct {
 	CreatedAt     string `json:"created_at"`
 }
 
+// LocalizeTransitions renders the CreatedAt of every snapshot, stored in UTC, in loc.
+func LocalizeTransitions(tts []*TweetTransition, loc *time.Location) {
+	for _, tt := range tts {
+		tt.CreatedAt = datetime.Render(tt.CreatedAt, loc)
+	}
+}
+
+// TweetHourlyCount is the activity of one hour. DocCount can exceed StatusCount
+// because a tweet may be indexed more than once, and the sums are over DocCount.
+type TweetHourlyCount struct {
+	Hour        time.Time
+	StatusCount uint64
+	DocCount    uint64
+	FavoriteSum float64
+	RetweetSum  float64
+}
+
+// TweetHeatmap is the activity by weekday and hour, Sunday first, in Timezone.
+type TweetHeatmap struct {
+	Timezone    string         `json:"timezone"`
+	StatusCount [7][24]uint64  `json:"status_count"`
+	FavoriteAvg [7][24]float64 `json:"favorite_avg"`
+	RetweetAvg  [7][24]float64 `json:"retweet_avg"`
+}
+
+// NewTweetHeatmap folds hourly counts into the weekdays and hours of loc.
+func NewTweetHeatmap(counts []*TweetHourlyCount, loc *time.Location) *TweetHeatmap {
+	h := &TweetHeatmap{Timezone: loc.String()}
+	var docs [7][24]uint64
+	var favorites, retweets [7][24]float64
+	for _, c := range counts {
+		t := c.Hour.In(loc)
+		d, hour := t.Weekday(), t.Hour()
+		h.StatusCount[d][hour] += c.StatusCount
+		docs[d][hour] += c.DocCount
+		favorites[d][hour] += c.FavoriteSum
+		retweets[d][hour] += c.RetweetSum
+	}
+	for d := range docs {
+		for hour, n := range docs[d] {
+			if n > 0 {
+				h.FavoriteAvg[d][hour] = favorites[d][hour] / float64(n)
+				h.RetweetAvg[d][hour] = retweets[d][hour] / float64(n)
+			}
+		}
+	}
+	return h
+}
+
+// TweetMetricStats summarizes one engagement count over the tweets of a period.
+type TweetMetricStats struct {
+	Total  float64 `json:"total"`
+	Avg    float64 `json:"avg"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+}
+
+// TweetStats summarizes the tweets of a user in a period. The engagement statistics and
+// media counts cover normal tweets, the counts by tweet type every tweet.
+type TweetStats struct {
+	StartDate      time.Time         `json:"start_date"`
+	EndDate        time.Time         `json:"end_date"`
+	StatusCount    uint64            `json:"status_count"`
+	Favorite       TweetMetricStats  `json:"favorite"`
+	Retweet        TweetMetricStats  `json:"retweet"`
+	Reply          TweetMetricStats  `json:"reply"`
+	Quote          TweetMetricStats  `json:"quote"`
+	FollowerCount  float64           `json:"follower_count"`
+	EngagementRate float64           `json:"engagement_rate"`
+	ByTweetType    map[string]uint64 `json:"by_tweet_type"`
+	ByMediaType    map[string]uint64 `json:"by_media_type"`
+}
+
+// Localize reports the period in loc.
+func (s *TweetStats) Localize(loc *time.Location) {
+	s.StartDate = s.StartDate.In(loc)
+	s.EndDate = s.EndDate.In(loc)
+}
+
+// SetFollowerCount sets the engagement rate, the average engagements of a tweet per follower.
+// It stays zero when the follower count is unknown.
+func (s *TweetStats) SetFollowerCount(followers float64) {
+	s.FollowerCount = followers
+	if followers > 0 {
+		s.EngagementRate = (s.Favorite.Avg + s.Retweet.Avg + s.Reply.Avg + s.Quote.Avg) / followers
+	}
+}
+
+// TweetStatsComparison compares a period with the previous period of the same length.
+type TweetStatsComparison struct {
+	Current  *TweetStats       `json:"current"`
+	Previous *TweetStats       `json:"previous"`
+	Change   *TweetStatsChange `json:"change"`
+}
+
+// TweetStatsChange holds relative changes from the previous period, nil where it had nothing to compare with.
+type TweetStatsChange struct {
+	StatusCount    *float64 `json:"status_count"`
+	FavoriteAvg    *float64 `json:"favorite_avg"`
+	RetweetAvg     *float64 `json:"retweet_avg"`
+	ReplyAvg       *float64 `json:"reply_avg"`
+	QuoteAvg       *float64 `json:"quote_avg"`
+	EngagementRate *float64 `json:"engagement_rate"`
+}
+
+func CompareTweetStats(current, previous *TweetStats) *TweetStatsComparison {
+	change := func(cur, prev float64) *float64 {
+		if prev == 0 {
+			return nil
+		}
+		c := (cur - prev) / prev
+		return &c
+	}
+	return &TweetStatsComparison{
+		Current:  current,
+		Previous: previous,
+		Change: &TweetStatsChange{
+			StatusCount:    change(float64(current.StatusCount), float64(previous.StatusCount)),
+			FavoriteAvg:    change(current.Favorite.Avg, previous.Favorite.Avg),
+			RetweetAvg:     change(current.Retweet.Avg, previous.Retweet.Avg),
+			ReplyAvg:       change(current.Reply.Avg, previous.Reply.Avg),
+			QuoteAvg:       change(current.Quote.Avg, previous.Quote.Avg),
+			EngagementRate: change(current.EngagementRate, previous.EngagementRate),
+		},
+	}
+}
+
+// TweetRepository reads pages of tweets by handing every tweet to each as soon as it is decoded,
+// so that exports stream them without holding the page. An error of each stops the read.
 type TweetRepository interface {
-	Get() ([]*Tweet, error)
-	GetByUser(userID uint64, startDate, endDate string, count int, orderBy string) ([]*Tweet, int, error)
-	GetByUsers(userIDs []uint64, startDate, endDate time.Time, count int, orderBy string) ([]*Tweet, int, error)
-	GetByDomain(userID uint64, startDate, endDate string, count int, orderBy string, domainName string) ([]*Tweet, int, []*URL, error)
-	GetByMediaType(userID uint64, startDate, endDate string, count int, orderBy string, mediaType int) ([]*TweetMedia, int, []*Media, error)
+	Get(ctx context.Context) ([]*Tweet, error)
+	GetByUser(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, cursor *Cursor, each func(*Tweet) error) (*Page, error)
+	GetByUsers(ctx context.Context, userIDs []uint64, startDate, endDate time.Time, count int, orderBy string, cursor *Cursor, each func(*Tweet) error) (*Page, error)
+	GetByDomain(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, domainName string, cursor *Cursor, each func(*Tweet) error) (*Page, []*URL, error)
+	GetByMediaType(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, mediaType int, cursor *Cursor, each func(*TweetMedia) error) (*Page, []*Media, error)
+	Search(ctx context.Context, query *SearchQuery, startDate, endDate time.Time, count int, orderBy string, cursor *Cursor, each func(*Tweet) error) (*Page, error)
+	// HourlyCounts returns the activity of a user per hour of loc with at least one tweet.
+	HourlyCounts(ctx context.Context, userID uint64, startDate, endDate time.Time, loc *time.Location) ([]*TweetHourlyCount, error)
+	// Stats summarizes the tweets of a user, leaving the follower count to the caller.
+	Stats(ctx context.Context, userID uint64, startDate, endDate time.Time) (*TweetStats, error)
 }
 
 type TransitionRepository interface {
-	GetTransitionByUser(userID uint64, startDate, endDate string, count int) ([]*TweetTransition, error)
+	GetTransitionByUser(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, cursor *Cursor) ([]*TweetTransition, *Page, error)
 }
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTweetHeatmap(t *testing.T) {
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	counts := []*TweetHourlyCount{
+		// Saturday 15:00 UTC is Sunday 0:00 JST
+		{Hour: time.Date(2020, 8, 1, 15, 0, 0, 0, time.UTC), StatusCount: 2, DocCount: 2, FavoriteSum: 10, RetweetSum: 4},
+		{Hour: time.Date(2020, 8, 8, 15, 0, 0, 0, time.UTC), StatusCount: 1, DocCount: 2, FavoriteSum: 20, RetweetSum: 0},
+		{Hour: time.Date(2020, 8, 3, 3, 0, 0, 0, time.UTC), StatusCount: 1, DocCount: 1, FavoriteSum: 1, RetweetSum: 1},
+	}
+	h := NewTweetHeatmap(counts, jst)
+	if h.StatusCount[time.Sunday][0] != 3 {
+		t.Errorf("StatusCount[Sunday][0] = %d, want 3", h.StatusCount[time.Sunday][0])
+	}
+	if h.FavoriteAvg[time.Sunday][0] != 7.5 || h.RetweetAvg[time.Sunday][0] != 1 {
+		t.Errorf("averages = %v, %v, want 7.5, 1", h.FavoriteAvg[time.Sunday][0], h.RetweetAvg[time.Sunday][0])
+	}
+	if h.StatusCount[time.Monday][12] != 1 {
+		t.Errorf("StatusCount[Monday][12] = %d, want 1", h.StatusCount[time.Monday][12])
+	}
+	if h.StatusCount[time.Saturday][15] != 0 {
+		t.Errorf("counted in UTC")
+	}
+}
+
+func TestCompareTweetStats(t *testing.T) {
+	current := &TweetStats{StatusCount: 30, Favorite: TweetMetricStats{Avg: 10}, Retweet: TweetMetricStats{Avg: 2}}
+	current.SetFollowerCount(100)
+	previous := &TweetStats{StatusCount: 20, Favorite: TweetMetricStats{Avg: 8}}
+	previous.SetFollowerCount(0)
+
+	if current.EngagementRate != 0.12 {
+		t.Errorf("EngagementRate = %v, want 0.12", current.EngagementRate)
+	}
+	c := CompareTweetStats(current, previous)
+	if c.Change.StatusCount == nil || *c.Change.StatusCount != 0.5 {
+		t.Errorf("StatusCount change = %v, want 0.5", c.Change.StatusCount)
+	}
+	if c.Change.FavoriteAvg == nil || *c.Change.FavoriteAvg != 0.25 {
+		t.Errorf("FavoriteAvg change = %v, want 0.25", c.Change.FavoriteAvg)
+	}
+	if c.Change.RetweetAvg != nil || c.Change.EngagementRate != nil {
+		t.Errorf("changes from zero = %v, %v, want nil", c.Change.RetweetAvg, c.Change.EngagementRate)
+	}
+}
@@ -1,6 +1,14 @@
 package domain
 
-import "time"
+import (
+	"context"
+	"errors"
+	"sns-api/datetime"
+	"time"
+)
+
+// ErrUserNotFound is returned for a user who has no profile in the range of the request.
+var ErrUserNotFound = errors.New("user not found")
 
 type User struct {
 	UserID           string  `json:"user_id"`
@@ -18,8 +26,14 @@ type User struct {
 	CreatedAt        string  `json:"created_at"`
 }
 
+// Localize renders CreatedAt, which the repositories return in UTC, in loc.
+func (u *User) Localize(loc *time.Location) {
+	u.CreatedAt = datetime.Render(u.CreatedAt, loc)
+}
+
+// UserRepository hands the users of a search to each as soon as they are decoded, like TweetRepository.
 type UserRepository interface {
-	Search(name, description, language string, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax int, srScoreMin, srScoreMax float64, startDate, endDate time.Time, count int, orderBy string) ([]*User, int, error)
-	GetById(userID uint64, startDate, endDate time.Time) (*User, int, error)
-	GetByIds(userIDs []uint64, startDate, endDate time.Time) ([]*User, int, error)
+	Search(ctx context.Context, name, description, language string, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax int, srScoreMin, srScoreMax float64, startDate, endDate time.Time, count int, orderBy string, cursor *Cursor, each func(*User) error) (*Page, error)
+	GetById(ctx context.Context, userID uint64, startDate, endDate time.Time) (*User, *Page, error)
+	GetByIds(ctx context.Context, userIDs []uint64, startDate, endDate time.Time, each func(*User) error) (*Page, error)
 }
@@ -0,0 +1,11 @@
+package domain
+
+// Warning reports a document that did not match the expected schema.
+// The document is either returned with zero values in place of the offending
+// field or, when a required field is unusable, left out of the result.
+type Warning struct {
+	Index  string `json:"index"`
+	ID     string `json:"id"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
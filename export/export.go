@@ -0,0 +1,228 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats rows can be exported in. JSON is the regular response and is not streamed.
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+const (
+	MIMECSV    = "text/csv"
+	MIMENDJSON = "application/x-ndjson"
+)
+
+// bom is the UTF-8 byte order mark Excel needs to read a CSV file as UTF-8 rather than the
+// system code page, which garbles Japanese text.
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ContentType returns the content type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return MIMECSV + "; charset=utf-8"
+	case FormatNDJSON:
+		return MIMENDJSON
+	}
+	return "application/json; charset=utf-8"
+}
+
+// Encoder writes rows of one type one at a time.
+type Encoder interface {
+	Encode(row interface{}) error
+	// Flush writes out the rows still buffered.
+	Flush() error
+}
+
+// NewEncoder returns an encoder of the rows of the same type as row, which may be a nil pointer.
+// A CSV encoder writes the byte order mark, when asked to, and the header right away.
+func NewEncoder(w io.Writer, format string, row interface{}, withBOM bool) (Encoder, error) {
+	switch format {
+	case FormatCSV:
+		if withBOM {
+			if _, err := w.Write(bom); err != nil {
+				return nil, err
+			}
+		}
+		t := recordType(reflect.TypeOf(row))
+		cw := csv.NewWriter(w)
+		if err := cw.Write(Columns(t)); err != nil {
+			return nil, err
+		}
+		return &csvEncoder{w: cw, t: t}, nil
+	case FormatNDJSON:
+		return &ndjsonEncoder{e: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("cannot stream %s", format)
+}
+
+type ndjsonEncoder struct {
+	e *json.Encoder
+}
+
+func (n *ndjsonEncoder) Encode(row interface{}) error {
+	return n.e.Encode(row)
+}
+
+func (n *ndjsonEncoder) Flush() error {
+	return nil
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+	t reflect.Type
+}
+
+func (c *csvEncoder) Encode(row interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	if v.IsValid() && v.Type() != c.t {
+		return fmt.Errorf("cannot export %T with the columns of %s", row, c.t)
+	}
+	return c.w.Write(appendValues(nil, v, c.t))
+}
+
+func (c *csvEncoder) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Columns returns the CSV header of a struct type: its JSON field names in declaration order.
+// Nested structs and slices of structs are flattened into parent.child columns, and the values
+// of the elements of a slice are joined by spaces in one column.
+func Columns(t reflect.Type) []string {
+	return appendColumns(nil, "", recordType(t))
+}
+
+func appendColumns(dst []string, prefix string, t reflect.Type) []string {
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := fieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+		ft := t.Field(i).Type
+		if r := recordType(ft); r != nil {
+			dst = appendColumns(dst, prefix+name+".", r)
+			continue
+		}
+		if ft.Kind() == reflect.Slice {
+			if r := recordType(ft.Elem()); r != nil {
+				dst = appendColumns(dst, prefix+name+".", r)
+				continue
+			}
+		}
+		dst = append(dst, prefix+name)
+	}
+	return dst
+}
+
+// appendValues appends the columns of v, which is invalid for a nil record.
+func appendValues(dst []string, v reflect.Value, t reflect.Type) []string {
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := fieldName(t.Field(i)); !ok {
+			continue
+		}
+		ft := t.Field(i).Type
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = reflect.Indirect(v.Field(i))
+		}
+		if r := recordType(ft); r != nil {
+			dst = appendValues(dst, fv, r)
+			continue
+		}
+		if ft.Kind() == reflect.Slice {
+			var elems [][]string
+			r := recordType(ft.Elem())
+			for j := 0; fv.IsValid() && j < fv.Len(); j++ {
+				ev := reflect.Indirect(fv.Index(j))
+				if r != nil {
+					elems = append(elems, appendValues(nil, ev, r))
+				} else {
+					elems = append(elems, []string{formatValue(ev)})
+				}
+			}
+			n := 1
+			if r != nil {
+				n = len(appendColumns(nil, "", r))
+			}
+			for k := 0; k < n; k++ {
+				var joined []string
+				for _, e := range elems {
+					joined = append(joined, e[k])
+				}
+				dst = append(dst, strings.Join(joined, " "))
+			}
+			continue
+		}
+		dst = append(dst, formatValue(fv))
+	}
+	return dst
+}
+
+// recordType returns the struct t is or points to, or nil when t is no record.
+// Times are values rather than records.
+func recordType(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return nil
+	}
+	return t
+}
+
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := strings.Split(f.Tag.Get("json"), ",")[0]
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	}
+	return tag, true
+}
+
+func formatValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,70 @@
+package export
+
+import (
+	"bytes"
+	"reflect"
+	"sns-api/domain"
+	"testing"
+)
+
+func TestColumns(t *testing.T) {
+	want := []string{"user_id", "user_screen_name", "user_name", "tweet_id", "text", "quote_count", "favorite_count",
+		"retweet_count", "reply_count", "created_at", "nested_url.canonical_url", "nested_url.domain"}
+	if got := Columns(reflect.TypeOf(&domain.Tweet{})); !reflect.DeepEqual(got, want) {
+		t.Errorf("Columns() = %v, want %v", got, want)
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	tweets := []*domain.Tweet{
+		{UserID: "1", UserName: "東京", TweetID: "10", Text: "こんにちは, \"世界\"", FavoriteCount: 3, NestedURL: []*domain.TweetNestedURL{
+			{CanonicalURL: "https://example.com/a", Domain: "example.com"},
+			{CanonicalURL: "https://example.jp/b", Domain: "example.jp"},
+		}},
+		{UserID: "2", TweetID: "11", RetweetCount: 1.5},
+	}
+	tests := []struct {
+		name    string
+		format  string
+		withBOM bool
+		want    string
+	}{
+		{
+			name:    "CSV",
+			format:  FormatCSV,
+			withBOM: true,
+			want: "\xef\xbb\xbfuser_id,user_screen_name,user_name,tweet_id,text,quote_count,favorite_count,retweet_count,reply_count,created_at,nested_url.canonical_url,nested_url.domain\n" +
+				"1,,東京,10,\"こんにちは, \"\"世界\"\"\",0,3,0,0,,https://example.com/a https://example.jp/b,example.com example.jp\n" +
+				"2,,,11,,0,0,1.5,0,,,\n",
+		},
+		{
+			name:   "NDJSON",
+			format: FormatNDJSON,
+			want: `{"user_id":"1","user_screen_name":"","user_name":"東京","tweet_id":"10","text":"こんにちは, \"世界\"","quote_count":0,"favorite_count":3,"retweet_count":0,"reply_count":0,"created_at":"","nested_url":[{"canonical_url":"https://example.com/a","domain":"example.com"},{"canonical_url":"https://example.jp/b","domain":"example.jp"}]}` + "\n" +
+				`{"user_id":"2","user_screen_name":"","user_name":"","tweet_id":"11","text":"","quote_count":0,"favorite_count":0,"retweet_count":1.5,"reply_count":0,"created_at":"","nested_url":null}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, err := NewEncoder(&buf, tt.format, (*domain.Tweet)(nil), tt.withBOM)
+			if err != nil {
+				t.Fatalf("NewEncoder() error = %v", err)
+			}
+			for _, tweet := range tweets {
+				if err := enc.Encode(tweet); err != nil {
+					t.Fatalf("Encode() error = %v", err)
+				}
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("NewEncoder() wrote %s, want %s", buf.String(), tt.want)
+			}
+		})
+	}
+	if _, err := NewEncoder(&bytes.Buffer{}, FormatJSON, (*domain.Tweet)(nil), false); err == nil {
+		t.Errorf("NewEncoder() streams JSON")
+	}
+}
@@ -0,0 +1,95 @@
+package apikey
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sns-api/domain"
+	"sns-api/handler"
+	"sns-api/logger"
+	"sns-api/usecase"
+)
+
+type Handler interface {
+	List(c *gin.Context)
+	Create(c *gin.Context)
+	Rotate(c *gin.Context)
+	Revoke(c *gin.Context)
+}
+
+type apiKeyHandler struct {
+	l             logger.Logging
+	apiKeyUseCase usecase.APIKeyUseCase
+}
+
+func NewAPIKeyHandler(l logger.Logging, au usecase.APIKeyUseCase) Handler {
+	return &apiKeyHandler{
+		l:             l,
+		apiKeyUseCase: au,
+	}
+}
+
+func (ah *apiKeyHandler) List(c *gin.Context) {
+	keys, err := ah.apiKeyUseCase.List(c.Request.Context())
+	if err != nil {
+		ah.l.Errorf(fmt.Sprintf("failed to List: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	res := make([]*Key, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, newKey(k))
+	}
+	c.JSON(http.StatusOK, &Response{
+		Hits: len(res),
+		Res:  res,
+	})
+}
+
+func (ah *apiKeyHandler) Create(c *gin.Context) {
+	var q CreateForm
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	key, token, err := ah.apiKeyUseCase.Create(c.Request.Context(), q.Name, q.Scopes)
+	if err != nil {
+		ah.l.Errorf(fmt.Sprintf("failed to Create: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	c.JSON(http.StatusCreated, &TokenResponse{
+		Key:   newKey(key),
+		Token: token,
+	})
+}
+
+func (ah *apiKeyHandler) Rotate(c *gin.Context) {
+	key, token, err := ah.apiKeyUseCase.Rotate(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		ah.l.Errorf(fmt.Sprintf("failed to Rotate: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(statusOf(err))
+		return
+	}
+	c.JSON(http.StatusOK, &TokenResponse{
+		Key:   newKey(key),
+		Token: token,
+	})
+}
+
+func (ah *apiKeyHandler) Revoke(c *gin.Context) {
+	if err := ah.apiKeyUseCase.Revoke(c.Request.Context(), c.Param("id")); err != nil {
+		ah.l.Errorf(fmt.Sprintf("failed to Revoke: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(statusOf(err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func statusOf(err error) int {
+	if errors.Is(err, domain.ErrAPIKeyNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusServiceUnavailable
+}
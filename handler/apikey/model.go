@@ -0,0 +1,43 @@
+package apikey
+
+import (
+	"sns-api/domain"
+	"time"
+)
+
+type CreateForm struct {
+	Name   string   `json:"name" form:"name" binding:"required,max=255"`
+	Scopes []string `json:"scopes" form:"scopes" binding:"required,min=1,dive,oneof=tweets:read users:read hashtags:read admin"`
+}
+
+// Key is an api key as shown to administrators, without the secret hash.
+type Key struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type Response struct {
+	Hits int         `json:"hits"`
+	Res  interface{} `json:"res"`
+}
+
+// TokenResponse carries a freshly issued token; it is the only time the token is returned.
+type TokenResponse struct {
+	Key   *Key   `json:"key"`
+	Token string `json:"token"`
+}
+
+func newKey(k *domain.APIKey) *Key {
+	return &Key{
+		ID:        k.ID,
+		Name:      k.Name,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt,
+		RotatedAt: k.RotatedAt,
+		RevokedAt: k.RevokedAt,
+	}
+}
@@ -0,0 +1,5 @@
+package handler
+
+// DefaultCount is the count of the list routes that do not default to one of their own.
+// The rate limiter estimates the cost of requests without a count from the same defaults.
+const DefaultCount = 10
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Code tells clients what kind of failure an error response reports, independently of its message.
+type Code string
+
+const (
+	CodeInvalidParameter Code = "invalid_parameter"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeConflict         Code = "conflict"
+	CodeRateLimited      Code = "rate_limited"
+	CodeInternal         Code = "internal"
+	// CodeBackendUnavailable reports that Elasticsearch, the corpus database or the export workers
+	// could not answer; the same request may succeed later.
+	CodeBackendUnavailable Code = "backend_unavailable"
+	CodeTimeout            Code = "timeout"
+)
+
+// codes are the codes of the statuses handlers record errors with.
+var codes = map[int]Code{
+	http.StatusBadRequest:          CodeInvalidParameter,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusConflict:            CodeConflict,
+	http.StatusTooManyRequests:     CodeRateLimited,
+	http.StatusInternalServerError: CodeInternal,
+	http.StatusBadGateway:          CodeBackendUnavailable,
+	http.StatusServiceUnavailable:  CodeBackendUnavailable,
+	http.StatusGatewayTimeout:      CodeTimeout,
+}
+
+// Error is the body of every error response, under the error key.
+type Error struct {
+	Status    int           `json:"-"`
+	Code      Code          `json:"code"`
+	Message   string        `json:"message"`
+	Fields    []*FieldError `json:"fields,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// FieldError reports one invalid parameter by the name the request gives it.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// NewError returns the Error of err, which a handler recorded with status.
+// The invalid parameters of a ValidationError are reported field by field.
+func NewError(status int, err error) *Error {
+	code, ok := codes[status]
+	if !ok {
+		status, code = http.StatusInternalServerError, CodeInternal
+	}
+	e := &Error{
+		Status:  status,
+		Code:    code,
+		Message: err.Error(),
+	}
+	var v *ValidationError
+	if errors.As(err, &v) {
+		e.Fields = v.Fields
+	}
+	return e
+}
+
+// ValidationError is a request with invalid parameters.
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+// InvalidParameter returns the ValidationError of the one parameter field.
+func InvalidParameter(field string, err error) error {
+	return &ValidationError{Fields: []*FieldError{{Field: field, Message: err.Error()}}}
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = fmt.Sprintf("%s: %s", f.Field, f.Message)
+	}
+	return "invalid parameters: " + strings.Join(messages, ", ")
+}
+
+// Bind binds the request to the form obj. A request that does not bind fails with 400 and
+// every invalid parameter, and Bind returns false.
+func Bind(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBind(obj); err != nil {
+		c.Error(bindError(obj, err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// bindError names the parameters of obj err is about, or returns err when it does not say.
+func bindError(obj interface{}, err error) error {
+	var fields []*FieldError
+	switch e := err.(type) {
+	case validator.ValidationErrors:
+		for _, fe := range e {
+			fields = append(fields, &FieldError{
+				Field:   parameterName(obj, fe.StructNamespace()),
+				Message: validationMessage(obj, fe),
+			})
+		}
+	case *json.UnmarshalTypeError:
+		fields = append(fields, &FieldError{
+			Field:   e.Field,
+			Message: fmt.Sprintf("must be %s, not %s", e.Type, e.Value),
+		})
+	default:
+		return err
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// parameterName returns the form name of the field at namespace, Form.Embedded.Field as the
+// validator reports it, or the field name when it has none.
+func parameterName(obj interface{}, namespace string) string {
+	parts := strings.Split(namespace, ".")
+	name := parts[len(parts)-1]
+	t := reflect.TypeOf(obj)
+	for _, part := range parts[1:] {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return name
+		}
+		// elements of slices are reported as Field[0]
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			part = part[:i]
+		}
+		f, ok := t.FieldByName(part)
+		if !ok {
+			return name
+		}
+		name = tagName(f)
+		t = f.Type
+	}
+	return name
+}
+
+func tagName(f reflect.StructField) string {
+	for _, key := range []string{"form", "json"} {
+		if tag := strings.Split(f.Tag.Get(key), ",")[0]; tag != "" && tag != "-" {
+			return tag
+		}
+	}
+	return f.Name
+}
+
+// validationMessage describes the rule fe failed. Rules comparing with another field name it
+// by its parameter name.
+func validationMessage(obj interface{}, fe validator.FieldError) string {
+	param := fe.Param()
+	if strings.HasSuffix(fe.Tag(), "field") || strings.HasPrefix(fe.Tag(), "required_with") {
+		ns := fe.StructNamespace()
+		param = parameterName(obj, ns[:strings.LastIndexByte(ns, '.')+1]+param)
+	}
+	// lengths are limited by the same rules as numbers
+	unit := ""
+	switch fe.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " elements"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return fmt.Sprintf("is required without %s", param)
+	case "min", "gte":
+		if unit != "" {
+			return fmt.Sprintf("must have at least %s%s", param, unit)
+		}
+		return fmt.Sprintf("must be at least %s", param)
+	case "max", "lte":
+		if unit != "" {
+			return fmt.Sprintf("must have at most %s%s", param, unit)
+		}
+		return fmt.Sprintf("must be at most %s", param)
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", param)
+	case "lt":
+		return fmt.Sprintf("must be less than %s", param)
+	case "gtefield":
+		return fmt.Sprintf("must not be less than %s", param)
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(param), ", "))
+	}
+	if param != "" {
+		return fmt.Sprintf("must satisfy %s=%s", fe.Tag(), param)
+	}
+	return fmt.Sprintf("must satisfy %s", fe.Tag())
+}
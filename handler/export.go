@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"net/http"
+	"sns-api/domain"
+	"sns-api/export"
+	"sns-api/logger"
+	"strconv"
+)
+
+// ExportFormat returns the format named by the format parameter or, without one, the one
+// the Accept header prefers. JSON is the default.
+func ExportFormat(c *gin.Context) (string, error) {
+	if format := c.Query("format"); format != "" {
+		switch format {
+		case export.FormatJSON, export.FormatCSV, export.FormatNDJSON:
+			return format, nil
+		}
+		return "", InvalidParameter("format", errors.New("must be one of json, csv, ndjson"))
+	}
+	switch c.NegotiateFormat(binding.MIMEJSON, export.MIMECSV, export.MIMENDJSON) {
+	case export.MIMECSV:
+		return export.FormatCSV, nil
+	case export.MIMENDJSON:
+		return export.FormatNDJSON, nil
+	}
+	return export.FormatJSON, nil
+}
+
+const (
+	nextCursorHeader  = "X-Next-Cursor"
+	exportErrorHeader = "X-Export-Error"
+)
+
+// ExportRows answers a list request in format, which is not JSON, by an attachment named after
+// name of rows of the type of row, which may be a nil pointer. fetch reads the page, handing every
+// row to write as it is decoded, and op names it in the log. A failure of fetch is answered like
+// any backend error before the first row and reported in the X-Export-Error trailer after it.
+func ExportRows(c *gin.Context, l logger.Logging, op, format, name string, row interface{}, fetch func(write func(row interface{}) error) (*domain.Page, error)) {
+	ew := newExportWriter(c, format, name, row)
+	page, err := fetch(ew.Write)
+	if err != nil {
+		l.Errorf(fmt.Sprintf("failed to %s: %v", op, err))
+		ew.Fail(err, http.StatusServiceUnavailable)
+		return
+	}
+	if err := ew.Close(domain.EncodeCursor(page.NextCursor)); err != nil {
+		l.Errorf(fmt.Sprintf("failed to export: %v", err))
+	}
+}
+
+// exportWriter streams the rows of an export to the client as the repository decodes them,
+// flushing every row. The response only starts with the first row, so that a search failing
+// before it is still answered by an error response.
+type exportWriter struct {
+	c      *gin.Context
+	format string
+	name   string
+	row    interface{}
+	// started is set once the headers are sent
+	started bool
+	enc     export.Encoder
+}
+
+// newExportWriter returns the writer of an attachment named after name, of rows of the type of
+// row, which may be a nil pointer.
+func newExportWriter(c *gin.Context, format, name string, row interface{}) *exportWriter {
+	return &exportWriter{c: c, format: format, name: name, row: row}
+}
+
+// Write sends row to the client.
+func (w *exportWriter) Write(row interface{}) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if err := w.enc.Encode(row); err != nil {
+		return err
+	}
+	if err := w.enc.Flush(); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+// Close ends an export that succeeded. The cursor of the next page is only known after the
+// last row, so it is sent in the X-Next-Cursor trailer.
+func (w *exportWriter) Close(nextCursor string) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if nextCursor != "" {
+		w.c.Writer.Header().Set(nextCursorHeader, nextCursor)
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+// Fail ends an export that failed. Before the first row err is recorded with status like any
+// handler error; rows already sent cannot be taken back, so it is then reported in the
+// X-Export-Error trailer instead.
+func (w *exportWriter) Fail(err error, status int) {
+	if !w.started {
+		w.c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(status)
+		return
+	}
+	w.c.Writer.Header().Set(exportErrorHeader, err.Error())
+	w.c.Writer.Flush()
+}
+
+// start sends the headers and, for a CSV, the byte order mark when bom=true and the header row.
+func (w *exportWriter) start() error {
+	if w.started {
+		if w.enc == nil {
+			return errors.New("export did not start")
+		}
+		return nil
+	}
+	w.started = true
+	withBOM, _ := strconv.ParseBool(w.c.Query("bom"))
+	w.c.Header("Content-Type", export.ContentType(w.format))
+	w.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, w.name, w.format))
+	w.c.Header("Trailer", nextCursorHeader+", "+exportErrorHeader)
+	w.c.Status(http.StatusOK)
+	enc, err := export.NewEncoder(w.c.Writer, w.format, w.row, withBOM)
+	if err != nil {
+		return err
+	}
+	w.enc = enc
+	return nil
+}
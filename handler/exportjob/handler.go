@@ -0,0 +1,123 @@
+package exportjob
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sns-api/datetime"
+	"sns-api/domain"
+	"sns-api/handler"
+	"sns-api/logger"
+	"sns-api/usecase"
+	"strings"
+)
+
+type Handler interface {
+	Tweets(c *gin.Context)
+	Hashtags(c *gin.Context)
+	Get(c *gin.Context)
+	Download(c *gin.Context)
+}
+
+type exportHandler struct {
+	l             logger.Logging
+	exportUseCase usecase.ExportUseCase
+}
+
+func NewExportHandler(l logger.Logging, eu usecase.ExportUseCase) Handler {
+	return &exportHandler{
+		l:             l,
+		exportUseCase: eu,
+	}
+}
+
+func (eh *exportHandler) Tweets(c *gin.Context) {
+	var q TweetsForm
+
+	q.OrderBy = c.DefaultQuery("order_by", "created_at")
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	// the job runs after the request, so it keeps the zone the request asked for
+	job, err := eh.exportUseCase.ExportTweets(c.Request.Context(), q.Format, q.BOM, &domain.ExportTweetsParams{
+		UserIDs:   q.UserIDs,
+		StartDate: startDate,
+		EndDate:   endDate,
+		OrderBy:   q.OrderBy,
+		Timezone:  datetime.LocationFromContext(c.Request.Context()).String(),
+	})
+	if err != nil {
+		eh.l.Errorf(fmt.Sprintf("failed to ExportTweets: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(statusOf(err))
+		return
+	}
+	eh.accepted(c, job)
+}
+
+func (eh *exportHandler) Hashtags(c *gin.Context) {
+	var q HashtagsForm
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	filter, err := q.Filter(c, q.Keyword, q.Hashtag)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	job, err := eh.exportUseCase.ExportHashtags(c.Request.Context(), q.Format, q.BOM, filter)
+	if err != nil {
+		eh.l.Errorf(fmt.Sprintf("failed to ExportHashtags: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(statusOf(err))
+		return
+	}
+	eh.accepted(c, job)
+}
+
+// accepted answers a queued job with 202 and where to poll it.
+func (eh *exportHandler) accepted(c *gin.Context, job *domain.ExportJob) {
+	c.Header("Location", strings.TrimSuffix(c.FullPath(), job.Kind)+job.ID)
+	c.JSON(http.StatusAccepted, &Response{
+		Hits: 1,
+		Res:  job,
+	})
+}
+
+func (eh *exportHandler) Get(c *gin.Context) {
+	job, err := eh.exportUseCase.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(statusOf(err))
+		return
+	}
+	c.JSON(http.StatusOK, &Response{
+		Hits: 1,
+		Res:  job,
+	})
+}
+
+func (eh *exportHandler) Download(c *gin.Context) {
+	job, path, err := eh.exportUseCase.File(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(statusOf(err))
+		return
+	}
+	c.FileAttachment(path, fmt.Sprintf("%s-%s.%s.gz", job.Kind, job.ID, job.Format))
+}
+
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrExportNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrExportNotReady):
+		return http.StatusConflict
+	}
+	// a full queue as well as a failing corpus database
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,29 @@
+package exportjob
+
+import (
+	"sns-api/handler/hashtag"
+)
+
+type Response struct {
+	Hits int         `json:"hits"`
+	Res  interface{} `json:"res"`
+}
+
+// TweetsForm takes the filters of tweet.UsersForm, without the paging.
+type TweetsForm struct {
+	UserIDs   []uint64 `json:"user_ids" form:"user_ids" binding:"required,max=10000"`
+	StartDate string   `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string   `json:"end_date" form:"end_date" binding:"required"`
+	OrderBy   string   `json:"order_by" form:"order_by" binding:"omitempty,oneof=retweet_count quote_count favorite_count created_at inserted_at"`
+	Format    string   `json:"format" form:"format" binding:"required,oneof=csv ndjson"`
+	BOM       bool     `json:"bom" form:"bom"`
+}
+
+// HashtagsForm takes the filters of hashtag.Form, without the paging.
+type HashtagsForm struct {
+	Keyword string   `json:"keyword" form:"keyword" binding:"required_without=Hashtag"`
+	Hashtag []string `json:"hashtag" form:"hashtag" binding:"required_without=Keyword"`
+	hashtag.FilterForm
+	Format string `json:"format" form:"format" binding:"required,oneof=csv ndjson"`
+	BOM    bool   `json:"bom" form:"bom"`
+}
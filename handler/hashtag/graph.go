@@ -0,0 +1,188 @@
+package hashtag
+
+import (
+	"encoding/xml"
+	"sns-api/domain"
+	"strconv"
+)
+
+// graphFormats are the content types and file extensions of the graph exports besides JSON.
+var graphFormats = map[string]struct {
+	contentType string
+	extension   string
+	encode      func(g *domain.HashtagGraph) ([]byte, error)
+}{
+	"graphml": {"application/graphml+xml; charset=utf-8", "graphml", encodeGraphML},
+	"gexf":    {"application/gexf+xml; charset=utf-8", "gexf", encodeGEXF},
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func encodeGraphML(g *domain.HashtagGraph) ([]byte, error) {
+	doc := graphML{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "status_count", For: "node", Name: "status_count", Type: "long"},
+			{ID: "hop", For: "node", Name: "hop", Type: "int"},
+			{ID: "weight", For: "edge", Name: "weight", Type: "long"},
+			{ID: "lift", For: "edge", Name: "lift", Type: "double"},
+			{ID: "pmi", For: "edge", Name: "pmi", Type: "double"},
+		},
+		Graph: graphMLGraph{ID: "cooccurrence", EdgeDefault: "undirected"},
+	}
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: n.Hashtag,
+			Data: []graphMLData{
+				{Key: "status_count", Value: strconv.FormatUint(n.StatusCount, 10)},
+				{Key: "hop", Value: strconv.Itoa(n.Hop)},
+			},
+		})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: e.Source,
+			Target: e.Target,
+			Data: []graphMLData{
+				{Key: "weight", Value: strconv.FormatUint(e.Count, 10)},
+				{Key: "lift", Value: formatFloat(e.Lift)},
+				{Key: "pmi", Value: formatFloat(e.PMI)},
+			},
+		})
+	}
+	return marshalXML(doc)
+}
+
+type gexf struct {
+	XMLName xml.Name  `xml:"gexf"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Weight    uint64         `xml:"weight,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+func encodeGEXF(g *domain.HashtagGraph) ([]byte, error) {
+	doc := gexf{
+		Xmlns:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Graph: gexfGraph{
+			DefaultEdgeType: "undirected",
+			Attributes: []gexfAttributes{
+				{Class: "node", Attributes: []gexfAttribute{
+					{ID: "status_count", Title: "status_count", Type: "long"},
+					{ID: "hop", Title: "hop", Type: "integer"},
+				}},
+				{Class: "edge", Attributes: []gexfAttribute{
+					{ID: "lift", Title: "lift", Type: "double"},
+					{ID: "pmi", Title: "pmi", Type: "double"},
+				}},
+			},
+		},
+	}
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{
+			ID:    n.Hashtag,
+			Label: n.Hashtag,
+			AttValues: []gexfAttValue{
+				{For: "status_count", Value: strconv.FormatUint(n.StatusCount, 10)},
+				{For: "hop", Value: strconv.Itoa(n.Hop)},
+			},
+		})
+	}
+	for i, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:     strconv.Itoa(i),
+			Source: e.Source,
+			Target: e.Target,
+			Weight: e.Count,
+			AttValues: []gexfAttValue{
+				{For: "lift", Value: formatFloat(e.Lift)},
+				{For: "pmi", Value: formatFloat(e.PMI)},
+			},
+		})
+	}
+	return marshalXML(doc)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
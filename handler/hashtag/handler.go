@@ -4,16 +4,24 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 	"net/http"
+	"sns-api/domain"
+	"sns-api/export"
+	"sns-api/handler"
 	"sns-api/logger"
 	"sns-api/usecase"
 	"strconv"
+	"time"
 )
 
 type Handler interface {
 	Get(c *gin.Context)
 	Search(c *gin.Context)
+	Timeseries(c *gin.Context)
+	Trending(c *gin.Context)
+	Cooccurrence(c *gin.Context)
+	Contributors(c *gin.Context)
+	Suggest(c *gin.Context)
 }
 
 type hashtagHandler struct {
@@ -30,61 +38,259 @@ func NewHashtagHandler(l logger.Logging, hu usecase.HashtagUseCase) Handler {
 
 func (hh *hashtagHandler) Get(c *gin.Context) {
 	var q Form
-	q.Count, _ = strconv.Atoi(c.DefaultQuery(string(q.Count), "1000"))
-	q.RetweetMin, _ = strconv.Atoi(c.DefaultQuery(string(q.RetweetMin), "0"))
-	q.QuoteMin, _ = strconv.Atoi(c.DefaultQuery(string(q.QuoteMin), "0"))
-	q.FavoriteMin, _ = strconv.Atoi(c.DefaultQuery(string(q.FavoriteMin), "0"))
-
-	if err := c.ShouldBind(&q); err != nil {
-		switch e := err.(type) {
-		case validator.FieldError:
-			for _, fieldErr := range err.(validator.ValidationErrors) {
-				c.Error(errors.New(fmt.Sprint(fieldErr))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-				return
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(DefaultRankingCount)))
+	q.RetweetMin, _ = strconv.Atoi(c.DefaultQuery("retweet_min", "0"))
+	q.QuoteMin, _ = strconv.Atoi(c.DefaultQuery("quote_min", "0"))
+	q.FavoriteMin, _ = strconv.Atoi(c.DefaultQuery("favorite_min", "0"))
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	format, err := handler.ExportFormat(c)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	cursor, err := domain.DecodeCursor(q.Cursor)
+	if err != nil {
+		c.Error(handler.InvalidParameter("cursor", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	filter, err := q.Filter(c, q.Keyword, q.Hashtag)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if format != export.FormatJSON {
+		handler.ExportRows(c, hh.l, "Get", format, "hashtags", (*domain.Hashtag)(nil), func(write func(interface{}) error) (*domain.Page, error) {
+			// hashtags are the buckets of an aggregation, which the backend returns in one piece
+			hashtags, page, err := hh.hashtagUseCase.Get(c.Request.Context(), filter, q.Count, cursor)
+			if err != nil {
+				return nil, err
 			}
-		default:
-			c.Error(e).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-			return
-		}
+			for _, hashtag := range hashtags {
+				if err := write(hashtag); err != nil {
+					return nil, err
+				}
+			}
+			return page, nil
+		})
+		return
 	}
-	hashtags, hits, err := hh.hashtagUseCase.Get(q.Keyword, q.Hashtag, q.TweetType, q.RetweetMin, q.RetweetMax, q.QuoteMin, q.QuoteMax, q.FavoriteMin, q.FavoriteMax, q.UserInclude, q.UserExclude, q.HashtagInclude, q.HashtagExclude, q.UserFollowerMin, q.UserFollowerMax, q.UserStatusMin, q.UserStatusMax, q.Count, q.StartDate, q.EndDate)
+	hashtags, page, err := hh.hashtagUseCase.Get(c.Request.Context(), filter, q.Count, cursor)
 	if err != nil {
 		hh.l.Errorf(fmt.Sprintf("failed to Get: %v", err))
-		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNoContent)
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	r := &Response{
-		Hits: hits,
-		Res:  hashtags,
+		Hits:       page.Hits,
+		Res:        hashtags,
+		NextCursor: domain.EncodeCursor(page.NextCursor),
 	}
 	c.JSON(http.StatusOK, r)
 }
 
 func (hh *hashtagHandler) Search(c *gin.Context) {
 	var q SearchForm
-	q.Count, _ = strconv.Atoi(c.DefaultQuery(string(q.Count), "10"))
-
-	if err := c.ShouldBind(&q); err != nil {
-		switch e := err.(type) {
-		case validator.FieldError:
-			for _, fieldErr := range err.(validator.ValidationErrors) {
-				c.Error(errors.New(fmt.Sprint(fieldErr))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-				return
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(handler.DefaultCount)))
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	format, err := handler.ExportFormat(c)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	cursor, err := domain.DecodeCursor(q.Cursor)
+	if err != nil {
+		c.Error(handler.InvalidParameter("cursor", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if format != export.FormatJSON {
+		handler.ExportRows(c, hh.l, "Search", format, "hashtags", (*domain.HashtagBySearch)(nil), func(write func(interface{}) error) (*domain.Page, error) {
+			// hashtags are the buckets of an aggregation, which the backend returns in one piece
+			hashtags, page, err := hh.hashtagUseCase.Search(c.Request.Context(), q.Hashtag, startDate, endDate, q.Count, cursor)
+			if err != nil {
+				return nil, err
+			}
+			for _, hashtag := range hashtags {
+				if err := write(hashtag); err != nil {
+					return nil, err
+				}
 			}
-		default:
-			c.Error(e).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+			return page, nil
+		})
+		return
+	}
+	hashtags, page, err := hh.hashtagUseCase.Search(c.Request.Context(), q.Hashtag, startDate, endDate, q.Count, cursor)
+	if err != nil {
+		hh.l.Errorf(fmt.Sprintf("failed to Search: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	r := &Response{
+		Hits:       page.Hits,
+		Res:        hashtags,
+		NextCursor: domain.EncodeCursor(page.NextCursor),
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (hh *hashtagHandler) Timeseries(c *gin.Context) {
+	var q TimeseriesForm
+	q.Interval = c.DefaultQuery("interval", string(domain.HashtagIntervalDay))
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	filter, err := q.Filter(c, q.Keyword, nil)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	series, err := hh.hashtagUseCase.Timeseries(c.Request.Context(), q.Hashtag, filter, domain.HashtagInterval(q.Interval))
+	if errors.Is(err, domain.ErrTooManyBuckets) {
+		c.Error(handler.InvalidParameter("end_date", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		hh.l.Errorf(fmt.Sprintf("failed to Timeseries: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	r := &Response{
+		Hits: len(series),
+		Res:  series,
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (hh *hashtagHandler) Trending(c *gin.Context) {
+	var q TrendingForm
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(handler.DefaultCount)))
+	q.MinCount, _ = strconv.Atoi(c.DefaultQuery("min_count", "10"))
+	q.Window, _ = time.ParseDuration(c.DefaultQuery("window", "24h"))
+	q.Baseline, _ = time.ParseDuration(c.DefaultQuery("baseline", "168h"))
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	if err := q.validate(); err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	baselineStart, targetStart, end, err := q.windows(c, time.Now())
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	trends, err := hh.hashtagUseCase.Trending(c.Request.Context(), q.filter(q.Keyword, nil, baselineStart, end), targetStart, q.MinCount, q.Count)
+	if err != nil {
+		hh.l.Errorf(fmt.Sprintf("failed to Trending: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	r := &Response{
+		Hits: len(trends),
+		Res:  trends,
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (hh *hashtagHandler) Cooccurrence(c *gin.Context) {
+	var q CooccurrenceForm
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(DefaultCooccurrenceCount)))
+	q.Hops, _ = strconv.Atoi(c.DefaultQuery("hops", "1"))
+	q.MinCount, _ = strconv.Atoi(c.DefaultQuery("min_count", "1"))
+	q.Format = c.DefaultQuery("format", "json")
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	filter, err := q.Filter(c, q.Keyword, nil)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	graph, err := hh.hashtagUseCase.Cooccurrence(c.Request.Context(), q.Hashtag, filter, q.Count, q.Hops, q.MinCount)
+	if errors.Is(err, domain.ErrTooManyBuckets) {
+		c.Error(handler.InvalidParameter("count", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		hh.l.Errorf(fmt.Sprintf("failed to Cooccurrence: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	if f, ok := graphFormats[q.Format]; ok {
+		b, err := f.encode(graph)
+		if err != nil {
+			hh.l.Errorf(fmt.Sprintf("failed to encode %s: %v", q.Format, err))
+			c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusInternalServerError)
 			return
 		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"cooccurrence.%s\"", f.extension))
+		c.Data(http.StatusOK, f.contentType, b)
+		return
 	}
-	hashtags, hits, err := hh.hashtagUseCase.Search(q.Hashtag, q.StartDate, q.EndDate, q.Count)
+	r := &Response{
+		Hits: len(graph.Edges),
+		Res:  graph,
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (hh *hashtagHandler) Contributors(c *gin.Context) {
+	var q ContributorsForm
+	q.Hashtag = c.Param("hashtag")
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(handler.DefaultCount)))
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	filter, err := q.Filter(c, q.Keyword, nil)
 	if err != nil {
-		hh.l.Errorf(fmt.Sprintf("failed to Search: %v", err))
-		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNoContent)
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	contributors, err := hh.hashtagUseCase.Contributors(c.Request.Context(), q.Hashtag, filter, q.Count)
+	if err != nil {
+		hh.l.Errorf(fmt.Sprintf("failed to Contributors: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	r := &Response{
+		Hits: int(contributors.StatusCount),
+		Res:  contributors,
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (hh *hashtagHandler) Suggest(c *gin.Context) {
+	var q SuggestForm
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(handler.DefaultCount)))
+	q.Days, _ = strconv.Atoi(c.DefaultQuery("days", "7"))
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	startDate, endDate := q.window(time.Now())
+	suggestions, err := hh.hashtagUseCase.Suggest(c.Request.Context(), q.Prefix, startDate, endDate, q.Count)
+	if err != nil {
+		hh.l.Errorf(fmt.Sprintf("failed to Suggest: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	r := &Response{
-		Hits: hits,
-		Res:  hashtags,
+		Hits: len(suggestions),
+		Res:  suggestions,
 	}
 	c.JSON(http.StatusOK, r)
 }
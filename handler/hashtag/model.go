@@ -1,38 +1,180 @@
 package hashtag
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"sns-api/domain"
+	"sns-api/handler"
+	"time"
+)
 
 type Response struct {
-	Hits int         `json:"hits"`
-	Res  interface{} `json:"res"`
+	Hits       int         `json:"hits"`
+	Res        interface{} `json:"res"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// TweetFilterForm selects the tweets hashtag statistics are computed over.
+type TweetFilterForm struct {
+	TweetType       []int    `json:"tweet_type" form:"tweet_type" binding:"omitempty"`
+	RetweetMin      int      `json:"retweet_min" form:"retweet_min" binding:"omitempty"`
+	RetweetMax      int      `json:"retweet_max" form:"retweet_max" binding:"omitempty,gtefield=RetweetMin"`
+	QuoteMin        int      `json:"quote_min" form:"quote_min" binding:"omitempty"`
+	QuoteMax        int      `json:"quote_max" form:"quote_max" binding:"omitempty,gtefield=QuoteMin"`
+	FavoriteMin     int      `json:"favorite_min" form:"favorite_min" binding:"omitempty"`
+	FavoriteMax     int      `json:"favorite_max" form:"favorite_max" binding:"omitempty,gtefield=FavoriteMin"`
+	UserInclude     []string `json:"user_include" form:"user_include" binding:"omitempty"`
+	UserExclude     []string `json:"user_exclude" form:"user_exclude" binding:"omitempty"`
+	HashtagInclude  []string `json:"hashtag_include" form:"hashtag_include" binding:"omitempty"`
+	HashtagExclude  []string `json:"hashtag_exclude" form:"hashtag_exclude" binding:"omitempty"`
+	UserFollowerMin int      `json:"user_follower_min" form:"user_follower_min" binding:"omitempty"`
+	UserFollowerMax int      `json:"user_follower_max" form:"user_follower_max" binding:"omitempty,gtefield=UserFollowerMin"`
+	UserStatusMin   int      `json:"user_status_min" form:"user_status_min" binding:"omitempty"`
+	UserStatusMax   int      `json:"user_status_max" form:"user_status_max" binding:"omitempty,gtefield=UserStatusMin"`
+}
+
+// filter converts the form to the domain filter over startDate to endDate.
+func (f *TweetFilterForm) filter(keyword string, hashtag []string, startDate, endDate time.Time) *domain.HashtagFilter {
+	return &domain.HashtagFilter{
+		Keyword:         keyword,
+		Hashtag:         hashtag,
+		TweetType:       f.TweetType,
+		RetweetMin:      f.RetweetMin,
+		RetweetMax:      f.RetweetMax,
+		QuoteMin:        f.QuoteMin,
+		QuoteMax:        f.QuoteMax,
+		FavoriteMin:     f.FavoriteMin,
+		FavoriteMax:     f.FavoriteMax,
+		UserInclude:     f.UserInclude,
+		UserExclude:     f.UserExclude,
+		HashtagInclude:  f.HashtagInclude,
+		HashtagExclude:  f.HashtagExclude,
+		UserFollowerMin: f.UserFollowerMin,
+		UserFollowerMax: f.UserFollowerMax,
+		UserStatusMin:   f.UserStatusMin,
+		UserStatusMax:   f.UserStatusMax,
+		StartDate:       startDate,
+		EndDate:         endDate,
+	}
+}
+
+// FilterForm is the tweet filter shared by the hashtag ranking and time series.
+type FilterForm struct {
+	TweetFilterForm
+	StartDate string `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" form:"end_date" binding:"required"`
+}
+
+// Filter converts the form to the domain filter of the tweets with keyword or one of hashtag,
+// reading the dates in the zone of the request. The export jobs build their filter with it too.
+func (f *FilterForm) Filter(c *gin.Context, keyword string, hashtag []string) (*domain.HashtagFilter, error) {
+	startDate, endDate, err := handler.ParseRange(c, f.StartDate, f.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	return f.TweetFilterForm.filter(keyword, hashtag, startDate, endDate), nil
 }
 
 type Form struct {
-	Keyword         string    `json:"keyword" form:"keyword" binding:"required_without=Hashtag"`
-	Hashtag         []string  `json:"hashtag" form:"hashtag" binding:"required_without=Keyword"`
-	TweetType       []int     `json:"tweet_type" form:"tweet_type" binding:"omitempty"`
-	RetweetMin      int       `json:"retweet_min" form:"retweet_min" binding:"omitempty"`
-	RetweetMax      int       `json:"retweet_max" form:"retweet_max" binding:"omitempty,gtefield=RetweetMin"`
-	QuoteMin        int       `json:"quote_min" form:"quote_min" binding:"omitempty"`
-	QuoteMax        int       `json:"quote_max" form:"quote_max" binding:"omitempty,gtefield=QuoteMin"`
-	FavoriteMin     int       `json:"favorite_min" form:"favorite_min" binding:"omitempty"`
-	FavoriteMax     int       `json:"favorite_max" form:"favorite_max" binding:"omitempty,gtefield=FavoriteMin"`
-	UserInclude     []string  `json:"user_include" form:"user_include" binding:"omitempty"`
-	UserExclude     []string  `json:"user_exclude" form:"user_exclude" binding:"omitempty"`
-	HashtagInclude  []string  `json:"hashtag_include" form:"hashtag_include" binding:"omitempty"`
-	HashtagExclude  []string  `json:"hashtag_exclude" form:"hashtag_exclude" binding:"omitempty"`
-	UserFollowerMin int       `json:"user_follower_min" form:"user_follower_min" binding:"omitempty"`
-	UserFollowerMax int       `json:"user_follower_max" form:"user_follower_max" binding:"omitempty,gtefield=UserFollowerMin"`
-	UserStatusMin   int       `json:"user_status_min" form:"user_status_min" binding:"omitempty"`
-	UserStatusMax   int       `json:"user_status_max" form:"user_status_max" binding:"omitempty,gtefield=UserStatusMin"`
-	Count           int       `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
-	StartDate       time.Time `json:"start_date" form:"start_date" binding:"required" time_format:"2006-01-02 15:04"`
-	EndDate         time.Time `json:"end_date" form:"end_date" binding:"required,gtefield=StartDate" time_format:"2006-01-02 15:04"`
+	Keyword string   `json:"keyword" form:"keyword" binding:"required_without=Hashtag"`
+	Hashtag []string `json:"hashtag" form:"hashtag" binding:"required_without=Keyword"`
+	FilterForm
+	Count  int    `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
+	Cursor string `json:"cursor" form:"cursor" binding:"omitempty"`
+}
+
+type TimeseriesForm struct {
+	Hashtag  []string `json:"hashtag" form:"hashtag" binding:"required,min=1,max=20"`
+	Keyword  string   `json:"keyword" form:"keyword" binding:"omitempty"`
+	Interval string   `json:"interval" form:"interval" binding:"required,oneof=hour day week"`
+	FilterForm
+}
+
+const (
+	// DefaultRankingCount is the count of the ranking of all hashtags.
+	DefaultRankingCount = 1000
+	// DefaultCooccurrenceCount is the count of the cooccurrence graph.
+	DefaultCooccurrenceCount = 20
+)
+
+// trendingMaxBaseline keeps the trending search within a few monthly indices.
+const trendingMaxBaseline = 90 * 24 * time.Hour
+
+// TrendingForm compares the window ending at EndDate with the baseline window just before it.
+type TrendingForm struct {
+	Keyword string `json:"keyword" form:"keyword" binding:"omitempty"`
+	TweetFilterForm
+	EndDate  string        `json:"end_date" form:"end_date" binding:"omitempty"`
+	Window   time.Duration `json:"window" form:"window"`
+	Baseline time.Duration `json:"baseline" form:"baseline"`
+	MinCount int           `json:"min_count" form:"min_count" binding:"min=1"`
+	Count    int           `json:"count" form:"count" binding:"min=1,max=1000"`
+}
+
+func (f *TrendingForm) validate() error {
+	if f.Window < time.Hour {
+		return handler.InvalidParameter("window", errors.New("must be at least 1h"))
+	}
+	if f.Baseline < f.Window {
+		return handler.InvalidParameter("baseline", errors.New("must be at least as long as window"))
+	}
+	if f.Window+f.Baseline > trendingMaxBaseline {
+		return handler.InvalidParameter("baseline", fmt.Errorf("must not exceed %s together with window", trendingMaxBaseline))
+	}
+	return nil
+}
+
+// windows returns the start of the baseline, the start of the target window and its end.
+// Without an end date the target window ends now.
+func (f *TrendingForm) windows(c *gin.Context, now time.Time) (time.Time, time.Time, time.Time, error) {
+	end := now.UTC().Truncate(time.Minute)
+	if f.EndDate != "" {
+		var err error
+		if end, err = handler.ParseTime(c, f.EndDate); err != nil {
+			return time.Time{}, time.Time{}, time.Time{}, handler.InvalidParameter("end_date", err)
+		}
+	}
+	targetStart := end.Add(-f.Window)
+	return targetStart.Add(-f.Baseline), targetStart, end, nil
+}
+
+type CooccurrenceForm struct {
+	Hashtag  []string `json:"hashtag" form:"hashtag" binding:"required,min=1,max=10"`
+	Keyword  string   `json:"keyword" form:"keyword" binding:"omitempty"`
+	Count    int      `json:"count" form:"count" binding:"min=1,max=200"`
+	Hops     int      `json:"hops" form:"hops" binding:"min=1,max=2"`
+	MinCount int      `json:"min_count" form:"min_count" binding:"min=1"`
+	Format   string   `json:"format" form:"format" binding:"required,oneof=json graphml gexf"`
+	FilterForm
+}
+
+// ContributorsForm takes the hashtag from the path.
+type ContributorsForm struct {
+	Hashtag string `json:"-" form:"-" binding:"required"`
+	Keyword string `json:"keyword" form:"keyword" binding:"omitempty"`
+	Count   int    `json:"count" form:"count" binding:"min=1,max=100"`
+	FilterForm
+}
+
+// SuggestForm completes Prefix from the hashtags of the last Days days.
+type SuggestForm struct {
+	Prefix string `json:"prefix" form:"prefix" binding:"required"`
+	Days   int    `json:"days" form:"days" binding:"min=1,max=31"`
+	Count  int    `json:"count" form:"count" binding:"min=1,max=50"`
+}
+
+// window returns the range of the last Days days, in whole minutes so that it stays the same
+// for the requests of a minute.
+func (f *SuggestForm) window(now time.Time) (time.Time, time.Time) {
+	end := now.UTC().Truncate(time.Minute)
+	return end.AddDate(0, 0, -f.Days), end
 }
 
 type SearchForm struct {
-	Hashtag   string    `json:"hashtag" form:"hashtag" binding:"required"`
-	StartDate time.Time `json:"start_date" form:"start_date" binding:"required" time_format:"2006-01-02 15:04"`
-	EndDate   time.Time `json:"end_date" form:"end_date" binding:"required,gtefield=StartDate" time_format:"2006-01-02 15:04"`
-	Count     int       `json:"count" form:"count" binding:"min=1,max=10000"`
+	Hashtag   string `json:"hashtag" form:"hashtag" binding:"required"`
+	StartDate string `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" form:"end_date" binding:"required"`
+	Count     int    `json:"count" form:"count" binding:"min=1,max=10000"`
+	Cursor    string `json:"cursor" form:"cursor" binding:"omitempty"`
 }
@@ -1,24 +1,48 @@
 package handler
 
-import "time"
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"sns-api/datetime"
+	"time"
+)
 
-func ConvertTime(t time.Time) string {
-	return ConvertTime2String(ConvertUtc2Jst(t))
+// ParseRange reads start_date and end_date, RFC 3339 or 2006-01-02 15:04 in the zone of the
+// request, and returns them in UTC.
+func ParseRange(c *gin.Context, startDate, endDate string) (time.Time, time.Time, error) {
+	start, err := ParseTime(c, startDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, InvalidParameter("start_date", err)
+	}
+	end, err := ParseTime(c, endDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, InvalidParameter("end_date", err)
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, InvalidParameter("end_date", errors.New("must not be before start_date"))
+	}
+	return start, end, nil
 }
 
-func ConvertDate(t time.Time) string {
-	return ConvertDate2String(t)
+// ParseTime reads one date like ParseRange.
+func ParseTime(c *gin.Context, date string) (time.Time, error) {
+	return datetime.Parse(date, datetime.LocationFromContext(c.Request.Context()))
 }
 
-func ConvertTime2String(t time.Time) string {
-	return t.Format("2006-01-02 15:04")
+// ParseDateRange reads the days start_date and end_date of the zone of the request and returns
+// the start of the first and the last second of the other in UTC.
+func ParseDateRange(c *gin.Context, startDate, endDate string) (time.Time, time.Time, error) {
+	loc := datetime.LocationFromContext(c.Request.Context())
+	start, err := datetime.ParseDate(startDate, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, InvalidParameter("start_date", err)
+	}
+	end, err := datetime.ParseDate(endDate, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, InvalidParameter("end_date", err)
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, InvalidParameter("end_date", errors.New("must not be before start_date"))
+	}
+	return start, datetime.EndOfDay(end, loc), nil
 }
-
-func ConvertDate2String(t time.Time) string {
-	return t.Format("2006-01-02")
-}
-
-func ConvertUtc2Jst(t time.Time) time.Time {
-	return t.Add(-9 * time.Hour)
-}
-
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 	"net/http"
+	"sns-api/datetime"
+	"sns-api/domain"
+	"sns-api/export"
 	"sns-api/handler"
 	"sns-api/logger"
 	"sns-api/usecase"
@@ -19,6 +21,9 @@ type Handler interface {
 	GetByDomain(c *gin.Context)
 	GetByMediaType(c *gin.Context)
 	GetTransitionByUser(c *gin.Context)
+	Search(c *gin.Context)
+	Heatmap(c *gin.Context)
+	Stats(c *gin.Context)
 }
 
 type tweetHandler struct {
@@ -34,9 +39,10 @@ func NewTweetHandler(l logger.Logging, tu usecase.TweetUseCase) Handler {
 }
 
 func (th *tweetHandler) Get(c *gin.Context) {
-	tweets, err := th.tweetUseCase.Get()
+	tweets, err := th.tweetUseCase.Get(c.Request.Context())
 	if err != nil {
-		c.Status(http.StatusNoContent)
+		th.l.Errorf(fmt.Sprintf("failed to Get: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	c.JSON(http.StatusOK, tweets)
@@ -45,31 +51,52 @@ func (th *tweetHandler) Get(c *gin.Context) {
 func (th *tweetHandler) GetByUser(c *gin.Context) {
 	var q UserForm
 
-	q.Count, _ = strconv.Atoi(c.DefaultQuery(string(q.Count), "1"))
-	q.OrderBy = c.DefaultQuery(q.OrderBy, "favorite_count")
-
-	if err := c.ShouldBind(&q); err != nil {
-		switch e := err.(type) {
-		case validator.FieldError:
-			for _, fieldErr := range err.(validator.ValidationErrors) {
-				c.Error(errors.New(fmt.Sprint(fieldErr))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-				return
-			}
-		default:
-			c.Error(e).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-			return
-		}
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(DefaultTimelineCount)))
+	q.OrderBy = c.DefaultQuery("order_by", "favorite_count")
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	format, err := handler.ExportFormat(c)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
 	}
 
-	tweets, hits, err := th.tweetUseCase.GetByUser(q.UserID, handler.ConvertTime(q.StartDate), handler.ConvertTime(q.EndDate), q.Count, q.OrderBy)
+	cursor, err := domain.DecodeCursor(q.Cursor)
+	if err != nil {
+		c.Error(handler.InvalidParameter("cursor", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if format != export.FormatJSON {
+		handler.ExportRows(c, th.l, "GetByUser", format, "tweets", (*domain.Tweet)(nil), func(write func(interface{}) error) (*domain.Page, error) {
+			return th.tweetUseCase.GetByUser(c.Request.Context(), q.UserID, startDate, endDate, q.Count, q.OrderBy, cursor, func(tweet *domain.Tweet) error {
+				return write(tweet)
+			})
+		})
+		return
+	}
+	var tweets []*domain.Tweet
+	page, err := th.tweetUseCase.GetByUser(c.Request.Context(), q.UserID, startDate, endDate, q.Count, q.OrderBy, cursor, func(tweet *domain.Tweet) error {
+		tweets = append(tweets, tweet)
+		return nil
+	})
 	if err != nil {
 		th.l.Errorf(fmt.Sprintf("failed to GetByUser: %v", err))
-		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNoContent)
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	r := &Response{
-		Hits: hits,
-		Res:  tweets,
+		Hits:       page.Hits,
+		Res:        tweets,
+		NextCursor: domain.EncodeCursor(page.NextCursor),
+		Warnings:   page.Warnings,
 	}
 	c.JSON(http.StatusOK, r)
 }
@@ -77,30 +104,50 @@ func (th *tweetHandler) GetByUser(c *gin.Context) {
 func (th *tweetHandler) GetByUsers(c *gin.Context) {
 	var q UsersForm
 
-	q.Count, _ = strconv.Atoi(c.DefaultQuery(string(q.Count), "1"))
-	q.OrderBy = c.DefaultQuery(q.OrderBy, "created_at")
-
-	if err := c.ShouldBind(&q); err != nil {
-		switch e := err.(type) {
-		case validator.FieldError:
-			for _, fieldErr := range err.(validator.ValidationErrors) {
-				c.Error(errors.New(fmt.Sprint(fieldErr))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-				return
-			}
-		default:
-			c.Error(e).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-			return
-		}
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(DefaultTimelineCount)))
+	q.OrderBy = c.DefaultQuery("order_by", "created_at")
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	format, err := handler.ExportFormat(c)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
 	}
-	tweets, hits, err := th.tweetUseCase.GetByUsers(q.UserIDs, q.StartDate, q.EndDate, q.Count, q.OrderBy)
+	cursor, err := domain.DecodeCursor(q.Cursor)
+	if err != nil {
+		c.Error(handler.InvalidParameter("cursor", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if format != export.FormatJSON {
+		handler.ExportRows(c, th.l, "GetByUsers", format, "tweets", (*domain.Tweet)(nil), func(write func(interface{}) error) (*domain.Page, error) {
+			return th.tweetUseCase.GetByUsers(c.Request.Context(), q.UserIDs, startDate, endDate, q.Count, q.OrderBy, cursor, func(tweet *domain.Tweet) error {
+				return write(tweet)
+			})
+		})
+		return
+	}
+	var tweets []*domain.Tweet
+	page, err := th.tweetUseCase.GetByUsers(c.Request.Context(), q.UserIDs, startDate, endDate, q.Count, q.OrderBy, cursor, func(tweet *domain.Tweet) error {
+		tweets = append(tweets, tweet)
+		return nil
+	})
 	if err != nil {
 		th.l.Errorf(fmt.Sprintf("failed to GetByUsers: %v", err))
-		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNoContent)
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	r := &Response{
-		Hits: hits,
-		Res:  tweets,
+		Hits:       page.Hits,
+		Res:        tweets,
+		NextCursor: domain.EncodeCursor(page.NextCursor),
+		Warnings:   page.Warnings,
 	}
 	c.JSON(http.StatusOK, r)
 }
@@ -108,32 +155,54 @@ func (th *tweetHandler) GetByUsers(c *gin.Context) {
 func (th *tweetHandler) GetByDomain(c *gin.Context) {
 	var q URLForm
 
-	q.Count, _ = strconv.Atoi(c.DefaultQuery(string(q.Count), "1"))
-	q.OrderBy = c.DefaultQuery(q.OrderBy, "favorite_count")
-
-	if err := c.ShouldBind(&q); err != nil {
-		switch e := err.(type) {
-		case validator.FieldError:
-			for _, fieldErr := range err.(validator.ValidationErrors) {
-				c.Error(errors.New(fmt.Sprint(fieldErr))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-				return
-			}
-		default:
-			c.Error(e).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-			return
-		}
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(DefaultTimelineCount)))
+	q.OrderBy = c.DefaultQuery("order_by", "favorite_count")
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	format, err := handler.ExportFormat(c)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
 	}
 
-	tweets, hits, urlInfo, err := th.tweetUseCase.GetByDomain(q.UserID, handler.ConvertTime(q.StartDate), handler.ConvertTime(q.EndDate), q.Count, q.OrderBy, q.Domain)
+	cursor, err := domain.DecodeCursor(q.Cursor)
+	if err != nil {
+		c.Error(handler.InvalidParameter("cursor", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if format != export.FormatJSON {
+		handler.ExportRows(c, th.l, "GetByDomain", format, "tweets", (*domain.Tweet)(nil), func(write func(interface{}) error) (*domain.Page, error) {
+			page, _, err := th.tweetUseCase.GetByDomain(c.Request.Context(), q.UserID, startDate, endDate, q.Count, q.OrderBy, q.Domain, cursor, func(tweet *domain.Tweet) error {
+				return write(tweet)
+			})
+			return page, err
+		})
+		return
+	}
+	var tweets []*domain.Tweet
+	page, urlInfo, err := th.tweetUseCase.GetByDomain(c.Request.Context(), q.UserID, startDate, endDate, q.Count, q.OrderBy, q.Domain, cursor, func(tweet *domain.Tweet) error {
+		tweets = append(tweets, tweet)
+		return nil
+	})
 	if err != nil {
 		th.l.Errorf(fmt.Sprintf("failed to GetByDomain: %v", err))
-		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNoContent)
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	r := &ResponseDomain{
-		Hits:    hits,
-		Tweets:  tweets,
-		UrlInfo: urlInfo,
+		Hits:       page.Hits,
+		Tweets:     tweets,
+		UrlInfo:    urlInfo,
+		NextCursor: domain.EncodeCursor(page.NextCursor),
+		Warnings:   page.Warnings,
 	}
 	c.JSON(http.StatusOK, r)
 	th.l.Info("function handler.GetByDomain done")
@@ -142,32 +211,54 @@ func (th *tweetHandler) GetByDomain(c *gin.Context) {
 func (th *tweetHandler) GetByMediaType(c *gin.Context) {
 	var q MediaForm
 
-	q.Count, _ = strconv.Atoi(c.DefaultQuery(string(q.Count), "1"))
-	q.OrderBy = c.DefaultQuery(q.OrderBy, "favorite_count")
-
-	if err := c.ShouldBind(&q); err != nil {
-		switch e := err.(type) {
-		case validator.FieldError:
-			for _, fieldErr := range err.(validator.ValidationErrors) {
-				c.Error(errors.New(fmt.Sprint(fieldErr))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-				return
-			}
-		default:
-			c.Error(e).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-			return
-		}
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(DefaultTimelineCount)))
+	q.OrderBy = c.DefaultQuery("order_by", "favorite_count")
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	format, err := handler.ExportFormat(c)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := domain.DecodeCursor(q.Cursor)
+	if err != nil {
+		c.Error(handler.InvalidParameter("cursor", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
 	}
 
-	tweets, hits, media, err := th.tweetUseCase.GetByMediaType(q.UserID, handler.ConvertTime(q.StartDate), handler.ConvertTime(q.EndDate), q.Count, q.OrderBy, q.MediaType)
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if format != export.FormatJSON {
+		handler.ExportRows(c, th.l, "GetByMediaType", format, "tweets", (*domain.TweetMedia)(nil), func(write func(interface{}) error) (*domain.Page, error) {
+			page, _, err := th.tweetUseCase.GetByMediaType(c.Request.Context(), q.UserID, startDate, endDate, q.Count, q.OrderBy, q.MediaType, cursor, func(tweet *domain.TweetMedia) error {
+				return write(tweet)
+			})
+			return page, err
+		})
+		return
+	}
+	var tweets []*domain.TweetMedia
+	page, media, err := th.tweetUseCase.GetByMediaType(c.Request.Context(), q.UserID, startDate, endDate, q.Count, q.OrderBy, q.MediaType, cursor, func(tweet *domain.TweetMedia) error {
+		tweets = append(tweets, tweet)
+		return nil
+	})
 	if err != nil {
 		th.l.Errorf(fmt.Sprintf("failed to GetByMediaType: %v", err))
-		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNoContent)
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	r := &ResponseMedia{
-		Hits:   hits,
-		Tweets: tweets,
-		Media:  media,
+		Hits:       page.Hits,
+		Tweets:     tweets,
+		Media:      media,
+		NextCursor: domain.EncodeCursor(page.NextCursor),
+		Warnings:   page.Warnings,
 	}
 	c.JSON(http.StatusOK, r)
 	th.l.Info("function handler.GetByMedia done")
@@ -176,29 +267,151 @@ func (th *tweetHandler) GetByMediaType(c *gin.Context) {
 func (th *tweetHandler) GetTransitionByUser(c *gin.Context) {
 	var q TransitionForm
 
-	q.Count, _ = strconv.Atoi(c.DefaultQuery(string(q.Count), "100"))
-
-	if err := c.ShouldBind(&q); err != nil {
-		switch e := err.(type) {
-		case validator.FieldError:
-			for _, fieldErr := range err.(validator.ValidationErrors) {
-				c.Error(errors.New(fmt.Sprint(fieldErr))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-				return
-			}
-		default:
-			c.Error(e).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-			return
-		}
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(DefaultTransitionCount)))
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	cursor, err := domain.DecodeCursor(q.Cursor)
+	if err != nil {
+		c.Error(handler.InvalidParameter("cursor", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
 	}
-	transitions, err := th.tweetUseCase.GetTransitionByUser(q.UserID, handler.ConvertDate(q.StartDate), handler.ConvertDate(q.EndDate), q.Count)
+	startDate, endDate, err := handler.ParseDateRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	transitions, page, err := th.tweetUseCase.GetTransitionByUser(c.Request.Context(), q.UserID, startDate, endDate, q.Count, cursor)
 	if err != nil {
 		th.l.Errorf(fmt.Sprintf("failed to GetTransitionByUser: %v", err))
-		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNoContent)
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	r := &Response{
+		Hits:       page.Hits,
+		Res:        transitions,
+		NextCursor: domain.EncodeCursor(page.NextCursor),
+		Warnings:   page.Warnings,
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (th *tweetHandler) Search(c *gin.Context) {
+	var q SearchForm
+
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(handler.DefaultCount)))
+	q.OrderBy = c.DefaultQuery("order_by", "created_at")
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	format, err := handler.ExportFormat(c)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+
+	query, err := domain.ParseSearchQuery(q.Query)
+	if err != nil {
+		c.Error(handler.InvalidParameter("q", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := domain.DecodeCursor(q.Cursor)
+	if err != nil {
+		c.Error(handler.InvalidParameter("cursor", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if format != export.FormatJSON {
+		handler.ExportRows(c, th.l, "Search", format, "tweets", (*domain.Tweet)(nil), func(write func(interface{}) error) (*domain.Page, error) {
+			return th.tweetUseCase.Search(c.Request.Context(), query, startDate, endDate, q.Count, q.OrderBy, cursor, func(tweet *domain.Tweet) error {
+				return write(tweet)
+			})
+		})
+		return
+	}
+	var tweets []*domain.Tweet
+	page, err := th.tweetUseCase.Search(c.Request.Context(), query, startDate, endDate, q.Count, q.OrderBy, cursor, func(tweet *domain.Tweet) error {
+		tweets = append(tweets, tweet)
+		return nil
+	})
+	if err != nil {
+		th.l.Errorf(fmt.Sprintf("failed to Search: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	r := &Response{
+		Hits:       page.Hits,
+		Res:        tweets,
+		NextCursor: domain.EncodeCursor(page.NextCursor),
+		Warnings:   page.Warnings,
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (th *tweetHandler) Heatmap(c *gin.Context) {
+	var q HeatmapForm
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+
+	heatmap, err := th.tweetUseCase.Heatmap(c.Request.Context(), q.UserID, startDate, endDate, datetime.LocationFromContext(c.Request.Context()))
+	if errors.Is(err, domain.ErrTooManyBuckets) {
+		c.Error(handler.InvalidParameter("end_date", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		th.l.Errorf(fmt.Sprintf("failed to Heatmap: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	var hits int
+	for _, hours := range heatmap.StatusCount {
+		for _, n := range hours {
+			hits += int(n)
+		}
+	}
+	r := &Response{
+		Hits: hits,
+		Res:  heatmap,
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (th *tweetHandler) Stats(c *gin.Context) {
+	var q StatsForm
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	stats, err := th.tweetUseCase.Stats(c.Request.Context(), q.UserID, startDate, endDate)
+	if err != nil {
+		th.l.Errorf(fmt.Sprintf("failed to Stats: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	r := &Response{
-		Hits: len(transitions),
-		Res:  transitions,
+		Hits: int(stats.Current.StatusCount),
+		Res:  stats,
 	}
 	c.JSON(http.StatusOK, r)
 }
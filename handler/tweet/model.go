@@ -1,22 +1,38 @@
 package tweet
 
-import "time"
+import (
+	"sns-api/domain"
+)
+
+const (
+	// DefaultTimelineCount is the count of the routes listing the tweets of users, a domain
+	// or a media type.
+	DefaultTimelineCount = 1
+	// DefaultTransitionCount is the count of the transition route.
+	DefaultTransitionCount = 100
+)
 
 type Response struct {
-	Hits int         `json:"hits"`
-	Res  interface{} `json:"res"`
+	Hits       int               `json:"hits"`
+	Res        interface{}       `json:"res"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	Warnings   []*domain.Warning `json:"warnings,omitempty"`
 }
 
 type ResponseDomain struct {
-	Hits    int         `json:"hits"`
-	Tweets  interface{} `json:"tweets"`
-	UrlInfo interface{} `json:"url_info"`
+	Hits       int               `json:"hits"`
+	Tweets     interface{}       `json:"tweets"`
+	UrlInfo    interface{}       `json:"url_info"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	Warnings   []*domain.Warning `json:"warnings,omitempty"`
 }
 
 type ResponseMedia struct {
-	Hits   int         `json:"hits"`
-	Tweets interface{} `json:"tweets"`
-	Media  interface{} `json:"media"`
+	Hits       int               `json:"hits"`
+	Tweets     interface{}       `json:"tweets"`
+	Media      interface{}       `json:"media"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	Warnings   []*domain.Warning `json:"warnings,omitempty"`
 }
 
 type ResponseTransition struct {
@@ -25,42 +41,68 @@ type ResponseTransition struct {
 }
 
 type UserForm struct {
-	UserID    uint64    `json:"user_id" form:"user_id" binding:"required"`
-	StartDate time.Time `json:"start_date" form:"start_date" binding:"required" time_format:"2006-01-02 15:04"`
-	EndDate   time.Time `json:"end_date" form:"end_date" binding:"required,gtefield=StartDate" time_format:"2006-01-02 15:04"`
-	OrderBy   string    `json:"order_by" form:"order_by" binding:"omitempty,oneof=retweet_count quote_count favorite_count created_at inserted_at"`
-	Count     int       `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
+	UserID    uint64 `json:"user_id" form:"user_id" binding:"required"`
+	StartDate string `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" form:"end_date" binding:"required"`
+	OrderBy   string `json:"order_by" form:"order_by" binding:"omitempty,oneof=retweet_count quote_count favorite_count created_at inserted_at"`
+	Count     int    `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
+	Cursor    string `json:"cursor" form:"cursor" binding:"omitempty"`
 }
 
 type UsersForm struct {
-	UserIDs   []uint64  `json:"user_ids" form:"user_ids" binding:"required,max=10000"`
-	StartDate time.Time `json:"start_date" form:"start_date" binding:"required" time_format:"2006-01-02 15:04"`
-	EndDate   time.Time `json:"end_date" form:"end_date" binding:"required,gtefield=StartDate" time_format:"2006-01-02 15:04"`
-	OrderBy   string    `json:"order_by" form:"order_by" binding:"omitempty,oneof=retweet_count quote_count favorite_count created_at inserted_at"`
-	Count     int       `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
+	UserIDs   []uint64 `json:"user_ids" form:"user_ids" binding:"required,max=10000"`
+	StartDate string   `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string   `json:"end_date" form:"end_date" binding:"required"`
+	OrderBy   string   `json:"order_by" form:"order_by" binding:"omitempty,oneof=retweet_count quote_count favorite_count created_at inserted_at"`
+	Count     int      `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
+	Cursor    string   `json:"cursor" form:"cursor" binding:"omitempty"`
 }
 
 type URLForm struct {
-	UserID    uint64    `json:"user_id" form:"user_id" binding:"required"`
-	StartDate time.Time `json:"start_date" form:"start_date" binding:"required" time_format:"2006-01-02 15:04"`
-	EndDate   time.Time `json:"end_date" form:"end_date" binding:"required,gtefield=StartDate" time_format:"2006-01-02 15:04"`
-	OrderBy   string    `json:"order_by" form:"order_by" binding:"omitempty,oneof=retweet_count quote_count favorite_count created_at inserted_at"`
-	Count     int       `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
-	Domain    string    `json:"domain" form:"domain" binding:"required"`
+	UserID    uint64 `json:"user_id" form:"user_id" binding:"required"`
+	StartDate string `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" form:"end_date" binding:"required"`
+	OrderBy   string `json:"order_by" form:"order_by" binding:"omitempty,oneof=retweet_count quote_count favorite_count created_at inserted_at"`
+	Count     int    `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
+	Domain    string `json:"domain" form:"domain" binding:"required"`
+	Cursor    string `json:"cursor" form:"cursor" binding:"omitempty"`
 }
 
 type MediaForm struct {
-	UserID    uint64    `json:"user_id" form:"user_id" binding:"required"`
-	StartDate time.Time `json:"start_date" form:"start_date" binding:"required" time_format:"2006-01-02 15:04"`
-	EndDate   time.Time `json:"end_date" form:"end_date" binding:"required,gtefield=StartDate" time_format:"2006-01-02 15:04"`
-	OrderBy   string    `json:"order_by" form:"order_by" binding:"omitempty,oneof=retweet_count quote_count favorite_count created_at inserted_at"`
-	Count     int       `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
-	MediaType int       `json:"media_type" form:"media_type" binding:"required,oneof=-1 2 3 4"`
+	UserID    uint64 `json:"user_id" form:"user_id" binding:"required"`
+	StartDate string `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" form:"end_date" binding:"required"`
+	OrderBy   string `json:"order_by" form:"order_by" binding:"omitempty,oneof=retweet_count quote_count favorite_count created_at inserted_at"`
+	Count     int    `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
+	MediaType int    `json:"media_type" form:"media_type" binding:"required,oneof=-1 2 3 4"`
+	Cursor    string `json:"cursor" form:"cursor" binding:"omitempty"`
+}
+
+type SearchForm struct {
+	Query     string `json:"q" form:"q" binding:"required"`
+	StartDate string `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" form:"end_date" binding:"required"`
+	OrderBy   string `json:"order_by" form:"order_by" binding:"omitempty,oneof=_score retweet_count quote_count favorite_count created_at"`
+	Count     int    `json:"count" form:"count" binding:"omitempty,min=1,max=10000"`
+	Cursor    string `json:"cursor" form:"cursor" binding:"omitempty"`
+}
+
+type HeatmapForm struct {
+	UserID    uint64 `json:"user_id" form:"user_id" binding:"required"`
+	StartDate string `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" form:"end_date" binding:"required"`
+}
+
+type StatsForm struct {
+	UserID    uint64 `json:"user_id" form:"user_id" binding:"required"`
+	StartDate string `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" form:"end_date" binding:"required"`
 }
 
 type TransitionForm struct {
-	UserID    uint64    `json:"user_id" form:"user_id" binding:"required"`
-	StartDate time.Time `json:"start_date" form:"start_date" binding:"required" time_format:"2006-01-02"`
-	EndDate   time.Time `json:"end_date" form:"end_date" binding:"required,gtefield=StartDate" time_format:"2006-01-02"`
-	Count     int       `json:"count" form:"count" binding:"omitempty,min=1,max=100000"`
+	UserID    uint64 `json:"user_id" form:"user_id" binding:"required"`
+	StartDate string `json:"start_date" form:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" form:"end_date" binding:"required"`
+	Count     int    `json:"count" form:"count" binding:"omitempty,min=1,max=100000"`
+	Cursor    string `json:"cursor" form:"cursor" binding:"omitempty"`
 }
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 	"net/http"
+	"sns-api/domain"
+	"sns-api/export"
+	"sns-api/handler"
 	"sns-api/logger"
 	"sns-api/usecase"
 	"strconv"
@@ -15,6 +17,8 @@ type Handler interface {
 	Search(c *gin.Context)
 	GetById(c *gin.Context)
 	GetByIds(c *gin.Context)
+	Growth(c *gin.Context)
+	Compare(c *gin.Context)
 }
 
 type userHandler struct {
@@ -32,30 +36,50 @@ func NewUserHandler(l logger.Logging, uu usecase.UserUseCase) Handler {
 func (uh *userHandler) Search(c *gin.Context) {
 	var q SearchForm
 
-	q.Count, _ = strconv.Atoi(c.DefaultQuery(string(q.Count), "10"))
-	q.OrderBy = c.DefaultQuery(q.OrderBy, "followers_count")
-
-	if err := c.ShouldBind(&q); err != nil {
-		switch e := err.(type) {
-		case validator.FieldError:
-			for _, fieldErr := range err.(validator.ValidationErrors) {
-				c.Error(errors.New(fmt.Sprint(fieldErr))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-				return
-			}
-		default:
-			c.Error(e).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-			return
-		}
-	}
-	users, hits, err := uh.userUseCase.Search(q.Name, q.Description, q.Language, q.FollowerMin, q.FollowerMax, q.StatusMin, q.StatusMax, q.FavoriteMin, q.FavoriteMax, q.FollowMin, q.FollowMax, q.ListMin, q.ListMax, q.SrScoreMin, q.SrScoreMax, q.StartDate, q.EndDate, q.Count, q.OrderBy)
+	q.Count, _ = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(handler.DefaultCount)))
+	q.OrderBy = c.DefaultQuery("order_by", "followers_count")
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	format, err := handler.ExportFormat(c)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	cursor, err := domain.DecodeCursor(q.Cursor)
+	if err != nil {
+		c.Error(handler.InvalidParameter("cursor", err)).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if format != export.FormatJSON {
+		handler.ExportRows(c, uh.l, "Search", format, "users", (*domain.User)(nil), func(write func(interface{}) error) (*domain.Page, error) {
+			return uh.userUseCase.Search(c.Request.Context(), q.Name, q.Description, q.Language, q.FollowerMin, q.FollowerMax, q.StatusMin, q.StatusMax, q.FavoriteMin, q.FavoriteMax, q.FollowMin, q.FollowMax, q.ListMin, q.ListMax, q.SrScoreMin, q.SrScoreMax, startDate, endDate, q.Count, q.OrderBy, cursor, func(user *domain.User) error {
+				return write(user)
+			})
+		})
+		return
+	}
+	var users []*domain.User
+	page, err := uh.userUseCase.Search(c.Request.Context(), q.Name, q.Description, q.Language, q.FollowerMin, q.FollowerMax, q.StatusMin, q.StatusMax, q.FavoriteMin, q.FavoriteMax, q.FollowMin, q.FollowMax, q.ListMin, q.ListMax, q.SrScoreMin, q.SrScoreMax, startDate, endDate, q.Count, q.OrderBy, cursor, func(user *domain.User) error {
+		users = append(users, user)
+		return nil
+	})
 	if err != nil {
 		uh.l.Errorf(fmt.Sprintf("failed to Search: %v", err))
-		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNoContent)
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	r := &Response{
-		Hits: hits,
-		Res:  users,
+		Hits:       page.Hits,
+		Res:        users,
+		NextCursor: domain.EncodeCursor(page.NextCursor),
+		Warnings:   page.Warnings,
 	}
 	c.JSON(http.StatusOK, r)
 }
@@ -63,27 +87,28 @@ func (uh *userHandler) Search(c *gin.Context) {
 func (uh *userHandler) GetById(c *gin.Context) {
 	var q IDForm
 
-	if err := c.ShouldBind(&q); err != nil {
-		switch e := err.(type) {
-		case validator.FieldError:
-			for _, fieldErr := range err.(validator.ValidationErrors) {
-				c.Error(errors.New(fmt.Sprint(fieldErr))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-				return
-			}
-		default:
-			c.Error(e).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-			return
-		}
-	}
-	user, hits, err := uh.userUseCase.GetById(q.UserID, q.StartDate, q.EndDate)
+	if !handler.Bind(c, &q) {
+		return
+	}
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	user, page, err := uh.userUseCase.GetById(c.Request.Context(), q.UserID, startDate, endDate)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		uh.l.Errorf(fmt.Sprintf("failed to GetById: %v", err))
-		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNoContent)
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	r := &Response{
-		Hits: hits,
-		Res:  user,
+		Hits:     page.Hits,
+		Res:      user,
+		Warnings: page.Warnings,
 	}
 	c.JSON(http.StatusOK, r)
 }
@@ -91,27 +116,97 @@ func (uh *userHandler) GetById(c *gin.Context) {
 func (uh *userHandler) GetByIds(c *gin.Context) {
 	var q IDsForm
 
-	if err := c.ShouldBind(&q); err != nil {
-		switch e := err.(type) {
-		case validator.FieldError:
-			for _, fieldErr := range err.(validator.ValidationErrors) {
-				c.Error(errors.New(fmt.Sprint(fieldErr))).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-				return
-			}
-		default:
-			c.Error(e).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
-			return
-		}
-	}
-	users, hits, err := uh.userUseCase.GetByIds(q.UserIDs, q.StartDate, q.EndDate)
+	if !handler.Bind(c, &q) {
+		return
+	}
+	format, err := handler.ExportFormat(c)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if format != export.FormatJSON {
+		handler.ExportRows(c, uh.l, "GetByIds", format, "users", (*domain.User)(nil), func(write func(interface{}) error) (*domain.Page, error) {
+			return uh.userUseCase.GetByIds(c.Request.Context(), q.UserIDs, startDate, endDate, func(user *domain.User) error {
+				return write(user)
+			})
+		})
+		return
+	}
+	var users []*domain.User
+	page, err := uh.userUseCase.GetByIds(c.Request.Context(), q.UserIDs, startDate, endDate, func(user *domain.User) error {
+		users = append(users, user)
+		return nil
+	})
 	if err != nil {
 		uh.l.Errorf(fmt.Sprintf("failed to GetByIds: %v", err))
-		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusNoContent)
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	r := &Response{
+		Hits:     page.Hits,
+		Res:      users,
+		Warnings: page.Warnings,
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (uh *userHandler) Growth(c *gin.Context) {
+	var q GrowthForm
+
+	q.Interval = c.DefaultQuery("interval", "day")
+	q.Window, _ = strconv.Atoi(c.DefaultQuery("window", "14"))
+	q.Threshold, _ = strconv.ParseFloat(c.DefaultQuery("threshold", "3.5"), 64)
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	startDate, endDate, err := handler.ParseDateRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	if err := q.validate(startDate, endDate); err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	growth, err := uh.userUseCase.Growth(c.Request.Context(), q.UserID, startDate, endDate, q.Interval, q.Window, q.Threshold)
+	if err != nil {
+		uh.l.Errorf(fmt.Sprintf("failed to Growth: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
+		return
+	}
+	r := &Response{
+		Hits: len(growth.Points),
+		Res:  growth,
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (uh *userHandler) Compare(c *gin.Context) {
+	var q CompareForm
+
+	if !handler.Bind(c, &q) {
+		return
+	}
+	startDate, endDate, err := handler.ParseRange(c, q.StartDate, q.EndDate)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusBadRequest)
+		return
+	}
+	comparison, err := uh.userUseCase.Compare(c.Request.Context(), q.UserIDs, startDate, endDate)
+	if err != nil {
+		uh.l.Errorf(fmt.Sprintf("failed to Compare: %v", err))
+		c.Error(err).SetType(gin.ErrorTypePrivate).SetMeta(http.StatusServiceUnavailable)
 		return
 	}
 	r := &Response{
-		Hits: hits,
-		Res:  users,
+		Hits: len(comparison.Users),
+		Res:  comparison,
 	}
 	c.JSON(http.StatusOK, r)
 }
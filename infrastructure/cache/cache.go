@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sns-api/domain"
+	"sns-api/logger"
+	"sns-api/metrics"
+	"sort"
+	"sync"
+	"time"
+)
+
+// closedGrace keeps a range open for a day after its UTC month ended, which covers documents
+// indexed late. The handlers read the dates in the zone of the request but pass them on in UTC,
+// so the zone does not move the end of a range relative to the month.
+const closedGrace = 24 * time.Hour
+
+// Policy decides how long a result is cached: results for ranges that ended before the
+// current month do not change any more and are kept for Closed, the rest for Open.
+type Policy struct {
+	Closed time.Duration
+	Open   time.Duration
+	now    func() time.Time
+}
+
+func NewPolicy(closed, open time.Duration) *Policy {
+	return &Policy{Closed: closed, Open: open, now: time.Now}
+}
+
+func (p *Policy) TTL(endDate time.Time) time.Duration {
+	now := p.now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if endDate.Before(monthStart.Add(-closedGrace)) {
+		return p.Closed
+	}
+	return p.Open
+}
+
+// Key returns the cache key of op called with params. Parameters whose order does not matter,
+// such as user id lists, are sorted so that equivalent queries share an entry.
+func Key(op string, params ...interface{}) string {
+	normalized := make([]interface{}, len(params))
+	for i, p := range params {
+		switch v := p.(type) {
+		case *domain.HashtagFilter:
+			f := *v
+			f.Hashtag = normalize(f.Hashtag).([]string)
+			f.TweetType = normalize(f.TweetType).([]int)
+			f.UserInclude = normalize(f.UserInclude).([]string)
+			f.UserExclude = normalize(f.UserExclude).([]string)
+			f.HashtagInclude = normalize(f.HashtagInclude).([]string)
+			f.HashtagExclude = normalize(f.HashtagExclude).([]string)
+			f.StartDate = f.StartDate.UTC()
+			f.EndDate = f.EndDate.UTC()
+			normalized[i] = f
+		default:
+			normalized[i] = normalize(v)
+		}
+	}
+	b, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(b)
+	return fmt.Sprintf("%s:%s", op, hex.EncodeToString(sum[:]))
+}
+
+// normalize returns a form of p that encodes the same for equivalent values.
+func normalize(p interface{}) interface{} {
+	switch v := p.(type) {
+	case []uint64:
+		s := append([]uint64(nil), v...)
+		sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		return s
+	case []int:
+		s := append([]int(nil), v...)
+		sort.Ints(s)
+		return s
+	case []string:
+		s := append([]string(nil), v...)
+		sort.Strings(s)
+		return s
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case *domain.Cursor:
+		return domain.EncodeCursor(v)
+	}
+	return p
+}
+
+// cacheable reports whether a page can be cached. Pages read from a point in time are not,
+// because the point in time expires long before a closed range does.
+func cacheable(cursor *domain.Cursor, page *domain.Page) bool {
+	if cursor != nil && cursor.PitID != "" {
+		return false
+	}
+	return page == nil || page.NextCursor == nil || page.NextCursor.PitID == ""
+}
+
+// maxCachedRows is the largest page of rows that is cached. The rows of larger pages, such as
+// those exports read, are handed on as they stream in without a copy being kept.
+const maxCachedRows = 1000
+
+// repositoryCache is what the repository decorators share: the store, the policy and the logger.
+type repositoryCache struct {
+	l      logger.Logging
+	store  Store
+	policy *Policy
+}
+
+// get decodes the entry under key into v and records its remaining lifetime in the request's hint.
+func (c *repositoryCache) get(ctx context.Context, op, key string, v interface{}) bool {
+	e, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.l.Warnf(fmt.Sprintf("failed to read cache for %s: %v", op, err))
+	}
+	if e == nil {
+		metrics.ObserveCache(op, false)
+		return false
+	}
+	d := json.NewDecoder(bytes.NewReader(e.Value))
+	// keep cursor sort values as the backend returned them
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		c.l.Warnf(fmt.Sprintf("failed to decode cache for %s: %v", op, err))
+		metrics.ObserveCache(op, false)
+		return false
+	}
+	metrics.ObserveCache(op, true)
+	observe(ctx, time.Until(e.ExpiresAt))
+	return true
+}
+
+func (c *repositoryCache) set(ctx context.Context, op, key string, ttl time.Duration, ok bool, v interface{}) {
+	if !ok || ttl <= 0 {
+		observe(ctx, 0)
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.l.Warnf(fmt.Sprintf("failed to encode cache for %s: %v", op, err))
+		observe(ctx, 0)
+		return
+	}
+	if err := c.store.Set(ctx, key, b, ttl); err != nil {
+		c.l.Warnf(fmt.Sprintf("failed to write cache for %s: %v", op, err))
+	}
+	observe(ctx, ttl)
+}
+
+type hintKey struct{}
+
+// Hint collects how long the results used to build a response stay valid,
+// so that the response can be given a matching Cache-Control max-age.
+type Hint struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	observed bool
+}
+
+func WithHint(ctx context.Context) (context.Context, *Hint) {
+	h := &Hint{}
+	return context.WithValue(ctx, hintKey{}, h), h
+}
+
+// MaxAge returns the shortest lifetime observed, and false when no cached repository was used.
+func (h *Hint) MaxAge() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ttl, h.observed
+}
+
+func observe(ctx context.Context, ttl time.Duration) {
+	h, ok := ctx.Value(hintKey{}).(*Hint)
+	if !ok {
+		return
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.observed || ttl < h.ttl {
+		h.ttl = ttl
+	}
+	h.observed = true
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"context"
+	"sns-api/domain"
+	"testing"
+	"time"
+)
+
+func Test_lruStore(t *testing.T) {
+	now := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int64
+		run        func(s *lruStore)
+		want       map[string]bool
+	}{
+		{
+			name:       "件数上限で最も古い参照を捨てる",
+			maxEntries: 2,
+			maxBytes:   100,
+			run: func(s *lruStore) {
+				_ = s.Set(ctx, "a", []byte("1"), time.Hour)
+				_ = s.Set(ctx, "b", []byte("2"), time.Hour)
+				_, _ = s.Get(ctx, "a")
+				_ = s.Set(ctx, "c", []byte("3"), time.Hour)
+			},
+			want: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name:       "バイト上限",
+			maxEntries: 10,
+			maxBytes:   6,
+			run: func(s *lruStore) {
+				_ = s.Set(ctx, "a", []byte("123"), time.Hour)
+				_ = s.Set(ctx, "b", []byte("456"), time.Hour)
+				_ = s.Set(ctx, "c", []byte("789"), time.Hour)
+			},
+			want: map[string]bool{"a": false, "b": true, "c": true},
+		},
+		{
+			name:       "上限より大きい値は保存しない",
+			maxEntries: 10,
+			maxBytes:   2,
+			run: func(s *lruStore) {
+				_ = s.Set(ctx, "a", []byte("1"), time.Hour)
+				_ = s.Set(ctx, "b", []byte("123"), time.Hour)
+			},
+			want: map[string]bool{"a": true, "b": false},
+		},
+		{
+			name:       "期限切れ",
+			maxEntries: 10,
+			maxBytes:   100,
+			run: func(s *lruStore) {
+				_ = s.Set(ctx, "a", []byte("1"), time.Minute)
+				_ = s.Set(ctx, "b", []byte("2"), time.Hour)
+				s.now = func() time.Time { return now.Add(time.Minute) }
+			},
+			want: map[string]bool{"a": false, "b": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewLRUStore(tt.maxEntries, tt.maxBytes)
+			s.now = func() time.Time { return now }
+			tt.run(s)
+			for key, want := range tt.want {
+				e, _ := s.Get(ctx, key)
+				if (e != nil) != want {
+					t.Errorf("Get(%s) found = %v, want %v", key, e != nil, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicy_TTL(t *testing.T) {
+	p := NewPolicy(24*time.Hour, time.Minute)
+	p.now = func() time.Time { return time.Date(2020, 8, 15, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name    string
+		endDate time.Time
+		want    time.Duration
+	}{
+		{name: "過去の月", endDate: time.Date(2020, 6, 30, 23, 59, 0, 0, time.UTC), want: 24 * time.Hour},
+		{name: "前月末は猶予中", endDate: time.Date(2020, 7, 31, 23, 59, 0, 0, time.UTC), want: time.Minute},
+		{name: "当月", endDate: time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC), want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.TTL(tt.endDate); got != tt.want {
+				t.Errorf("TTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	start := time.Date(2020, 8, 1, 9, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+	if Key("op", []uint64{2, 1}, start) != Key("op", []uint64{1, 2}, start.UTC()) {
+		t.Errorf("Key() differs for the same user ids and instant")
+	}
+	if Key("op", []uint64{1}, 10) == Key("op", []uint64{1}, 20) {
+		t.Errorf("Key() is the same for different counts")
+	}
+	filter := &domain.HashtagFilter{UserInclude: []string{"b", "a"}, StartDate: start}
+	if Key("op", filter) != Key("op", &domain.HashtagFilter{UserInclude: []string{"a", "b"}, StartDate: start.UTC()}) {
+		t.Errorf("Key() differs for the same filter")
+	}
+	if filter.UserInclude[0] != "b" {
+		t.Errorf("Key() modified the filter")
+	}
+	if Key("a", 1) == Key("b", 1) {
+		t.Errorf("Key() is the same for different methods")
+	}
+}
+
+type hashtagRepositoryStub struct {
+	calls int
+}
+
+func (r *hashtagRepositoryStub) Get(ctx context.Context, filter *domain.HashtagFilter, count int, cursor *domain.Cursor) ([]*domain.Hashtag, *domain.Page, error) {
+	return nil, nil, nil
+}
+
+func (r *hashtagRepositoryStub) Timeseries(ctx context.Context, hashtags []string, filter *domain.HashtagFilter, interval domain.HashtagInterval) ([]*domain.HashtagTimeseries, error) {
+	return nil, nil
+}
+
+func (r *hashtagRepositoryStub) Trending(ctx context.Context, filter *domain.HashtagFilter, targetStart time.Time, candidates int) (*domain.HashtagTrendCounts, error) {
+	return nil, nil
+}
+
+func (r *hashtagRepositoryStub) Cooccurrence(ctx context.Context, seeds []string, filter *domain.HashtagFilter, size int) (*domain.HashtagCooccurrence, error) {
+	return nil, nil
+}
+
+func (r *hashtagRepositoryStub) Contributors(ctx context.Context, hashtag string, filter *domain.HashtagFilter, count int) (*domain.HashtagContributors, error) {
+	return nil, nil
+}
+
+func (r *hashtagRepositoryStub) Suggest(ctx context.Context, prefixes []string, startDate, endDate time.Time, count int) ([]*domain.HashtagBySearch, error) {
+	return nil, nil
+}
+
+func (r *hashtagRepositoryStub) GetByName(ctx context.Context, filter *domain.HashtagFilter, count int, cursor *domain.Cursor) ([]*domain.Hashtag, *domain.Page, error) {
+	return nil, nil, nil
+}
+
+func (r *hashtagRepositoryStub) Search(ctx context.Context, hashtag string, startDate, endDate time.Time, count int, cursor *domain.Cursor) ([]*domain.HashtagBySearch, *domain.Page, error) {
+	r.calls++
+	return []*domain.HashtagBySearch{{Hashtag: hashtag, StatusCount: 3}}, &domain.Page{Hits: 1, NextCursor: &domain.Cursor{Offset: count}}, nil
+}
+
+func TestHashtagRepository_Search(t *testing.T) {
+	next := &hashtagRepositoryStub{}
+	r := NewHashtagRepository(nil, NewLRUStore(10, 1<<20), NewPolicy(24*time.Hour, time.Minute), next)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 31, 23, 59, 0, 0, time.UTC)
+
+	ctx, hint := WithHint(context.Background())
+	first, _, _ := r.Search(ctx, "golang", start, end, 10, nil)
+	second, page, _ := r.Search(ctx, "golang", start, end, 10, nil)
+	if next.calls != 1 {
+		t.Errorf("repository called %d times, want 1", next.calls)
+	}
+	if second[0].Hashtag != first[0].Hashtag || second[0].StatusCount != 3 || page.NextCursor.Offset != 10 {
+		t.Errorf("cached result = %+v, %+v", second[0], page)
+	}
+	if maxAge, ok := hint.MaxAge(); !ok || maxAge <= time.Hour {
+		t.Errorf("MaxAge() = %v, %v, want the closed range ttl", maxAge, ok)
+	}
+
+	_, _, _ = r.Search(ctx, "golang", start, end, 20, nil)
+	if next.calls != 2 {
+		t.Errorf("repository called %d times for another count, want 2", next.calls)
+	}
+}
+
+func Test_collectTweets(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		want  int
+	}{
+		{name: "小さいページは保持する", count: 2, want: 2},
+		{name: "大きいページは保持しない", count: maxCachedRows + 1, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var kept []*domain.Tweet
+			handed := 0
+			each := collectTweets(&kept, tt.count, func(tweet *domain.Tweet) error {
+				handed++
+				tweet.Text = "localized"
+				return nil
+			})
+			for i := 0; i < 2; i++ {
+				if err := each(&domain.Tweet{Text: "raw"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if handed != 2 || len(kept) != tt.want {
+				t.Errorf("handed %d, kept %d, want 2 and %d", handed, len(kept), tt.want)
+			}
+			for _, tweet := range kept {
+				if tweet.Text != "raw" {
+					t.Errorf("kept %q, want the tweet before each changed it", tweet.Text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"context"
+	"sns-api/domain"
+	"sns-api/logger"
+	"strings"
+	"time"
+)
+
+type hashtagRepository struct {
+	repositoryCache
+	next domain.HashtagRepository
+}
+
+// NewHashtagRepository caches the results of next in store.
+func NewHashtagRepository(logger logger.Logging, store Store, policy *Policy, next domain.HashtagRepository) *hashtagRepository {
+	return &hashtagRepository{
+		repositoryCache: repositoryCache{l: logger, store: store, policy: policy},
+		next:            next,
+	}
+}
+
+type hashtagsResult struct {
+	Hashtags []*domain.Hashtag
+	Page     *domain.Page
+}
+
+type hashtagsBySearchResult struct {
+	Hashtags []*domain.HashtagBySearch
+	Page     *domain.Page
+}
+
+func (h *hashtagRepository) Get(ctx context.Context, filter *domain.HashtagFilter, count int, cursor *domain.Cursor) ([]*domain.Hashtag, *domain.Page, error) {
+	const op = "hashtag.Get"
+	key := Key(op, filter, count, cursor)
+	var r hashtagsResult
+	if h.get(ctx, op, key, &r) {
+		return r.Hashtags, r.Page, nil
+	}
+	hashtags, page, err := h.next.Get(ctx, filter, count, cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	h.set(ctx, op, key, h.policy.TTL(filter.EndDate), cacheable(cursor, page), &hashtagsResult{Hashtags: hashtags, Page: page})
+	return hashtags, page, nil
+}
+
+// GetByName is not cached; it serves exports, which read every page once.
+func (h *hashtagRepository) GetByName(ctx context.Context, filter *domain.HashtagFilter, count int, cursor *domain.Cursor) ([]*domain.Hashtag, *domain.Page, error) {
+	return h.next.GetByName(ctx, filter, count, cursor)
+}
+
+func (h *hashtagRepository) Search(ctx context.Context, hashtag string, startDate, endDate time.Time, count int, cursor *domain.Cursor) ([]*domain.HashtagBySearch, *domain.Page, error) {
+	const op = "hashtag.Search"
+	key := Key(op, hashtag, startDate, endDate, count, cursor)
+	var r hashtagsBySearchResult
+	if h.get(ctx, op, key, &r) {
+		return r.Hashtags, r.Page, nil
+	}
+	hashtags, page, err := h.next.Search(ctx, hashtag, startDate, endDate, count, cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	h.set(ctx, op, key, h.policy.TTL(endDate), cacheable(cursor, page), &hashtagsBySearchResult{Hashtags: hashtags, Page: page})
+	return hashtags, page, nil
+}
+
+func (h *hashtagRepository) Timeseries(ctx context.Context, hashtags []string, filter *domain.HashtagFilter, interval domain.HashtagInterval) ([]*domain.HashtagTimeseries, error) {
+	const op = "hashtag.Timeseries"
+	// the series come back in the order of hashtags, so unlike other lists it is part of the key as is
+	key := Key(op, strings.Join(hashtags, ","), filter, interval)
+	var r []*domain.HashtagTimeseries
+	if h.get(ctx, op, key, &r) {
+		return r, nil
+	}
+	series, err := h.next.Timeseries(ctx, hashtags, filter, interval)
+	if err != nil {
+		return nil, err
+	}
+	h.set(ctx, op, key, h.policy.TTL(filter.EndDate), true, series)
+	return series, nil
+}
+
+func (h *hashtagRepository) Trending(ctx context.Context, filter *domain.HashtagFilter, targetStart time.Time, candidates int) (*domain.HashtagTrendCounts, error) {
+	const op = "hashtag.Trending"
+	key := Key(op, filter, targetStart, candidates)
+	var r domain.HashtagTrendCounts
+	if h.get(ctx, op, key, &r) {
+		return &r, nil
+	}
+	counts, err := h.next.Trending(ctx, filter, targetStart, candidates)
+	if err != nil {
+		return nil, err
+	}
+	h.set(ctx, op, key, h.policy.TTL(filter.EndDate), true, counts)
+	return counts, nil
+}
+
+func (h *hashtagRepository) Cooccurrence(ctx context.Context, seeds []string, filter *domain.HashtagFilter, size int) (*domain.HashtagCooccurrence, error) {
+	const op = "hashtag.Cooccurrence"
+	key := Key(op, seeds, filter, size)
+	var r domain.HashtagCooccurrence
+	if h.get(ctx, op, key, &r) {
+		return &r, nil
+	}
+	co, err := h.next.Cooccurrence(ctx, seeds, filter, size)
+	if err != nil {
+		return nil, err
+	}
+	h.set(ctx, op, key, h.policy.TTL(filter.EndDate), true, co)
+	return co, nil
+}
+
+func (h *hashtagRepository) Contributors(ctx context.Context, hashtag string, filter *domain.HashtagFilter, count int) (*domain.HashtagContributors, error) {
+	const op = "hashtag.Contributors"
+	key := Key(op, hashtag, filter, count)
+	var r domain.HashtagContributors
+	if h.get(ctx, op, key, &r) {
+		return &r, nil
+	}
+	contributors, err := h.next.Contributors(ctx, hashtag, filter, count)
+	if err != nil {
+		return nil, err
+	}
+	h.set(ctx, op, key, h.policy.TTL(filter.EndDate), true, contributors)
+	return contributors, nil
+}
+
+func (h *hashtagRepository) Suggest(ctx context.Context, prefixes []string, startDate, endDate time.Time, count int) ([]*domain.HashtagBySearch, error) {
+	const op = "hashtag.Suggest"
+	key := Key(op, prefixes, startDate, endDate, count)
+	var r []*domain.HashtagBySearch
+	if h.get(ctx, op, key, &r) {
+		return r, nil
+	}
+	suggestions, err := h.next.Suggest(ctx, prefixes, startDate, endDate, count)
+	if err != nil {
+		return nil, err
+	}
+	h.set(ctx, op, key, h.policy.TTL(endDate), true, suggestions)
+	return suggestions, nil
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Entry is a cached value and the time it stops being served.
+type Entry struct {
+	Value     []byte
+	ExpiresAt time.Time
+}
+
+// Store holds serialized repository results. The in-memory LRU serves a single instance;
+// a shared store such as Redis can implement the interface to serve several.
+type Store interface {
+	// Get returns nil when key is missing or expired.
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+type lruItem struct {
+	key   string
+	entry Entry
+}
+
+// lruStore evicts the least recently used entries once either bound is exceeded.
+type lruStore struct {
+	maxEntries int
+	maxBytes   int64
+	now        func() time.Time
+
+	mu    sync.Mutex
+	bytes int64
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func NewLRUStore(maxEntries int, maxBytes int64) *lruStore {
+	return &lruStore{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		now:        time.Now,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+func (s *lruStore) Get(ctx context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	item := e.Value.(*lruItem)
+	if !s.now().Before(item.entry.ExpiresAt) {
+		s.remove(e)
+		return nil, nil
+	}
+	s.ll.MoveToFront(e)
+	entry := item.entry
+	return &entry, nil
+}
+
+func (s *lruStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.remove(e)
+	}
+	// a value larger than the whole store would only flush everything else
+	if int64(len(value)) > s.maxBytes {
+		return nil
+	}
+	item := &lruItem{key: key, entry: Entry{Value: value, ExpiresAt: s.now().Add(ttl)}}
+	s.items[key] = s.ll.PushFront(item)
+	s.bytes += int64(len(value))
+	for s.ll.Len() > s.maxEntries || s.bytes > s.maxBytes {
+		s.remove(s.ll.Back())
+	}
+	return nil
+}
+
+func (s *lruStore) remove(e *list.Element) {
+	item := e.Value.(*lruItem)
+	s.ll.Remove(e)
+	delete(s.items, item.key)
+	s.bytes -= int64(len(item.entry.Value))
+}
@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"context"
+	"sns-api/domain"
+	"sns-api/logger"
+	"time"
+)
+
+type tweetRepository struct {
+	repositoryCache
+	next domain.TweetRepository
+}
+
+// NewTweetRepository caches the results of next in store.
+func NewTweetRepository(logger logger.Logging, store Store, policy *Policy, next domain.TweetRepository) *tweetRepository {
+	return &tweetRepository{
+		repositoryCache: repositoryCache{l: logger, store: store, policy: policy},
+		next:            next,
+	}
+}
+
+type tweetsResult struct {
+	Tweets []*domain.Tweet
+	Page   *domain.Page
+}
+
+type tweetsByDomainResult struct {
+	Tweets []*domain.Tweet
+	Page   *domain.Page
+	URLs   []*domain.URL
+}
+
+type tweetsByMediaResult struct {
+	Tweets []*domain.TweetMedia
+	Page   *domain.Page
+	Media  []*domain.Media
+}
+
+// collectTweets passes every tweet on to each and keeps a copy of it for the cache, since the
+// callers localize the tweets they are handed. Pages of more than maxCachedRows are not kept.
+func collectTweets(tweets *[]*domain.Tweet, count int, each func(*domain.Tweet) error) func(*domain.Tweet) error {
+	if count > maxCachedRows {
+		return each
+	}
+	return func(tweet *domain.Tweet) error {
+		c := *tweet
+		*tweets = append(*tweets, &c)
+		return each(tweet)
+	}
+}
+
+// collectTweetMedia is collectTweets for the tweets of GetByMediaType.
+func collectTweetMedia(tweets *[]*domain.TweetMedia, count int, each func(*domain.TweetMedia) error) func(*domain.TweetMedia) error {
+	if count > maxCachedRows {
+		return each
+	}
+	return func(tweet *domain.TweetMedia) error {
+		c := *tweet
+		*tweets = append(*tweets, &c)
+		return each(tweet)
+	}
+}
+
+// eachTweet hands the cached tweets to each.
+func eachTweet(tweets []*domain.Tweet, each func(*domain.Tweet) error) error {
+	for _, tweet := range tweets {
+		if err := each(tweet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tweetRepository) Get(ctx context.Context) ([]*domain.Tweet, error) {
+	const op = "tweet.Get"
+	key := Key(op)
+	var r tweetsResult
+	if t.get(ctx, op, key, &r) {
+		return r.Tweets, nil
+	}
+	tweets, err := t.next.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.set(ctx, op, key, t.policy.Open, true, &tweetsResult{Tweets: tweets})
+	return tweets, nil
+}
+
+func (t *tweetRepository) GetByUser(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error) {
+	const op = "tweet.GetByUser"
+	key := Key(op, userID, startDate, endDate, count, orderBy, cursor)
+	var r tweetsResult
+	if t.get(ctx, op, key, &r) {
+		if err := eachTweet(r.Tweets, each); err != nil {
+			return nil, err
+		}
+		return r.Page, nil
+	}
+	var tweets []*domain.Tweet
+	page, err := t.next.GetByUser(ctx, userID, startDate, endDate, count, orderBy, cursor, collectTweets(&tweets, count, each))
+	if err != nil {
+		return nil, err
+	}
+	t.set(ctx, op, key, t.policy.TTL(endDate), cacheable(cursor, page) && count <= maxCachedRows, &tweetsResult{Tweets: tweets, Page: page})
+	return page, nil
+}
+
+func (t *tweetRepository) GetByUsers(ctx context.Context, userIDs []uint64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error) {
+	const op = "tweet.GetByUsers"
+	key := Key(op, userIDs, startDate, endDate, count, orderBy, cursor)
+	var r tweetsResult
+	if t.get(ctx, op, key, &r) {
+		if err := eachTweet(r.Tweets, each); err != nil {
+			return nil, err
+		}
+		return r.Page, nil
+	}
+	var tweets []*domain.Tweet
+	page, err := t.next.GetByUsers(ctx, userIDs, startDate, endDate, count, orderBy, cursor, collectTweets(&tweets, count, each))
+	if err != nil {
+		return nil, err
+	}
+	t.set(ctx, op, key, t.policy.TTL(endDate), cacheable(cursor, page) && count <= maxCachedRows, &tweetsResult{Tweets: tweets, Page: page})
+	return page, nil
+}
+
+func (t *tweetRepository) GetByDomain(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, domainName string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, []*domain.URL, error) {
+	const op = "tweet.GetByDomain"
+	key := Key(op, userID, startDate, endDate, count, orderBy, domainName, cursor)
+	var r tweetsByDomainResult
+	if t.get(ctx, op, key, &r) {
+		if err := eachTweet(r.Tweets, each); err != nil {
+			return nil, nil, err
+		}
+		return r.Page, r.URLs, nil
+	}
+	var tweets []*domain.Tweet
+	page, urls, err := t.next.GetByDomain(ctx, userID, startDate, endDate, count, orderBy, domainName, cursor, collectTweets(&tweets, count, each))
+	if err != nil {
+		return nil, nil, err
+	}
+	t.set(ctx, op, key, t.policy.TTL(endDate), cacheable(cursor, page) && count <= maxCachedRows, &tweetsByDomainResult{Tweets: tweets, Page: page, URLs: urls})
+	return page, urls, nil
+}
+
+func (t *tweetRepository) GetByMediaType(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, mediaType int, cursor *domain.Cursor, each func(*domain.TweetMedia) error) (*domain.Page, []*domain.Media, error) {
+	const op = "tweet.GetByMediaType"
+	key := Key(op, userID, startDate, endDate, count, orderBy, mediaType, cursor)
+	var r tweetsByMediaResult
+	if t.get(ctx, op, key, &r) {
+		for _, tweet := range r.Tweets {
+			if err := each(tweet); err != nil {
+				return nil, nil, err
+			}
+		}
+		return r.Page, r.Media, nil
+	}
+	var tweets []*domain.TweetMedia
+	page, media, err := t.next.GetByMediaType(ctx, userID, startDate, endDate, count, orderBy, mediaType, cursor, collectTweetMedia(&tweets, count, each))
+	if err != nil {
+		return nil, nil, err
+	}
+	t.set(ctx, op, key, t.policy.TTL(endDate), cacheable(cursor, page) && count <= maxCachedRows, &tweetsByMediaResult{Tweets: tweets, Page: page, Media: media})
+	return page, media, nil
+}
+
+func (t *tweetRepository) Search(ctx context.Context, query *domain.SearchQuery, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error) {
+	const op = "tweet.Search"
+	key := Key(op, query, startDate, endDate, count, orderBy, cursor)
+	var r tweetsResult
+	if t.get(ctx, op, key, &r) {
+		if err := eachTweet(r.Tweets, each); err != nil {
+			return nil, err
+		}
+		return r.Page, nil
+	}
+	var tweets []*domain.Tweet
+	page, err := t.next.Search(ctx, query, startDate, endDate, count, orderBy, cursor, collectTweets(&tweets, count, each))
+	if err != nil {
+		return nil, err
+	}
+	t.set(ctx, op, key, t.policy.TTL(endDate), cacheable(cursor, page) && count <= maxCachedRows, &tweetsResult{Tweets: tweets, Page: page})
+	return page, nil
+}
+
+func (t *tweetRepository) HourlyCounts(ctx context.Context, userID uint64, startDate, endDate time.Time, loc *time.Location) ([]*domain.TweetHourlyCount, error) {
+	const op = "tweet.HourlyCounts"
+	key := Key(op, userID, startDate, endDate, loc.String())
+	var r []*domain.TweetHourlyCount
+	if t.get(ctx, op, key, &r) {
+		return r, nil
+	}
+	counts, err := t.next.HourlyCounts(ctx, userID, startDate, endDate, loc)
+	if err != nil {
+		return nil, err
+	}
+	t.set(ctx, op, key, t.policy.TTL(endDate), true, counts)
+	return counts, nil
+}
+
+func (t *tweetRepository) Stats(ctx context.Context, userID uint64, startDate, endDate time.Time) (*domain.TweetStats, error) {
+	const op = "tweet.Stats"
+	key := Key(op, userID, startDate, endDate)
+	var r domain.TweetStats
+	if t.get(ctx, op, key, &r) {
+		return &r, nil
+	}
+	stats, err := t.next.Stats(ctx, userID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	t.set(ctx, op, key, t.policy.TTL(endDate), true, stats)
+	return stats, nil
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"sns-api/domain"
+	"sns-api/logger"
+	"time"
+)
+
+type userRepository struct {
+	repositoryCache
+	next domain.UserRepository
+}
+
+// NewUserRepository caches the results of next in store.
+func NewUserRepository(logger logger.Logging, store Store, policy *Policy, next domain.UserRepository) *userRepository {
+	return &userRepository{
+		repositoryCache: repositoryCache{l: logger, store: store, policy: policy},
+		next:            next,
+	}
+}
+
+type userResult struct {
+	User *domain.User
+	Page *domain.Page
+}
+
+type usersResult struct {
+	Users []*domain.User
+	Page  *domain.Page
+}
+
+func (u *userRepository) Search(ctx context.Context, name, description, language string, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax int, srScoreMin, srScoreMax float64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.User) error) (*domain.Page, error) {
+	const op = "user.Search"
+	key := Key(op, name, description, language, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax, srScoreMin, srScoreMax, startDate, endDate, count, orderBy, cursor)
+	var r usersResult
+	if u.get(ctx, op, key, &r) {
+		if err := eachUser(r.Users, each); err != nil {
+			return nil, err
+		}
+		return r.Page, nil
+	}
+	var users []*domain.User
+	page, err := u.next.Search(ctx, name, description, language, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax, srScoreMin, srScoreMax, startDate, endDate, count, orderBy, cursor, collectUsers(&users, count, each))
+	if err != nil {
+		return nil, err
+	}
+	u.set(ctx, op, key, u.policy.TTL(endDate), cacheable(cursor, page) && count <= maxCachedRows, &usersResult{Users: users, Page: page})
+	return page, nil
+}
+
+func (u *userRepository) GetById(ctx context.Context, userID uint64, startDate, endDate time.Time) (*domain.User, *domain.Page, error) {
+	const op = "user.GetById"
+	key := Key(op, userID, startDate, endDate)
+	var r userResult
+	if u.get(ctx, op, key, &r) {
+		return r.User, r.Page, nil
+	}
+	user, page, err := u.next.GetById(ctx, userID, startDate, endDate)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.set(ctx, op, key, u.policy.TTL(endDate), true, &userResult{User: user, Page: page})
+	return user, page, nil
+}
+
+func (u *userRepository) GetByIds(ctx context.Context, userIDs []uint64, startDate, endDate time.Time, each func(*domain.User) error) (*domain.Page, error) {
+	const op = "user.GetByIds"
+	key := Key(op, userIDs, startDate, endDate)
+	var r usersResult
+	if u.get(ctx, op, key, &r) {
+		if err := eachUser(r.Users, each); err != nil {
+			return nil, err
+		}
+		return r.Page, nil
+	}
+	var users []*domain.User
+	page, err := u.next.GetByIds(ctx, userIDs, startDate, endDate, collectUsers(&users, len(userIDs), each))
+	if err != nil {
+		return nil, err
+	}
+	u.set(ctx, op, key, u.policy.TTL(endDate), len(userIDs) <= maxCachedRows, &usersResult{Users: users, Page: page})
+	return page, nil
+}
+
+// collectUsers passes every user on to each and keeps a copy of it for the cache, since the
+// callers localize the users they are handed. Pages of more than maxCachedRows are not kept.
+func collectUsers(users *[]*domain.User, count int, each func(*domain.User) error) func(*domain.User) error {
+	if count > maxCachedRows {
+		return each
+	}
+	return func(user *domain.User) error {
+		c := *user
+		*users = append(*users, &c)
+		return each(user)
+	}
+}
+
+// eachUser hands the cached users to each.
+func eachUser(users []*domain.User, each func(*domain.User) error) error {
+	for _, user := range users {
+		if err := each(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
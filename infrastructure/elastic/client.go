@@ -6,7 +6,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"net/http"
+	"net/url"
+	"sns-api/datetime"
+	"sns-api/domain"
+	"sns-api/infrastructure/elastic/query"
 	"sns-api/logger"
+	"sns-api/metrics"
+	"strings"
 	"time"
 )
 
@@ -15,104 +23,42 @@ var userIndex = "user"
 var urlIndex = "url"
 var mediaIndex = "media"
 
-func buildQuery(query *[]map[string]interface{}, value interface{}, attr, column string) {
-	var q map[string]interface{}
-	switch v := value.(type) {
-	case string:
-		if len(v) > 0 {
-			if attr == "created_at" {
-				q = map[string]interface{}{
-					"range": map[string]interface{}{
-						attr: map[string]interface{}{
-							column: v,
-						},
-					},
-				}
-			} else {
-				q = map[string]interface{}{
-					attr: map[string]interface{}{
-						column: v,
-					},
-				}
-			}
-			*query = append(*query, q)
-		}
-	case int:
-		if v > 0 || (column == "gte" && v >= 0) {
-			q = map[string]interface{}{
-				"range": map[string]interface{}{
-					attr: map[string]interface{}{
-						column: v,
-					},
-				},
-			}
-			*query = append(*query, q)
-		}
-	case float64:
-		if v > 0 {
-			q = map[string]interface{}{
-				"range": map[string]interface{}{
-					attr: map[string]interface{}{
-						column: v,
-					},
-				},
-			}
-			*query = append(*query, q)
-		}
-	case []int:
-		if len(v) > 0 {
-			q = map[string]interface{}{
-				attr: map[string]interface{}{
-					column: v,
-				},
-			}
-			*query = append(*query, q)
-		}
-	case []string:
-		if len(v) > 0 && column == "hashtag" && attr == "wildcard" {
-			size := len(v)
-			for i := 0; i < size; i++ {
-				q = map[string]interface{}{
-					attr: map[string]interface{}{
-						column: map[string]interface{}{
-							"value": fmt.Sprintf("%s%s%s", "*", v[i], "*"),
-						},
-					},
-				}
-				*query = append(*query, q)
-			}
-		} else if len(v) > 0 && column == "hashtag" && attr == "match" {
-			size := len(v)
-			for i := 0; i < size; i++ {
-				q = map[string]interface{}{
-					attr: map[string]interface{}{
-						column: v[i],
-					},
-				}
-				*query = append(*query, q)
-			}
-		} else if len(v) > 0 {
-			q = map[string]interface{}{
-				attr: map[string]interface{}{
-					column: v,
-				},
-			}
-			*query = append(*query, q)
-		}
+// pitKeepAlive is how long a point in time opened for cursor pagination stays valid between pages.
+var pitKeepAlive = "5m"
+
+// maxResultWindow is the largest from + size the cluster accepts (index.max_result_window).
+var maxResultWindow = 10000
+
+// maxBuckets is the largest terms aggregation the cluster accepts (search.max_buckets).
+var maxBuckets = 10000
+
+// countRange bounds a count field by min and max, where zero leaves that side open.
+func countRange(field string, min, max int) *query.RangeQuery {
+	r := query.Range(field)
+	if min > 0 {
+		r.Gte(min)
+	}
+	if max > 0 {
+		r.Lte(max)
 	}
+	return r
 }
 
-func buildIndexByTimeAdd(index string, t time.Time, num int) []string {
-	var m []string
-	if num == 0 {
-		m = append(m, fmt.Sprintf("%v-%v.%02v", index, t.Year(), int(t.Month())))
-	} else {
-		for i := 0; i <= num; i++ {
-			d := t.AddDate(0, i, 0)
-			m = append(m, fmt.Sprintf("%v-%v.%02v", index, d.Year(), int(d.Month())))
-		}
+// scoreRange is countRange for fractional fields.
+func scoreRange(field string, min, max float64) *query.RangeQuery {
+	r := query.Range(field)
+	if min > 0 {
+		r.Gte(min)
+	}
+	if max > 0 {
+		r.Lte(max)
 	}
-	return m
+	return r
+}
+
+// IndexSpan returns how many monthly indices a search between startDate and endDate fans out to.
+func IndexSpan(startDate, endDate time.Time) int {
+	return monthDiff(startDate, endDate) + 1
 }
 
 func monthDiff(t1, t2 time.Time) int {
@@ -174,60 +120,229 @@ func encodeQuery(buf *bytes.Buffer, query map[string]interface{}) error {
 	return nil
 }
 
-func search(ctx context.Context, l logger.Logging, es *elasticsearch.Client, index string, buf *bytes.Buffer, size int) (map[string]interface{}, error) {
-	var r map[string]interface{}
+// indexPattern collapses a comma separated list of monthly indices such as sns-2020.01,sns-2020.02
+// into sns-* so that metric labels do not grow with every requested period.
+func indexPattern(index string) string {
+	if index == "" {
+		return "_pit"
+	}
+	var patterns []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(index, ",") {
+		if i := strings.LastIndex(name, "-"); i >= 0 {
+			name = name[:i] + "-*"
+		}
+		if !seen[name] {
+			seen[name] = true
+			patterns = append(patterns, name)
+		}
+	}
+	return strings.Join(patterns, ",")
+}
 
-	res, err := es.Search(
+// search runs one search and records it under op, the repository method that issued it.
+func search(ctx context.Context, l logger.Logging, es *elasticsearch.Client, op, index string, buf *bytes.Buffer, size int) (*searchResponse, error) {
+	return searchEach(ctx, l, es, op, index, buf, size, nil)
+}
+
+// searchEach runs one search like search, handing every hit to each as it is decoded instead of
+// keeping it when each is not nil. An error of each stops the search and is returned.
+func searchEach(ctx context.Context, l logger.Logging, es *elasticsearch.Client, op, index string, buf *bytes.Buffer, size int, each func(*searchHit) error) (r *searchResponse, err error) {
+	pattern := indexPattern(index)
+	start := time.Now()
+	defer func() {
+		metrics.ObserveSearch(op, pattern, len(strings.Split(index, ",")), time.Since(start), err)
+	}()
+
+	opts := []func(*esapi.SearchRequest){
 		es.Search.WithContext(ctx),
-		es.Search.WithIndex(index),
 		es.Search.WithBody(buf),
 		es.Search.WithSize(size),
 		es.Search.WithTrackTotalHits(true),
 		//es.Search.WithPretty(),
-	)
+	}
+	// searches on a point in time must not name an index; the catalog may name indices that
+	// do not exist yet or were deleted since it was loaded, which then hold no documents
+	if index != "" {
+		opts = append(opts, es.Search.WithIndex(index), es.Search.WithIgnoreUnavailable(true))
+	}
+	res, err := es.Search(opts...)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
-		var e map[string]interface{}
+		var e errorResponse
 		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-			return nil, err
-		} else {
-			l.Errorf(fmt.Sprintf("[%s] %s: %s",
-				res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"],
-			))
-			return nil, err
+			return nil, fmt.Errorf("[%s] failed to decode error response: %s", res.Status(), err)
 		}
+		l.Errorf(fmt.Sprintf("[%s] %s: %s", res.Status(), e.Error.Type, e.Error.Reason))
+		return nil, fmt.Errorf("[%s] %s: %s", res.Status(), e.Error.Type, e.Error.Reason)
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+	r, err = decodeSearchResponse(res.Body, each)
+	if err != nil {
 		return nil, err
 	}
 
-	l.Infof(fmt.Sprintf("[%s] %d hits; took: %dms",
-		res.Status(),
-		int(r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64)),
-		int(r["took"].(float64)),
-	))
+	l.Infof(fmt.Sprintf("%s [%s] %d hits; took: %dms", op, res.Status(), r.Hits.Total.Value, r.Took))
+	metrics.ObserveSearchResponse(op, pattern, r.Took, r.Hits.Total.Value)
 
 	return r, nil
 }
 
-func convertTime(timeStr string) (string, error) {
-	layout := "2006-01-02 15:04:05"
-	def := "2006-01-01 00:00:00"
-	loc, err := time.LoadLocation("Asia/Tokyo")
+// openPointInTime opens a point in time on index and returns its id.
+// Clusters older than 7.10 do not know the endpoint; an empty id is returned for them.
+func openPointInTime(ctx context.Context, l logger.Logging, es *elasticsearch.Client, index string) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/%s/_pit?keep_alive=%s", url.PathEscape(index), pitKeepAlive), nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := es.Perform(req.WithContext(ctx))
 	if err != nil {
-		return def, err
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		l.Infof(fmt.Sprintf("point in time is not available for %s: %s", index, res.Status))
+		return "", nil
+	}
+	var r struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return "", err
+	}
+	return r.ID, nil
+}
+
+// applyCursor makes query continue after cursor and returns the index to search.
+// The first follow-up page opens a point in time, if available, so that the rest
+// of the walk reads one consistent snapshot.
+// search_after cannot be combined with collapse; collapsed queries page by applyOffsetCursor.
+func applyCursor(ctx context.Context, l logger.Logging, es *elasticsearch.Client, query map[string]interface{}, index string, cursor *domain.Cursor) string {
+	if cursor == nil {
+		return index
+	}
+	query["search_after"] = cursor.SearchAfter
+	return usePointInTime(ctx, l, es, query, index, cursor.PitID)
+}
+
+// applyOffsetCursor makes the collapsed query continue at the offset of cursor and returns the
+// index to search and the offset. Every page of a walk is collapsed the same way, and the walk
+// reads one point in time from the first follow-up page on, as with applyCursor.
+func applyOffsetCursor(ctx context.Context, l logger.Logging, es *elasticsearch.Client, query map[string]interface{}, index string, cursor *domain.Cursor) (string, int) {
+	if cursor == nil {
+		return index, 0
+	}
+	query["from"] = cursor.Offset
+	return usePointInTime(ctx, l, es, query, index, cursor.PitID), cursor.Offset
+}
+
+// usePointInTime makes query search the point in time pitID, opening one on index when pitID
+// is empty, and returns the index to search.
+func usePointInTime(ctx context.Context, l logger.Logging, es *elasticsearch.Client, query map[string]interface{}, index, pitID string) string {
+	if pitID == "" {
+		id, err := openPointInTime(ctx, l, es, index)
+		if err != nil {
+			l.Warnf(fmt.Sprintf("failed to open point in time: %s", err))
+		}
+		pitID = id
+	}
+	if pitID == "" {
+		return index
 	}
+	query["pit"] = map[string]interface{}{
+		"id":         pitID,
+		"keep_alive": pitKeepAlive,
+	}
+	return ""
+}
+
+// nextCursor returns the position after the last hit of r, or nil when r is the last page.
+func nextCursor(r *searchResponse, size int) *domain.Cursor {
+	if size <= 0 || r.returned < size || len(r.last.Sort) == 0 {
+		return nil
+	}
+	return &domain.Cursor{SearchAfter: r.last.Sort, PitID: r.PitID}
+}
+
+// offsetPageSize returns the size of the page at offset, shortened so that the page ends
+// within the result window.
+func offsetPageSize(offset, count int) int {
+	if offset >= maxResultWindow {
+		return 0
+	}
+	if offset+count > maxResultWindow {
+		return maxResultWindow - offset
+	}
+	return count
+}
 
-	t, err := time.ParseInLocation(layout, timeStr, time.UTC)
+// nextOffsetCursor returns the offset after the hits of r read at offset, or nil when r is
+// the last page or the result window ends there.
+func nextOffsetCursor(r *searchResponse, offset, size int) *domain.Cursor {
+	next := offset + r.returned
+	if size <= 0 || r.returned < size || next >= maxResultWindow {
+		return nil
+	}
+	return &domain.Cursor{Offset: next, PitID: r.PitID}
+}
+
+// logWarnings summarises the schema violations found while decoding a response.
+func logWarnings(l logger.Logging, op string, warnings []*domain.Warning) {
+	if len(warnings) == 0 {
+		return
+	}
+	w := warnings[0]
+	l.Warnf(fmt.Sprintf("%s: %d schema warnings, first: %s/%s %s: %s", op, len(warnings), w.Index, w.ID, w.Field, w.Reason))
+}
+
+// bucketPage returns the terms aggregation size and bucket_sort clause serving one page of
+// count buckets starting at cursor.
+func bucketPage(cursor *domain.Cursor, count int) (int, int, *query.BucketSortAggregation) {
+	offset := 0
+	if cursor != nil {
+		offset = cursor.Offset
+	}
+	size := offset + count
+	if size > maxBuckets {
+		size = maxBuckets
+	}
+	return offset, size, query.BucketSort(offset, count)
+}
+
+// nextBucketCursor returns the cursor of the page after the buckets at offset, or nil
+// when the page was the last one. The distinct count is an estimate, so the end is
+// detected by a short page instead.
+func nextBucketCursor(offset, count, returned int) *domain.Cursor {
+	next := offset + count
+	if returned < count || next >= maxBuckets {
+		return nil
+	}
+	return &domain.Cursor{Offset: next}
+}
+
+// normalizeTime checks that timeStr is a time of the stored layout and returns it as it is, in UTC.
+// The usecases render it in the zone of the request.
+func normalizeTime(timeStr string) (string, error) {
+	t, err := time.Parse(datetime.Second, timeStr)
 	if err != nil {
-		return def, err
+		return "", err
+	}
+	return t.Format(datetime.Second), nil
+}
+
+// regexpQuote escapes the characters Lucene regular expressions reserve.
+func regexpQuote(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`.?+*|{}[]()"\#@&<>~`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
 	}
-	return t.In(loc).Format(layout), nil
+	return b.String()
 }
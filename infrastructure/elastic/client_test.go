@@ -2,11 +2,12 @@ package elastic
 
 import (
 	"reflect"
+	"sns-api/domain"
 	"testing"
 	"time"
 )
 
-func Test_convertTime(t *testing.T) {
+func Test_normalizeTime(t *testing.T) {
 	type args struct {
 		timeStr string
 	}
@@ -16,16 +17,18 @@ func Test_convertTime(t *testing.T) {
 		want    string
 		wantErr bool
 	}{
+		{name: "UTCのまま", args: args{timeStr: "2020-12-31 20:30:00"}, want: "2020-12-31 20:30:00"},
+		{name: "不正な形式", args: args{timeStr: "2020/12/31"}, wantErr: true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := convertTime(tt.args.timeStr)
+			got, err := normalizeTime(tt.args.timeStr)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("convertTime() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("normalizeTime() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if got != tt.want {
-				t.Errorf("convertTime() got = %v, want %v", got, tt.want)
+				t.Errorf("normalizeTime() got = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -145,45 +148,62 @@ func Test_monthDiff(t *testing.T) {
 	}
 }
 
-func Test_buildIndexByTimeAdd(t *testing.T) {
-	type args struct {
-		t   time.Time
-		num int
+func Test_indexPattern(t *testing.T) {
+	tests := []struct {
+		name  string
+		index string
+		want  string
+	}{
+		{name: "月次インデックス", index: "sns-2020.01,sns-2020.02,sns-2020.03", want: "sns-*"},
+		{name: "単一インデックス", index: "user-2020.01", want: "user-*"},
+		{name: "ワイルドカード", index: "url-*", want: "url-*"},
+		{name: "ポイントインタイム", index: "", want: "_pit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := indexPattern(tt.index); got != tt.want {
+				t.Errorf("indexPattern() = %v, want %v", got, tt.want)
+			}
+		})
 	}
+}
+
+func Test_regexpQuote(t *testing.T) {
 	tests := []struct {
 		name string
-		args args
-		want []string
+		s    string
+		want string
 	}{
-		{
-			name: "年を跨ぐケース",
-			args: args{
-				t:   time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC),
-				num: 2,
-			},
-			want: []string{"sns-2016.01", "sns-2016.02", "sns-2016.03"},
-		},
-		{
-			name: "年を跨ぐケース",
-			args: args{
-				t:   time.Date(2016, 11, 1, 0, 0, 0, 0, time.UTC),
-				num: 3,
-			},
-			want: []string{"sns-2016.11", "sns-2016.12", "sns-2017.01", "sns-2017.02"},
-		},
-		{
-			name: "同年同月のケース",
-			args: args{
-				t:   time.Date(2016, 9, 1, 0, 0, 0, 0, time.UTC),
-				num: 0,
-			},
-			want: []string{"sns-2016.09"},
-		},
+		{name: "そのまま", s: "コロナ", want: "コロナ"},
+		{name: "予約文字", s: "c++ (v1.0)", want: `c\+\+ \(v1\.0\)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := regexpQuote(tt.s); got != tt.want {
+				t.Errorf("regexpQuote() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_nextOffsetCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int
+		size   int
+		hits   int
+		want   *domain.Cursor
+	}{
+		{name: "続きがある", offset: 20, size: 10, hits: 10, want: &domain.Cursor{Offset: 30, PitID: "pit"}},
+		{name: "最後のページ", offset: 20, size: 10, hits: 3, want: nil},
+		{name: "取得上限に達した", offset: 9990, size: 10, hits: 10, want: nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := buildIndexByTimeAdd(tweetIndex, tt.args.t, tt.args.num); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("buildIndexByTimeAdd() = %v, want %v", got, tt.want)
+			r := &searchResponse{PitID: "pit"}
+			r.returned = tt.hits
+			if got := nextOffsetCursor(r, tt.offset, tt.size); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nextOffsetCursor() = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
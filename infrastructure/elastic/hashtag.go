@@ -6,202 +6,690 @@ import (
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v7"
 	"sns-api/domain"
+	"sns-api/infrastructure/elastic/query"
 	"sns-api/logger"
 	"strings"
 	"time"
 )
 
 type hashtagRepository struct {
-	l  logger.Logging
-	es *elasticsearch.Client
+	l       logger.Logging
+	es      *elasticsearch.Client
+	indices *IndexCatalog
 }
 
-func NewHashtagRepository(logger logger.Logging, conn *elasticsearch.Client) *hashtagRepository {
+func NewHashtagRepository(logger logger.Logging, conn *elasticsearch.Client, indices *IndexCatalog) *hashtagRepository {
 	return &hashtagRepository{
-		l:  logger,
-		es: conn,
+		l:       logger,
+		es:      conn,
+		indices: indices,
 	}
 }
 
-func (t *hashtagRepository) Get(keyword string, hashtag []string, tweetType []int, retweetMin, retweetMax, quoteMin, quoteMax, favoriteMin, favoriteMax int, userInclude, userExclude, hashtagInclude, hashtagExclude []string, userFollowerMin, userFollowerMax, userStatusMin, userStatusMax, count int, startDate, endDate time.Time) ([]*domain.Hashtag, int, error) {
+// hashtagAggregations is the aggregations part of the hashtag ranking responses.
+type hashtagAggregations struct {
+	DistinctHashtagCount valueAggregation `json:"distinct_hashtag_count"`
+	GroupByHashtag       struct {
+		Buckets []*hashtagBucket `json:"buckets"`
+	} `json:"group_by_hashtag"`
+}
+
+type hashtagBucket struct {
+	Key string `json:"key"`
+	hashtagMetrics
+}
+
+// hashtagsByNameAggregations is the aggregations part of GetByName.
+type hashtagsByNameAggregations struct {
+	GroupByHashtag struct {
+		AfterKey map[string]interface{} `json:"after_key"`
+		Buckets  []*struct {
+			Key struct {
+				Hashtag string `json:"hashtag"`
+			} `json:"key"`
+			hashtagMetrics
+		} `json:"buckets"`
+	} `json:"group_by_hashtag"`
+}
+
+// hashtagMetrics are the engagement statistics computed for every hashtag bucket.
+type hashtagMetrics struct {
+	DocCount    uint64           `json:"doc_count"`
+	RetweetAvg  valueAggregation `json:"retweet_avg"`
+	RetweetSum  valueAggregation `json:"retweet_sum"`
+	FavoriteAvg valueAggregation `json:"favorite_avg"`
+	FavoriteSum valueAggregation `json:"favorite_sum"`
+	ReplyAvg    valueAggregation `json:"reply_avg"`
+	ReplySum    valueAggregation `json:"reply_sum"`
+	QuoteAvg    valueAggregation `json:"quote_avg"`
+	QuoteSum    valueAggregation `json:"quote_sum"`
+}
+
+// hashtagTimeseriesAggregations is the aggregations part of the hashtag time series responses.
+type hashtagTimeseriesAggregations struct {
+	GroupByHashtag struct {
+		Buckets []struct {
+			Key       string `json:"key"`
+			Histogram struct {
+				Buckets []*hashtagHistogramBucket `json:"buckets"`
+			} `json:"histogram"`
+		} `json:"buckets"`
+	} `json:"group_by_hashtag"`
+}
+
+type hashtagHistogramBucket struct {
+	KeyAsString string `json:"key_as_string"`
+	hashtagMetrics
+}
+
+// histogramDateFormat renders the histogram keys like the created_at values of the tweet index.
+const histogramDateFormat = "yyyy-MM-dd HH:mm:ss"
+
+var hashtagIntervals = map[domain.HashtagInterval]struct {
+	calendar string
+	length   time.Duration
+}{
+	domain.HashtagIntervalHour: {"1h", time.Hour},
+	domain.HashtagIntervalDay:  {"1d", 24 * time.Hour},
+	domain.HashtagIntervalWeek: {"1w", 7 * 24 * time.Hour},
+}
+
+// hashtagMetricAggregations are the sub aggregations decoded into hashtagMetrics.
+func hashtagMetricAggregations() map[string]query.Aggregation {
+	return map[string]query.Aggregation{
+		"retweet_avg":  query.Avg("retweet_count"),
+		"retweet_sum":  query.Sum("retweet_count"),
+		"favorite_avg": query.Avg("favorite_count"),
+		"favorite_sum": query.Sum("favorite_count"),
+		"quote_avg":    query.Avg("quote_count"),
+		"quote_sum":    query.Sum("quote_count"),
+		"reply_avg":    query.Avg("reply_count"),
+		"reply_sum":    query.Sum("reply_count"),
+	}
+}
+
+// hashtag returns the statistics of the bucket of key.
+func (m *hashtagMetrics) hashtag(key string) *domain.Hashtag {
+	return &domain.Hashtag{
+		Hashtag:       key,
+		StatusCount:   m.DocCount,
+		RetweetAvg:    m.RetweetAvg.Value,
+		RetweetCount:  uint64(m.RetweetSum.Value),
+		FavoriteAvg:   m.FavoriteAvg.Value,
+		FavoriteCount: uint64(m.FavoriteSum.Value),
+		ReplyAvg:      m.ReplyAvg.Value,
+		ReplyCount:    uint64(m.ReplySum.Value),
+		QuoteAvg:      m.QuoteAvg.Value,
+		QuoteCount:    uint64(m.QuoteSum.Value),
+	}
+}
+
+// hashtagFilterQuery selects the tweets matching f.
+func hashtagFilterQuery(f *domain.HashtagFilter) *query.BoolQuery {
+	q := query.Bool().
+		Must(
+			query.MatchPhrase("tweet", f.Keyword),
+			query.Terms("tweet_type", f.TweetType),
+			countRange("retweet_count", f.RetweetMin, f.RetweetMax),
+			countRange("quote_count", f.QuoteMin, f.QuoteMax),
+			countRange("favorite_count", f.FavoriteMin, f.FavoriteMax),
+			query.Terms("user_screen_name", f.UserInclude),
+			countRange("user_followers_count", f.UserFollowerMin, f.UserFollowerMax),
+			countRange("user_statuses_count", f.UserStatusMin, f.UserStatusMax),
+			query.Range("created_at").Gte(f.StartDate.Format("2006-01-02 15:04:00")).Lte(f.EndDate.Format("2006-01-02 15:04:59")),
+		).
+		MustNot(query.Terms("user_screen_name", f.UserExclude))
+	for _, h := range f.Hashtag {
+		q.Must(query.Wildcard("hashtag", fmt.Sprintf("*%s*", h)))
+	}
+	for _, h := range f.HashtagInclude {
+		q.Must(query.Match("hashtag", h))
+	}
+	for _, h := range f.HashtagExclude {
+		q.MustNot(query.Match("hashtag", h))
+	}
+	return q
+}
+
+// filterIndex returns the indices covering the range of f.
+func (t *hashtagRepository) filterIndex(f *domain.HashtagFilter) string {
+	return t.indices.Index(tweetIndex, f.StartDate, f.EndDate)
+}
+
+func (t *hashtagRepository) Get(ctx context.Context, filter *domain.HashtagFilter, count int, cursor *domain.Cursor) ([]*domain.Hashtag, *domain.Page, error) {
 	var buf bytes.Buffer
 	var hashtags []*domain.Hashtag
-	ctx := context.Background()
-	var mustQuery []map[string]interface{}
-	var mustNotQuery []map[string]interface{}
-
-	buildQuery(&mustQuery, keyword, "match_phrase", "tweet")
-	buildQuery(&mustQuery, hashtag, "wildcard", "hashtag")
-	buildQuery(&mustQuery, tweetType, "terms", "tweet_type")
-	buildQuery(&mustQuery, retweetMin, "retweet_count", "gte")
-	buildQuery(&mustQuery, retweetMax, "retweet_count", "lte")
-	buildQuery(&mustQuery, quoteMin, "quote_count", "gte")
-	buildQuery(&mustQuery, quoteMax, "quote_count", "lte")
-	buildQuery(&mustQuery, favoriteMin, "favorite_count", "gte")
-	buildQuery(&mustQuery, favoriteMax, "favorite_count", "lte")
-	buildQuery(&mustQuery, userInclude, "terms", "user_screen_name")
-	buildQuery(&mustQuery, hashtagInclude, "match", "hashtag")
-	buildQuery(&mustQuery, userFollowerMin, "user_followers_count", "gte")
-	buildQuery(&mustQuery, userFollowerMax, "user_followers_count", "lte")
-	buildQuery(&mustQuery, userStatusMin, "user_statuses_count", "gte")
-	buildQuery(&mustQuery, userStatusMax, "user_statuses_count", "lte")
-	buildQuery(&mustQuery, startDate, "created_at", "gte")
-	buildQuery(&mustQuery, endDate, "created_at", "lte")
-	buildQuery(&mustNotQuery, userExclude, "terms", "user_screen_name")
-	buildQuery(&mustNotQuery, hashtagExclude, "match", "hashtag")
-
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must":     mustQuery,
-				"must_not": mustNotQuery,
-			},
-		},
-		"aggs": map[string]interface{}{
-			"distinct_hashtag_count": map[string]interface{}{
-				"cardinality": map[string]interface{}{
-					"field":               "hashtag",
-					"precision_threshold": count,
-				},
-			},
-			"group_by_hashtag": map[string]interface{}{
-				"terms": map[string]interface{}{
-					"field": "hashtag",
-					"order": map[string]interface{}{
-						"_count": "desc",
-					},
-					"size": count,
-				},
-				"aggs": map[string]interface{}{
-					"retweet_avg": map[string]interface{}{
-						"avg": map[string]interface{}{
-							"field": "retweet_count",
-						},
-					},
-					"retweet_sum": map[string]interface{}{
-						"sum": map[string]interface{}{
-							"field": "retweet_count",
-						},
-					},
-					"favorite_avg": map[string]interface{}{
-						"avg": map[string]interface{}{
-							"field": "favorite_count",
-						},
-					},
-					"favorite_sum": map[string]interface{}{
-						"sum": map[string]interface{}{
-							"field": "favorite_count",
-						},
-					},
-					"quote_avg": map[string]interface{}{
-						"avg": map[string]interface{}{
-							"field": "quote_count",
-						},
-					},
-					"quote_sum": map[string]interface{}{
-						"sum": map[string]interface{}{
-							"field": "quote_count",
-						},
-					},
-					"reply_avg": map[string]interface{}{
-						"avg": map[string]interface{}{
-							"field": "reply_count",
-						},
-					},
-					"reply_sum": map[string]interface{}{
-						"sum": map[string]interface{}{
-							"field": "reply_count",
-						},
-					},
-				},
-			},
-		},
-	}
-
-	if err := encodeQuery(&buf, query); err != nil {
+
+	offset, size, page := bucketPage(cursor, count)
+	groupByHashtag := query.TermsAgg("hashtag").
+		Order("_count", "desc").
+		Order("_key", "asc").
+		Size(size)
+	for name, sub := range hashtagMetricAggregations() {
+		groupByHashtag.SubAggregation(name, sub)
+	}
+	groupByHashtag.SubAggregation("page", page)
+
+	body := map[string]interface{}{
+		"query": query.Root(hashtagFilterQuery(filter)),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"distinct_hashtag_count": query.Cardinality("hashtag").PrecisionThreshold(count),
+			"group_by_hashtag":       groupByHashtag,
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
-		return nil, 0, err
+		return nil, nil, err
 	}
 
-	mDiff := monthDiff(startDate, endDate)
-	monthList := buildIndexByTimeAdd(tweetIndex, startDate, mDiff)
-	r, err := search(ctx, t.l, t.es, strings.Join(monthList, ","), &buf, 0)
+	r, err := search(ctx, t.l, t.es, "hashtag.Get", t.filterIndex(filter), &buf, 0)
 	if err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
-		return nil, 0, err
-	}
-
-	hits := int(r["aggregations"].(map[string]interface{})["distinct_hashtag_count"].(map[string]interface{})["value"].(float64))
-	for _, agg := range r["aggregations"].(map[string]interface{})["group_by_hashtag"].(map[string]interface{})["buckets"].([]interface{}) {
-		hashtag := domain.Hashtag{
-			Hashtag:       agg.(map[string]interface{})["key"].(string),
-			StatusCount:   uint64(agg.(map[string]interface{})["doc_count"].(float64)),
-			RetweetAvg:    agg.(map[string]interface{})["retweet_avg"].(map[string]interface{})["value"].(float64),
-			RetweetCount:  uint64(agg.(map[string]interface{})["retweet_sum"].(map[string]interface{})["value"].(float64)),
-			FavoriteAvg:   agg.(map[string]interface{})["favorite_avg"].(map[string]interface{})["value"].(float64),
-			FavoriteCount: uint64(agg.(map[string]interface{})["favorite_sum"].(map[string]interface{})["value"].(float64)),
-			ReplyAvg:      agg.(map[string]interface{})["reply_avg"].(map[string]interface{})["value"].(float64),
-			ReplyCount:    uint64(agg.(map[string]interface{})["reply_sum"].(map[string]interface{})["value"].(float64)),
-			QuoteAvg:      agg.(map[string]interface{})["quote_avg"].(map[string]interface{})["value"].(float64),
-			QuoteCount:    uint64(agg.(map[string]interface{})["quote_sum"].(map[string]interface{})["value"].(float64)),
-		}
-		hashtags = append(hashtags, &hashtag)
+		return nil, nil, err
+	}
+
+	var aggs hashtagAggregations
+	if err := r.decodeAggregations(&aggs); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, nil, err
 	}
-	return hashtags, hits, nil
+	buckets := aggs.GroupByHashtag.Buckets
+	for _, b := range buckets {
+		hashtags = append(hashtags, b.hashtag(b.Key))
+	}
+	return hashtags, &domain.Page{
+		Hits:       int(aggs.DistinctHashtagCount.Value),
+		NextCursor: nextBucketCursor(offset, count, len(buckets)),
+	}, nil
 }
 
-func (t *hashtagRepository) Search(hashtag string, startDate, endDate time.Time, count int) ([]*domain.HashtagBySearch, int, error) {
+// GetByName pages through the hashtags of filter in the order of their names with a composite
+// aggregation, which unlike the ranking of Get reaches every hashtag. The hits are not counted.
+func (t *hashtagRepository) GetByName(ctx context.Context, filter *domain.HashtagFilter, count int, cursor *domain.Cursor) ([]*domain.Hashtag, *domain.Page, error) {
+	var buf bytes.Buffer
+	var hashtags []*domain.Hashtag
+
+	groupByHashtag := query.Composite(count).TermsSource("hashtag", "hashtag")
+	if cursor != nil && len(cursor.SearchAfter) == 1 {
+		groupByHashtag.After(map[string]interface{}{"hashtag": cursor.SearchAfter[0]})
+	}
+	for name, sub := range hashtagMetricAggregations() {
+		groupByHashtag.SubAggregation(name, sub)
+	}
+
+	body := map[string]interface{}{
+		"query": query.Root(hashtagFilterQuery(filter)),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"group_by_hashtag": groupByHashtag,
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
+		return nil, nil, err
+	}
+
+	r, err := search(ctx, t.l, t.es, "hashtag.GetByName", t.filterIndex(filter), &buf, 0)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
+		return nil, nil, err
+	}
+
+	var aggs hashtagsByNameAggregations
+	if err := r.decodeAggregations(&aggs); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, nil, err
+	}
+	for _, b := range aggs.GroupByHashtag.Buckets {
+		hashtags = append(hashtags, b.hashtag(b.Key.Hashtag))
+	}
+	page := &domain.Page{}
+	if after, ok := aggs.GroupByHashtag.AfterKey["hashtag"]; ok && len(hashtags) == count {
+		page.NextCursor = &domain.Cursor{SearchAfter: []interface{}{after}}
+	}
+	return hashtags, page, nil
+}
+
+func (t *hashtagRepository) Search(ctx context.Context, hashtag string, startDate, endDate time.Time, count int, cursor *domain.Cursor) ([]*domain.HashtagBySearch, *domain.Page, error) {
 	var buf bytes.Buffer
 	var hashtags []*domain.HashtagBySearch
-	ctx := context.Background()
-	var mustQuery []map[string]interface{}
-
-	buildQuery(&mustQuery, hashtag, "wildcard", "hashtag")
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must":     mustQuery,
-			},
-		},
-		"aggs": map[string]interface{}{
-			"distinct_hashtag_count": map[string]interface{}{
-				"cardinality": map[string]interface{}{
-					"field":               "hashtag",
-					"precision_threshold": count,
-				},
-			},
-			"group_by_hashtag": map[string]interface{}{
-				"terms": map[string]interface{}{
-					"field": "hashtag",
-					"order": map[string]interface{}{
-						"_count": "desc",
-					},
-					"size": count,
-				},
-			},
-		},
-	}
-
-	if err := encodeQuery(&buf, query); err != nil {
+
+	q := query.Bool().Must(query.Wildcard("hashtag", hashtag))
+	offset, size, page := bucketPage(cursor, count)
+	body := map[string]interface{}{
+		"query": query.Root(q),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"distinct_hashtag_count": query.Cardinality("hashtag").PrecisionThreshold(count),
+			"group_by_hashtag": query.TermsAgg("hashtag").
+				Order("_count", "desc").
+				Order("_key", "asc").
+				Size(size).
+				SubAggregation("page", page),
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
-		return nil, 0, err
+		return nil, nil, err
 	}
 
-	mDiff := monthDiff(startDate, endDate)
-	monthList := buildIndexByTimeAdd(tweetIndex, startDate, mDiff)
-	r, err := search(ctx, t.l, t.es, strings.Join(monthList, ","), &buf, 0)
+	index := t.indices.Index(tweetIndex, startDate, endDate)
+	r, err := search(ctx, t.l, t.es, "hashtag.Search", index, &buf, 0)
 	if err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
-		return nil, 0, err
+		return nil, nil, err
 	}
 
-	hits := int(r["aggregations"].(map[string]interface{})["distinct_hashtag_count"].(map[string]interface{})["value"].(float64))
-	for _, agg := range r["aggregations"].(map[string]interface{})["group_by_hashtag"].(map[string]interface{})["buckets"].([]interface{}) {
+	var aggs hashtagAggregations
+	if err := r.decodeAggregations(&aggs); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, nil, err
+	}
+	buckets := aggs.GroupByHashtag.Buckets
+	for _, b := range buckets {
 		hashtag := domain.HashtagBySearch{
-			Hashtag:       agg.(map[string]interface{})["key"].(string),
-			StatusCount:   uint64(agg.(map[string]interface{})["doc_count"].(float64)),
+			Hashtag:     b.Key,
+			StatusCount: b.DocCount,
 		}
 		hashtags = append(hashtags, &hashtag)
 	}
-	return hashtags, hits, nil
+	return hashtags, &domain.Page{
+		Hits:       int(aggs.DistinctHashtagCount.Value),
+		NextCursor: nextBucketCursor(offset, count, len(buckets)),
+	}, nil
+}
+
+// Timeseries returns one series per hashtag, in the order given, with a bucket for every interval
+// of the filter's range. Hashtags without any matching tweet get a series without buckets.
+func (t *hashtagRepository) Timeseries(ctx context.Context, hashtags []string, filter *domain.HashtagFilter, interval domain.HashtagInterval) ([]*domain.HashtagTimeseries, error) {
+	var buf bytes.Buffer
+
+	iv, ok := hashtagIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("unknown interval: %s", interval)
+	}
+	if n := (int(filter.EndDate.Sub(filter.StartDate)/iv.length) + 1) * len(hashtags); n > maxBuckets {
+		return nil, domain.ErrTooManyBuckets
+	}
+
+	histogram := query.DateHistogram("created_at", iv.calendar).
+		Format(histogramDateFormat).
+		MinDocCount(0).
+		ExtendedBounds(filter.StartDate.Format("2006-01-02 15:04:00"), filter.EndDate.Format("2006-01-02 15:04:59"))
+	for name, sub := range hashtagMetricAggregations() {
+		histogram.SubAggregation(name, sub)
+	}
+
+	q := hashtagFilterQuery(filter).Filter(query.Terms("hashtag", hashtags))
+	body := map[string]interface{}{
+		"query": query.Root(q),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"group_by_hashtag": query.TermsAgg("hashtag").
+				Include(hashtags...).
+				Size(len(hashtags)).
+				SubAggregation("histogram", histogram),
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
+		return nil, err
+	}
+
+	r, err := search(ctx, t.l, t.es, "hashtag.Timeseries", t.filterIndex(filter), &buf, 0)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
+		return nil, err
+	}
+
+	var aggs hashtagTimeseriesAggregations
+	if err := r.decodeAggregations(&aggs); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, err
+	}
+	byHashtag := map[string][]*domain.HashtagBucket{}
+	for _, hb := range aggs.GroupByHashtag.Buckets {
+		buckets := make([]*domain.HashtagBucket, 0, len(hb.Histogram.Buckets))
+		for _, b := range hb.Histogram.Buckets {
+			buckets = append(buckets, &domain.HashtagBucket{
+				Date:          b.KeyAsString,
+				StatusCount:   b.DocCount,
+				RetweetAvg:    b.RetweetAvg.Value,
+				RetweetCount:  uint64(b.RetweetSum.Value),
+				FavoriteAvg:   b.FavoriteAvg.Value,
+				FavoriteCount: uint64(b.FavoriteSum.Value),
+				ReplyAvg:      b.ReplyAvg.Value,
+				ReplyCount:    uint64(b.ReplySum.Value),
+				QuoteAvg:      b.QuoteAvg.Value,
+				QuoteCount:    uint64(b.QuoteSum.Value),
+			})
+		}
+		byHashtag[hb.Key] = buckets
+	}
+	series := make([]*domain.HashtagTimeseries, 0, len(hashtags))
+	for _, h := range hashtags {
+		buckets, ok := byHashtag[h]
+		if !ok {
+			buckets = []*domain.HashtagBucket{}
+		}
+		series = append(series, &domain.HashtagTimeseries{Hashtag: h, Buckets: buckets})
+	}
+	return series, nil
+}
+
+// hashtagTrendingAggregations is the aggregations part of the trending hashtag responses.
+type hashtagTrendingAggregations struct {
+	Target struct {
+		DocCount uint64 `json:"doc_count"`
+	} `json:"target"`
+	GroupByHashtag struct {
+		Buckets []struct {
+			Key      string `json:"key"`
+			DocCount uint64 `json:"doc_count"`
+			Target   struct {
+				DocCount uint64 `json:"doc_count"`
+			} `json:"target"`
+		} `json:"buckets"`
+	} `json:"group_by_hashtag"`
+}
+
+// Trending searches the baseline and the target window at once, counting the target window
+// with a filter aggregation so that both counts come from the same hashtag buckets.
+func (t *hashtagRepository) Trending(ctx context.Context, filter *domain.HashtagFilter, targetStart time.Time, candidates int) (*domain.HashtagTrendCounts, error) {
+	var buf bytes.Buffer
+
+	// every candidate bucket holds the target bucket as well
+	if candidates*2 > maxBuckets {
+		candidates = maxBuckets / 2
+	}
+	target := query.Range("created_at").Gte(targetStart.Format("2006-01-02 15:04:00"))
+	body := map[string]interface{}{
+		"query": query.Root(hashtagFilterQuery(filter)),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"target": query.FilterAgg(target),
+			"group_by_hashtag": query.TermsAgg("hashtag").
+				Order("target", "desc").
+				Order("_key", "asc").
+				Size(candidates).
+				SubAggregation("target", query.FilterAgg(target)),
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
+		return nil, err
+	}
+
+	r, err := search(ctx, t.l, t.es, "hashtag.Trending", t.filterIndex(filter), &buf, 0)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
+		return nil, err
+	}
+
+	var aggs hashtagTrendingAggregations
+	if err := r.decodeAggregations(&aggs); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, err
+	}
+	counts := &domain.HashtagTrendCounts{
+		TargetTotal:   aggs.Target.DocCount,
+		BaselineTotal: uint64(r.Hits.Total.Value) - aggs.Target.DocCount,
+		Hashtags:      make([]*domain.HashtagWindowCount, 0, len(aggs.GroupByHashtag.Buckets)),
+	}
+	for _, b := range aggs.GroupByHashtag.Buckets {
+		counts.Hashtags = append(counts.Hashtags, &domain.HashtagWindowCount{
+			Hashtag:       b.Key,
+			TargetCount:   b.Target.DocCount,
+			BaselineCount: b.DocCount - b.Target.DocCount,
+		})
+	}
+	return counts, nil
+}
+
+// hashtagCooccurrenceAggregations is the aggregations part of the hashtag co-occurrence responses.
+type hashtagCooccurrenceAggregations struct {
+	GroupByHashtag struct {
+		Buckets []struct {
+			Key          string `json:"key"`
+			DocCount     uint64 `json:"doc_count"`
+			Cooccurrence struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount uint64 `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"cooccurrence"`
+		} `json:"buckets"`
+	} `json:"group_by_hashtag"`
+}
+
+// Cooccurrence buckets the tweets of every seed by their other hashtags, then counts the tweets
+// of the neighbors found, which a second search needs because they are only known afterwards.
+func (t *hashtagRepository) Cooccurrence(ctx context.Context, seeds []string, filter *domain.HashtagFilter, size int) (*domain.HashtagCooccurrence, error) {
+	var buf bytes.Buffer
+
+	// every seed bucket holds size+1 neighbor buckets
+	if len(seeds)*(size+2) > maxBuckets {
+		return nil, domain.ErrTooManyBuckets
+	}
+	index := t.filterIndex(filter)
+	body := map[string]interface{}{
+		"query": query.Root(hashtagFilterQuery(filter)),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"group_by_hashtag": query.TermsAgg("hashtag").
+				Include(seeds...).
+				Size(len(seeds)).
+				// one more than size because every seed is among its own neighbors
+				SubAggregation("cooccurrence", query.TermsAgg("hashtag").
+					Order("_count", "desc").
+					Order("_key", "asc").
+					Size(size+1)),
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
+		return nil, err
+	}
+
+	r, err := search(ctx, t.l, t.es, "hashtag.Cooccurrence", index, &buf, 0)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
+		return nil, err
+	}
+
+	var aggs hashtagCooccurrenceAggregations
+	if err := r.decodeAggregations(&aggs); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, err
+	}
+	co := &domain.HashtagCooccurrence{
+		Total:  uint64(r.Hits.Total.Value),
+		Counts: map[string]uint64{},
+		Pairs:  []*domain.HashtagPair{},
+	}
+	var neighbors []string
+	seen := map[string]bool{}
+	for _, sb := range aggs.GroupByHashtag.Buckets {
+		co.Counts[sb.Key] = sb.DocCount
+		for _, nb := range sb.Cooccurrence.Buckets {
+			if nb.Key == sb.Key {
+				continue
+			}
+			co.Pairs = append(co.Pairs, &domain.HashtagPair{Seed: sb.Key, Neighbor: nb.Key, Count: nb.DocCount})
+			if !seen[nb.Key] {
+				seen[nb.Key] = true
+				neighbors = append(neighbors, nb.Key)
+			}
+		}
+	}
+	if len(neighbors) == 0 {
+		return co, nil
+	}
+
+	buf.Reset()
+	body = map[string]interface{}{
+		"query": query.Root(hashtagFilterQuery(filter)),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"group_by_hashtag": query.TermsAgg("hashtag").
+				Include(neighbors...).
+				Size(len(neighbors)),
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
+		return nil, err
+	}
+
+	r, err = search(ctx, t.l, t.es, "hashtag.Cooccurrence.counts", index, &buf, 0)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
+		return nil, err
+	}
+
+	var counts hashtagCooccurrenceAggregations
+	if err := r.decodeAggregations(&counts); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, err
+	}
+	for _, b := range counts.GroupByHashtag.Buckets {
+		co.Counts[b.Key] = b.DocCount
+	}
+	return co, nil
+}
+
+// engagementScript adds up the engagement counts a tweet has.
+const engagementScript = "double n = 0; for (f in params.fields) { if (doc[f].size() > 0) { n += doc[f].value } } return n;"
+
+func engagementSum() *query.MetricAggregation {
+	return query.SumScript(engagementScript, map[string]interface{}{
+		"fields": []string{"retweet_count", "favorite_count", "reply_count", "quote_count"},
+	})
+}
+
+// hashtagContributorsAggregations is the aggregations part of the hashtag contributor responses.
+type hashtagContributorsAggregations struct {
+	Engagement   valueAggregation   `json:"engagement"`
+	ByStatus     contributorBuckets `json:"by_status"`
+	ByEngagement contributorBuckets `json:"by_engagement"`
+}
+
+type contributorBuckets struct {
+	Buckets []struct {
+		// user ids are indexed as numbers or strings depending on the month
+		Key        sourceString     `json:"key"`
+		DocCount   uint64           `json:"doc_count"`
+		Engagement valueAggregation `json:"engagement"`
+	} `json:"buckets"`
+}
+
+func (b contributorBuckets) contributors() []*domain.HashtagContributor {
+	contributors := make([]*domain.HashtagContributor, 0, len(b.Buckets))
+	for _, u := range b.Buckets {
+		contributors = append(contributors, &domain.HashtagContributor{
+			UserID:          u.Key.Value,
+			StatusCount:     u.DocCount,
+			EngagementCount: uint64(u.Engagement.Value),
+		})
+	}
+	return contributors
+}
+
+func (t *hashtagRepository) Contributors(ctx context.Context, hashtag string, filter *domain.HashtagFilter, count int) (*domain.HashtagContributors, error) {
+	var buf bytes.Buffer
+
+	q := hashtagFilterQuery(filter).Filter(query.Term("hashtag", hashtag))
+	body := map[string]interface{}{
+		"query": query.Root(q),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"engagement": engagementSum(),
+			"by_status": query.TermsAgg("user_id").
+				Order("_count", "desc").
+				Order("_key", "asc").
+				Size(count).
+				SubAggregation("engagement", engagementSum()),
+			"by_engagement": query.TermsAgg("user_id").
+				Order("engagement", "desc").
+				Order("_key", "asc").
+				Size(count).
+				SubAggregation("engagement", engagementSum()),
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
+		return nil, err
+	}
+
+	r, err := search(ctx, t.l, t.es, "hashtag.Contributors", t.filterIndex(filter), &buf, 0)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
+		return nil, err
+	}
+
+	var aggs hashtagContributorsAggregations
+	if err := r.decodeAggregations(&aggs); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, err
+	}
+	return &domain.HashtagContributors{
+		Hashtag:         hashtag,
+		StatusCount:     uint64(r.Hits.Total.Value),
+		EngagementCount: uint64(aggs.Engagement.Value),
+		ByStatus:        aggs.ByStatus.contributors(),
+		ByEngagement:    aggs.ByEngagement.contributors(),
+	}, nil
+}
+
+// Suggest matches the prefixes with prefix queries, which unlike the leading wildcards of Search
+// can use the terms index, and only keeps the buckets of the matching hashtags because the tweets
+// found have other hashtags as well.
+func (t *hashtagRepository) Suggest(ctx context.Context, prefixes []string, startDate, endDate time.Time, count int) ([]*domain.HashtagBySearch, error) {
+	var buf bytes.Buffer
+
+	q := query.Bool().
+		Filter(query.Range("created_at").Gte(startDate.Format("2006-01-02 15:04:00")).Lte(endDate.Format("2006-01-02 15:04:59"))).
+		MinimumShouldMatch(1)
+	quoted := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		q.Should(query.Prefix("hashtag", p))
+		quoted = append(quoted, regexpQuote(p))
+	}
+	body := map[string]interface{}{
+		"query": query.Root(q),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"group_by_hashtag": query.TermsAgg("hashtag").
+				IncludePattern(fmt.Sprintf("(%s).*", strings.Join(quoted, "|"))).
+				Order("_count", "desc").
+				Order("_key", "asc").
+				Size(count),
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
+		return nil, err
+	}
+
+	index := t.indices.Index(tweetIndex, startDate, endDate)
+	r, err := search(ctx, t.l, t.es, "hashtag.Suggest", index, &buf, 0)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
+		return nil, err
+	}
+
+	var aggs hashtagAggregations
+	if err := r.decodeAggregations(&aggs); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, err
+	}
+	suggestions := make([]*domain.HashtagBySearch, 0, len(aggs.GroupByHashtag.Buckets))
+	for _, b := range aggs.GroupByHashtag.Buckets {
+		suggestions = append(suggestions, &domain.HashtagBySearch{
+			Hashtag:     b.Key,
+			StatusCount: b.DocCount,
+		})
+	}
+	return suggestions, nil
 }
@@ -0,0 +1,232 @@
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"sns-api/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Partitions of the time based indices, named <prefix>-<suffix> after the period they hold.
+const (
+	PartitionMonth = "month"
+	PartitionDay   = "day"
+)
+
+// partitionLayouts are the time layouts of the suffixes of the partitions. Any other layout,
+// such as 2006 for yearly indices, may be configured as is.
+var partitionLayouts = map[string]string{
+	PartitionMonth: "2006.01",
+	PartitionDay:   "2006.01.02",
+}
+
+// maxIndexNames is the most indices a search names one by one. Longer lists make the request
+// line too long for the cluster, so the prefix wildcard is searched instead and the range
+// filter of the query keeps the results within the period.
+const maxIndexNames = 100
+
+// catalogLoadTimeout bounds each reload of the index names.
+const catalogLoadTimeout = 10 * time.Second
+
+// IndexCatalog resolves a period to the indices of a prefix that exist, so that searches
+// reaching before the oldest index or into a month not yet written do not fail with
+// index_not_found. It reloads the names of the indices and aliases every refresh. Until the
+// first load succeeds it resolves to every index the partitioning names for the period.
+type IndexCatalog struct {
+	l       logger.Logging
+	es      *elasticsearch.Client
+	refresh time.Duration
+	layouts map[string]string
+
+	mu     sync.RWMutex
+	names  map[string]bool
+	loaded bool
+
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewIndexCatalog partitions the prefixes listed in partitions by month, day or a time layout
+// of the suffix; the other prefixes are monthly.
+func NewIndexCatalog(l logger.Logging, es *elasticsearch.Client, refresh time.Duration, partitions map[string]string) (*IndexCatalog, error) {
+	layouts := map[string]string{}
+	for prefix, p := range partitions {
+		layout, ok := partitionLayouts[p]
+		if !ok {
+			layout = p
+		}
+		if !strings.Contains(layout, "2006") {
+			return nil, fmt.Errorf("partition %q of %s has no year", p, prefix)
+		}
+		layouts[prefix] = layout
+	}
+	return &IndexCatalog{
+		l:       l,
+		es:      es,
+		refresh: refresh,
+		layouts: layouts,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Start loads the names before returning, then reloads them every refresh.
+func (c *IndexCatalog) Start() {
+	c.started = true
+	c.reload()
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.reload()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *IndexCatalog) Close() {
+	if !c.started {
+		return
+	}
+	close(c.stop)
+	<-c.done
+}
+
+// reload keeps the names of the last successful load when the cluster cannot be reached.
+func (c *IndexCatalog) reload() {
+	ctx, cancel := context.WithTimeout(context.Background(), catalogLoadTimeout)
+	defer cancel()
+	names, err := c.load(ctx)
+	if err != nil {
+		c.l.Warnf(fmt.Sprintf("failed to load index names: %v", err))
+		return
+	}
+	c.mu.Lock()
+	c.names = names
+	c.loaded = true
+	c.mu.Unlock()
+}
+
+func (c *IndexCatalog) load(ctx context.Context) (map[string]bool, error) {
+	var indices, aliases []struct {
+		Index string `json:"index"`
+		Alias string `json:"alias"`
+	}
+	res, err := c.es.Cat.Indices(c.es.Cat.Indices.WithContext(ctx), c.es.Cat.Indices.WithFormat("json"), c.es.Cat.Indices.WithH("index"))
+	if err := decodeCat(res, err, &indices); err != nil {
+		return nil, err
+	}
+	res, err = c.es.Cat.Aliases(c.es.Cat.Aliases.WithContext(ctx), c.es.Cat.Aliases.WithFormat("json"), c.es.Cat.Aliases.WithH("alias"))
+	if err := decodeCat(res, err, &aliases); err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, i := range indices {
+		names[i.Index] = true
+	}
+	for _, a := range aliases {
+		names[a.Alias] = true
+	}
+	return names, nil
+}
+
+func decodeCat(res *esapi.Response, err error, v interface{}) error {
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("cat returned %s", res.Status())
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Index returns the comma separated indices of prefix holding documents between start and end.
+// When none of them exists the first one is returned all the same: search ignores missing
+// indices, so the search finds nothing instead of failing.
+func (c *IndexCatalog) Index(prefix string, start, end time.Time) string {
+	c.mu.RLock()
+	names, loaded := c.names, c.loaded
+	c.mu.RUnlock()
+	return resolveIndex(prefix, c.layout(prefix), start, end, names, loaded)
+}
+
+func (c *IndexCatalog) layout(prefix string) string {
+	if layout, ok := c.layouts[prefix]; ok {
+		return layout
+	}
+	return partitionLayouts[PartitionMonth]
+}
+
+func resolveIndex(prefix, layout string, start, end time.Time, names map[string]bool, loaded bool) string {
+	candidates, ok := partitionNames(prefix, layout, start, end, maxIndexNames)
+	if !ok {
+		return fmt.Sprintf("%s-*", prefix)
+	}
+	resolved := candidates
+	if loaded {
+		resolved = nil
+		for _, name := range candidates {
+			if names[name] {
+				resolved = append(resolved, name)
+			}
+		}
+	}
+	if len(resolved) == 0 {
+		return candidates[0]
+	}
+	return strings.Join(resolved, ",")
+}
+
+// partitionNames returns the names of the partitions between start and end in order, or false
+// as soon as there are more than limit of them. The range comes from the request, so it is
+// walked one partition at a time rather than day by day.
+func partitionNames(prefix, layout string, start, end time.Time, limit int) ([]string, bool) {
+	if end.Before(start) {
+		start, end = end, start
+	}
+	years, months, days := partitionStep(layout)
+	y, m, d := start.Date()
+	switch {
+	case months > 0:
+		d = 1
+	case years > 0:
+		m, d = time.January, 1
+	}
+	var names []string
+	for p := time.Date(y, m, d, 0, 0, 0, 0, start.Location()); !p.After(end); p = p.AddDate(years, months, days) {
+		name := fmt.Sprintf("%s-%s", prefix, p.Format(layout))
+		if len(names) > 0 && names[len(names)-1] == name {
+			continue
+		}
+		if len(names) == limit {
+			return nil, false
+		}
+		names = append(names, name)
+	}
+	return names, true
+}
+
+// partitionStep returns the period of the partitions of layout, a day, a month or a year, as
+// the years, months and days between one partition and the next.
+func partitionStep(layout string) (int, int, int) {
+	t := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	switch {
+	case t.Format(layout) != t.AddDate(0, 0, 1).Format(layout):
+		return 0, 0, 1
+	case t.Format(layout) != t.AddDate(0, 1, 0).Format(layout):
+		return 0, 1, 0
+	}
+	return 1, 0, 0
+}
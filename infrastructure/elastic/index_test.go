@@ -0,0 +1,99 @@
+package elastic
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_partitionNames(t *testing.T) {
+	type args struct {
+		layout string
+		start  time.Time
+		end    time.Time
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "年を跨ぐケース",
+			args: args{
+				layout: "2006.01",
+				start:  time.Date(2016, 11, 15, 0, 0, 0, 0, time.UTC),
+				end:    time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+			want: []string{"sns-2016.11", "sns-2016.12", "sns-2017.01", "sns-2017.02"},
+		},
+		{
+			name: "同年同月のケース",
+			args: args{
+				layout: "2006.01",
+				start:  time.Date(2016, 9, 1, 0, 0, 0, 0, time.UTC),
+				end:    time.Date(2016, 9, 30, 23, 59, 0, 0, time.UTC),
+			},
+			want: []string{"sns-2016.09"},
+		},
+		{
+			name: "日次インデックス",
+			args: args{
+				layout: "2006.01.02",
+				start:  time.Date(2016, 2, 28, 12, 0, 0, 0, time.UTC),
+				end:    time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC),
+			},
+			want: []string{"sns-2016.02.28", "sns-2016.02.29", "sns-2016.03.01"},
+		},
+		{
+			name: "開始と終了が逆",
+			args: args{
+				layout: "2006",
+				start:  time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+				end:    time.Date(2016, 12, 31, 0, 0, 0, 0, time.UTC),
+			},
+			want: []string{"sns-2016", "sns-2017"},
+		},
+		{
+			name: "パーティションが多すぎる",
+			args: args{
+				layout: "2006.01.02",
+				start:  time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC),
+				end:    time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC),
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := partitionNames(tweetIndex, tt.args.layout, tt.args.start, tt.args.end, maxIndexNames)
+			if !reflect.DeepEqual(got, tt.want) || ok != (tt.want != nil) {
+				t.Errorf("partitionNames() = %v, %v, want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveIndex(t *testing.T) {
+	names := map[string]bool{"sns-2020.01": true, "sns-2020.02": true, "sns-2020.04": true}
+	start := time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		end    time.Time
+		names  map[string]bool
+		loaded bool
+		want   string
+	}{
+		{name: "存在するインデックスのみ", end: time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC), names: names, loaded: true, want: "sns-2020.01,sns-2020.02,sns-2020.04"},
+		{name: "存在しない期間", end: time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC), names: names, loaded: true, want: "sns-2019.12"},
+		{name: "未取得", end: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), want: "sns-2019.12,sns-2020.01"},
+		{name: "インデックスが多すぎる", end: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), want: "sns-*"},
+		{name: "取得済みでも期間が広すぎる", end: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), names: names, loaded: true, want: "sns-*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveIndex(tweetIndex, "2006.01", start, tt.end, tt.names, tt.loaded); got != tt.want {
+				t.Errorf("resolveIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
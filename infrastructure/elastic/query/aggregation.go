@@ -0,0 +1,355 @@
+package query
+
+// Aggregation is an aggregation of the query DSL.
+type Aggregation interface {
+	Source() map[string]interface{}
+}
+
+// Aggregations renders named aggregations for the "aggs" of a request.
+func Aggregations(aggs map[string]Aggregation) map[string]interface{} {
+	m := make(map[string]interface{}, len(aggs))
+	for name, a := range aggs {
+		m[name] = a.Source()
+	}
+	return m
+}
+
+// subAggregations holds the aggregations nested under a bucket aggregation.
+type subAggregations map[string]Aggregation
+
+func (s subAggregations) addTo(m map[string]interface{}) {
+	if len(s) > 0 {
+		m["aggs"] = Aggregations(s)
+	}
+}
+
+// TermsAggregation buckets documents by the values of a field.
+type TermsAggregation struct {
+	field   string
+	size    *int
+	order   []map[string]interface{}
+	include []string
+	pattern string
+	subs    subAggregations
+}
+
+func TermsAgg(field string) *TermsAggregation {
+	return &TermsAggregation{field: field, subs: subAggregations{}}
+}
+
+func (a *TermsAggregation) Size(size int) *TermsAggregation {
+	a.size = &size
+	return a
+}
+
+// Order appends a sort key such as "_count" or "_key" with "asc" or "desc".
+func (a *TermsAggregation) Order(key, direction string) *TermsAggregation {
+	a.order = append(a.order, map[string]interface{}{
+		key: direction,
+	})
+	return a
+}
+
+// Include restricts the buckets to the given exact values.
+func (a *TermsAggregation) Include(values ...string) *TermsAggregation {
+	a.include = append(a.include, values...)
+	return a
+}
+
+// IncludePattern restricts the buckets to the values matching a Lucene regular expression.
+func (a *TermsAggregation) IncludePattern(pattern string) *TermsAggregation {
+	a.pattern = pattern
+	return a
+}
+
+func (a *TermsAggregation) SubAggregation(name string, sub Aggregation) *TermsAggregation {
+	a.subs[name] = sub
+	return a
+}
+
+func (a *TermsAggregation) Source() map[string]interface{} {
+	t := map[string]interface{}{
+		"field": a.field,
+	}
+	if a.size != nil {
+		t["size"] = *a.size
+	}
+	if len(a.order) > 0 {
+		t["order"] = a.order
+	}
+	if len(a.include) > 0 {
+		t["include"] = a.include
+	} else if a.pattern != "" {
+		t["include"] = a.pattern
+	}
+	m := map[string]interface{}{
+		"terms": t,
+	}
+	a.subs.addTo(m)
+	return m
+}
+
+// DateHistogramAggregation buckets documents by calendar intervals of a date field.
+type DateHistogramAggregation struct {
+	field       string
+	interval    string
+	format      string
+	timeZone    string
+	minDocCount *int
+	boundsMin   interface{}
+	boundsMax   interface{}
+	subs        subAggregations
+}
+
+// DateHistogram buckets field by a calendar interval such as "1h", "1d" or "1w".
+func DateHistogram(field, interval string) *DateHistogramAggregation {
+	return &DateHistogramAggregation{field: field, interval: interval, subs: subAggregations{}}
+}
+
+// Format sets the format of the bucket keys as strings and of the extended bounds.
+func (a *DateHistogramAggregation) Format(format string) *DateHistogramAggregation {
+	a.format = format
+	return a
+}
+
+// TimeZone buckets by the calendar of an IANA time zone instead of UTC.
+func (a *DateHistogramAggregation) TimeZone(tz string) *DateHistogramAggregation {
+	a.timeZone = tz
+	return a
+}
+
+func (a *DateHistogramAggregation) MinDocCount(n int) *DateHistogramAggregation {
+	a.minDocCount = &n
+	return a
+}
+
+// ExtendedBounds makes the histogram cover min to max even where there are no documents,
+// which with MinDocCount(0) yields empty buckets instead of gaps.
+func (a *DateHistogramAggregation) ExtendedBounds(min, max interface{}) *DateHistogramAggregation {
+	a.boundsMin = min
+	a.boundsMax = max
+	return a
+}
+
+func (a *DateHistogramAggregation) SubAggregation(name string, sub Aggregation) *DateHistogramAggregation {
+	a.subs[name] = sub
+	return a
+}
+
+func (a *DateHistogramAggregation) Source() map[string]interface{} {
+	h := map[string]interface{}{
+		"field":             a.field,
+		"calendar_interval": a.interval,
+	}
+	if a.format != "" {
+		h["format"] = a.format
+	}
+	if a.timeZone != "" {
+		h["time_zone"] = a.timeZone
+	}
+	if a.minDocCount != nil {
+		h["min_doc_count"] = *a.minDocCount
+	}
+	if a.boundsMin != nil && a.boundsMax != nil {
+		h["extended_bounds"] = map[string]interface{}{
+			"min": a.boundsMin,
+			"max": a.boundsMax,
+		}
+	}
+	m := map[string]interface{}{
+		"date_histogram": h,
+	}
+	a.subs.addTo(m)
+	return m
+}
+
+// FilterAggregation is a single bucket of the documents matching a query.
+type FilterAggregation struct {
+	query Query
+	subs  subAggregations
+}
+
+func FilterAgg(q Query) *FilterAggregation {
+	return &FilterAggregation{query: q, subs: subAggregations{}}
+}
+
+func (a *FilterAggregation) SubAggregation(name string, sub Aggregation) *FilterAggregation {
+	a.subs[name] = sub
+	return a
+}
+
+func (a *FilterAggregation) Source() map[string]interface{} {
+	m := map[string]interface{}{
+		"filter": a.query.Source(),
+	}
+	a.subs.addTo(m)
+	return m
+}
+
+// CardinalityAggregation approximates the number of distinct values of a field.
+type CardinalityAggregation struct {
+	field              string
+	precisionThreshold *int
+}
+
+func Cardinality(field string) *CardinalityAggregation {
+	return &CardinalityAggregation{field: field}
+}
+
+func (a *CardinalityAggregation) PrecisionThreshold(n int) *CardinalityAggregation {
+	a.precisionThreshold = &n
+	return a
+}
+
+func (a *CardinalityAggregation) Source() map[string]interface{} {
+	c := map[string]interface{}{
+		"field": a.field,
+	}
+	if a.precisionThreshold != nil {
+		c["precision_threshold"] = *a.precisionThreshold
+	}
+	return map[string]interface{}{
+		"cardinality": c,
+	}
+}
+
+// MetricAggregation is a single value metric such as avg or sum over a field or a script.
+type MetricAggregation struct {
+	kind   string
+	field  string
+	script map[string]interface{}
+}
+
+func Avg(field string) *MetricAggregation {
+	return &MetricAggregation{kind: "avg", field: field}
+}
+
+func Sum(field string) *MetricAggregation {
+	return &MetricAggregation{kind: "sum", field: field}
+}
+
+func Max(field string) *MetricAggregation {
+	return &MetricAggregation{kind: "max", field: field}
+}
+
+func Min(field string) *MetricAggregation {
+	return &MetricAggregation{kind: "min", field: field}
+}
+
+// Stats computes the count, min, max, avg and sum of field at once.
+func Stats(field string) *MetricAggregation {
+	return &MetricAggregation{kind: "stats", field: field}
+}
+
+// SumScript sums the values a painless script computes for every document.
+func SumScript(source string, params map[string]interface{}) *MetricAggregation {
+	script := map[string]interface{}{
+		"source": source,
+	}
+	if len(params) > 0 {
+		script["params"] = params
+	}
+	return &MetricAggregation{kind: "sum", script: script}
+}
+
+func (a *MetricAggregation) Source() map[string]interface{} {
+	m := map[string]interface{}{}
+	if a.script != nil {
+		m["script"] = a.script
+	} else {
+		m["field"] = a.field
+	}
+	return map[string]interface{}{
+		a.kind: m,
+	}
+}
+
+// PercentilesAggregation approximates percentiles of a field, returned as a list of key and value.
+type PercentilesAggregation struct {
+	field    string
+	percents []float64
+}
+
+func Percentiles(field string, percents ...float64) *PercentilesAggregation {
+	return &PercentilesAggregation{field: field, percents: percents}
+}
+
+func (a *PercentilesAggregation) Source() map[string]interface{} {
+	return map[string]interface{}{
+		"percentiles": map[string]interface{}{
+			"field":    a.field,
+			"percents": a.percents,
+			"keyed":    false,
+		},
+	}
+}
+
+// BucketSortAggregation pages through the buckets of its parent aggregation.
+type BucketSortAggregation struct {
+	from int
+	size int
+}
+
+func BucketSort(from, size int) *BucketSortAggregation {
+	return &BucketSortAggregation{from: from, size: size}
+}
+
+func (a *BucketSortAggregation) Source() map[string]interface{} {
+	return map[string]interface{}{
+		"bucket_sort": map[string]interface{}{
+			"from": a.from,
+			"size": a.size,
+		},
+	}
+}
+
+// CompositeAggregation pages through every bucket of its sources, size buckets at a time in the
+// order of their keys, continuing after the key of the last bucket of the previous page.
+type CompositeAggregation struct {
+	size    int
+	sources []map[string]interface{}
+	after   map[string]interface{}
+	subs    subAggregations
+}
+
+func Composite(size int) *CompositeAggregation {
+	return &CompositeAggregation{size: size, subs: subAggregations{}}
+}
+
+// TermsSource adds the values of field as the part name of the bucket keys.
+func (a *CompositeAggregation) TermsSource(name, field string) *CompositeAggregation {
+	a.sources = append(a.sources, map[string]interface{}{
+		name: map[string]interface{}{
+			"terms": map[string]interface{}{
+				"field": field,
+			},
+		},
+	})
+	return a
+}
+
+// After continues after key, the after_key of the previous page.
+func (a *CompositeAggregation) After(key map[string]interface{}) *CompositeAggregation {
+	a.after = key
+	return a
+}
+
+func (a *CompositeAggregation) SubAggregation(name string, sub Aggregation) *CompositeAggregation {
+	a.subs[name] = sub
+	return a
+}
+
+func (a *CompositeAggregation) Source() map[string]interface{} {
+	c := map[string]interface{}{
+		"size":    a.size,
+		"sources": a.sources,
+	}
+	if a.after != nil {
+		c["after"] = a.after
+	}
+	m := map[string]interface{}{
+		"composite": c,
+	}
+	a.subs.addTo(m)
+	return m
+}
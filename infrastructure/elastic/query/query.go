@@ -0,0 +1,357 @@
+// Package query builds Elasticsearch query DSL bodies.
+//
+// Every builder renders itself with Source. A leaf without a value (an empty string,
+// an empty slice, a range without bounds) and a bool query without clauses are empty:
+// their Source is nil and Bool leaves them out, so optional filters can be added
+// unconditionally while numeric zero values are always sent as they are.
+package query
+
+import (
+	"reflect"
+)
+
+// Query is a clause of the query DSL.
+type Query interface {
+	// Source returns the JSON representation of the clause, or nil if it is empty.
+	Source() map[string]interface{}
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if s, ok := v.(string); ok {
+		return s == ""
+	}
+	return false
+}
+
+// BoolQuery combines clauses with must, filter, should and must_not.
+type BoolQuery struct {
+	must               []Query
+	filter             []Query
+	should             []Query
+	mustNot            []Query
+	minimumShouldMatch interface{}
+}
+
+func Bool() *BoolQuery {
+	return &BoolQuery{}
+}
+
+func (q *BoolQuery) Must(queries ...Query) *BoolQuery {
+	q.must = append(q.must, queries...)
+	return q
+}
+
+func (q *BoolQuery) Filter(queries ...Query) *BoolQuery {
+	q.filter = append(q.filter, queries...)
+	return q
+}
+
+func (q *BoolQuery) Should(queries ...Query) *BoolQuery {
+	q.should = append(q.should, queries...)
+	return q
+}
+
+func (q *BoolQuery) MustNot(queries ...Query) *BoolQuery {
+	q.mustNot = append(q.mustNot, queries...)
+	return q
+}
+
+// MinimumShouldMatch takes a count such as 1 or a percentage such as "75%".
+func (q *BoolQuery) MinimumShouldMatch(v interface{}) *BoolQuery {
+	q.minimumShouldMatch = v
+	return q
+}
+
+func (q *BoolQuery) Source() map[string]interface{} {
+	b := map[string]interface{}{}
+	clauses := []struct {
+		name    string
+		queries []Query
+	}{
+		{"must", q.must},
+		{"filter", q.filter},
+		{"should", q.should},
+		{"must_not", q.mustNot},
+	}
+	for _, c := range clauses {
+		if s := sources(c.queries); len(s) > 0 {
+			b[c.name] = s
+		}
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	if _, ok := b["should"]; ok && q.minimumShouldMatch != nil {
+		b["minimum_should_match"] = q.minimumShouldMatch
+	}
+	return map[string]interface{}{
+		"bool": b,
+	}
+}
+
+func sources(queries []Query) []map[string]interface{} {
+	var s []map[string]interface{}
+	for _, q := range queries {
+		if q == nil {
+			continue
+		}
+		if src := q.Source(); src != nil {
+			s = append(s, src)
+		}
+	}
+	return s
+}
+
+// TermQuery matches the exact value of a keyword or numeric field.
+type TermQuery struct {
+	field string
+	value interface{}
+}
+
+func Term(field string, value interface{}) *TermQuery {
+	return &TermQuery{field: field, value: value}
+}
+
+func (q *TermQuery) Source() map[string]interface{} {
+	if isEmpty(q.value) {
+		return nil
+	}
+	return map[string]interface{}{
+		"term": map[string]interface{}{
+			q.field: q.value,
+		},
+	}
+}
+
+// TermsQuery matches any of the exact values of a field. values must be a slice.
+type TermsQuery struct {
+	field  string
+	values interface{}
+}
+
+func Terms(field string, values interface{}) *TermsQuery {
+	return &TermsQuery{field: field, values: values}
+}
+
+func (q *TermsQuery) Source() map[string]interface{} {
+	if q.values == nil {
+		return nil
+	}
+	v := reflect.ValueOf(q.values)
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Len() == 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"terms": map[string]interface{}{
+			q.field: q.values,
+		},
+	}
+}
+
+// MatchQuery runs a full text match.
+type MatchQuery struct {
+	field    string
+	value    interface{}
+	operator string
+}
+
+func Match(field string, value interface{}) *MatchQuery {
+	return &MatchQuery{field: field, value: value}
+}
+
+// Operator is "and" or "or" and decides whether all analyzed terms have to match.
+func (q *MatchQuery) Operator(op string) *MatchQuery {
+	q.operator = op
+	return q
+}
+
+func (q *MatchQuery) Source() map[string]interface{} {
+	if isEmpty(q.value) {
+		return nil
+	}
+	var v interface{} = q.value
+	if q.operator != "" {
+		v = map[string]interface{}{
+			"query":    q.value,
+			"operator": q.operator,
+		}
+	}
+	return map[string]interface{}{
+		"match": map[string]interface{}{
+			q.field: v,
+		},
+	}
+}
+
+// MatchPhraseQuery matches the analyzed terms in order.
+type MatchPhraseQuery struct {
+	field string
+	value interface{}
+}
+
+func MatchPhrase(field string, value interface{}) *MatchPhraseQuery {
+	return &MatchPhraseQuery{field: field, value: value}
+}
+
+func (q *MatchPhraseQuery) Source() map[string]interface{} {
+	if isEmpty(q.value) {
+		return nil
+	}
+	return map[string]interface{}{
+		"match_phrase": map[string]interface{}{
+			q.field: q.value,
+		},
+	}
+}
+
+// RangeQuery bounds a numeric or date field. Only the bounds that were set are sent.
+type RangeQuery struct {
+	field  string
+	bounds map[string]interface{}
+}
+
+func Range(field string) *RangeQuery {
+	return &RangeQuery{field: field, bounds: map[string]interface{}{}}
+}
+
+func (q *RangeQuery) Gte(v interface{}) *RangeQuery {
+	return q.set("gte", v)
+}
+
+func (q *RangeQuery) Gt(v interface{}) *RangeQuery {
+	return q.set("gt", v)
+}
+
+func (q *RangeQuery) Lte(v interface{}) *RangeQuery {
+	return q.set("lte", v)
+}
+
+func (q *RangeQuery) Lt(v interface{}) *RangeQuery {
+	return q.set("lt", v)
+}
+
+func (q *RangeQuery) set(op string, v interface{}) *RangeQuery {
+	q.bounds[op] = v
+	return q
+}
+
+func (q *RangeQuery) Source() map[string]interface{} {
+	if len(q.bounds) == 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			q.field: q.bounds,
+		},
+	}
+}
+
+// WildcardQuery matches a keyword field against a pattern with * and ?.
+type WildcardQuery struct {
+	field string
+	value string
+}
+
+func Wildcard(field, value string) *WildcardQuery {
+	return &WildcardQuery{field: field, value: value}
+}
+
+func (q *WildcardQuery) Source() map[string]interface{} {
+	if q.value == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"wildcard": map[string]interface{}{
+			q.field: map[string]interface{}{
+				"value": q.value,
+			},
+		},
+	}
+}
+
+// PrefixQuery matches a keyword field starting with value.
+type PrefixQuery struct {
+	field string
+	value string
+}
+
+func Prefix(field, value string) *PrefixQuery {
+	return &PrefixQuery{field: field, value: value}
+}
+
+func (q *PrefixQuery) Source() map[string]interface{} {
+	if q.value == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"prefix": map[string]interface{}{
+			q.field: map[string]interface{}{
+				"value": q.value,
+			},
+		},
+	}
+}
+
+// NestedQuery runs query against the nested documents under path.
+type NestedQuery struct {
+	path      string
+	query     Query
+	innerHits bool
+}
+
+func Nested(path string, query Query) *NestedQuery {
+	return &NestedQuery{path: path, query: query}
+}
+
+// InnerHits returns the matching nested documents with every hit.
+func (q *NestedQuery) InnerHits() *NestedQuery {
+	q.innerHits = true
+	return q
+}
+
+func (q *NestedQuery) Source() map[string]interface{} {
+	if q.query == nil {
+		return nil
+	}
+	src := q.query.Source()
+	if src == nil {
+		return nil
+	}
+	n := map[string]interface{}{
+		"path":  q.path,
+		"query": src,
+	}
+	if q.innerHits {
+		n["inner_hits"] = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"nested": n,
+	}
+}
+
+// MatchAllQuery matches every document.
+type MatchAllQuery struct{}
+
+func MatchAll() *MatchAllQuery {
+	return &MatchAllQuery{}
+}
+
+func (q *MatchAllQuery) Source() map[string]interface{} {
+	return map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	}
+}
+
+// Root returns the source of q for the top level "query" of a request,
+// falling back to match_all when q is empty.
+func Root(q Query) map[string]interface{} {
+	if q != nil {
+		if src := q.Source(); src != nil {
+			return src
+		}
+	}
+	return MatchAll().Source()
+}
@@ -0,0 +1,177 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+type sourcer interface {
+	Source() map[string]interface{}
+}
+
+func assertGolden(t *testing.T, name string, s sourcer) {
+	t.Helper()
+	got, err := json.MarshalIndent(s.Source(), "", "  ")
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	got = append(got, '\n')
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("failed to update golden file: %s", err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %s", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s mismatch\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+	}{
+		{
+			name: "bool",
+			query: Bool().
+				Must(MatchPhrase("user_id", uint64(1234567890123456789))).
+				Filter(
+					Range("created_at").Gte("2020-01-01 00:00:00").Lte("2020-01-31 23:59:59"),
+					Match("tweet_type", 1),
+				).
+				MustNot(Terms("user_screen_name", []string{"a", "b"})),
+		},
+		{
+			name: "bool_should",
+			query: Bool().
+				Should(MatchPhrase("screen_name", "lawson"), MatchPhrase("name", "lawson")).
+				MinimumShouldMatch(1),
+		},
+		{
+			name: "empty_clauses",
+			query: Bool().
+				Must(Match("tweet", ""), Terms("tweet_type", []int{}), Range("retweet_count"), Bool()).
+				Filter(Range("retweet_count").Gte(0), Term("language", "ja")),
+		},
+		{
+			name:  "match_operator",
+			query: Match("tweet", "新 商品").Operator("and"),
+		},
+		{
+			name:  "nested",
+			query: Nested("nested_url", MatchPhrase("nested_url.domain", "example.com")).InnerHits(),
+		},
+		{
+			name:  "wildcard",
+			query: Bool().Must(Wildcard("hashtag", "*lawson*"), Prefix("hashtag", "law")),
+		},
+		{
+			name:  "empty_bool",
+			query: Bool().Must(Match("tweet", "")).MinimumShouldMatch(1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertGolden(t, tt.name, tt.query)
+		})
+	}
+}
+
+func TestRoot(t *testing.T) {
+	assertGolden(t, "root_empty", sourceFunc(func() map[string]interface{} {
+		return Root(Bool())
+	}))
+}
+
+func TestAggregation(t *testing.T) {
+	tests := []struct {
+		name string
+		agg  Aggregation
+	}{
+		{
+			name: "terms_agg",
+			agg: TermsAgg("hashtag").
+				Order("_count", "desc").
+				Order("_key", "asc").
+				Size(20).
+				SubAggregation("retweet_avg", Avg("retweet_count")).
+				SubAggregation("retweet_sum", Sum("retweet_count")).
+				SubAggregation("page", BucketSort(10, 10)),
+		},
+		{
+			name: "cardinality",
+			agg:  Cardinality("hashtag").PrecisionThreshold(100),
+		},
+		{
+			name: "date_histogram",
+			agg: TermsAgg("hashtag").
+				Include("golang", "rust").
+				Size(2).
+				SubAggregation("histogram", DateHistogram("created_at", "1d").
+					Format("yyyy-MM-dd HH:mm:ss").
+					MinDocCount(0).
+					ExtendedBounds("2020-01-01 00:00:00", "2020-01-31 23:59:59").
+					SubAggregation("retweet_sum", Sum("retweet_count"))),
+		},
+		{
+			name: "date_histogram_time_zone",
+			agg: DateHistogram("created_at", "1h").
+				TimeZone("Asia/Tokyo").
+				SubAggregation("tweets", Cardinality("id")),
+		},
+		{
+			name: "filter_agg",
+			agg: TermsAgg("hashtag").
+				Order("target", "desc").
+				Size(100).
+				SubAggregation("target", FilterAgg(Range("created_at").Gte("2020-01-31 00:00:00"))),
+		},
+		{
+			name: "terms_include_pattern",
+			agg:  TermsAgg("hashtag").IncludePattern("(コロナ|ころな).*").Size(10),
+		},
+		{
+			name: "stats",
+			agg:  FilterAgg(Match("tweet_type", 1)).SubAggregation("favorite_stats", Stats("favorite_count")),
+		},
+		{
+			name: "percentiles",
+			agg:  Percentiles("favorite_count", 50, 90),
+		},
+		{
+			name: "composite",
+			agg: Composite(1000).
+				TermsSource("hashtag", "hashtag").
+				After(map[string]interface{}{"hashtag": "golang"}).
+				SubAggregation("retweet_sum", Sum("retweet_count")),
+		},
+		{
+			name: "sum_script",
+			agg: SumScript("double n = 0; for (f in params.fields) { if (doc[f].size() > 0) { n += doc[f].value } } return n;", map[string]interface{}{
+				"fields": []string{"retweet_count", "favorite_count"},
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertGolden(t, tt.name, tt.agg)
+		})
+	}
+}
+
+type sourceFunc func() map[string]interface{}
+
+func (f sourceFunc) Source() map[string]interface{} {
+	return f()
+}
@@ -0,0 +1,377 @@
+package elastic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sns-api/domain"
+	"strconv"
+)
+
+// searchResponse is the envelope of a _search response.
+type searchResponse struct {
+	Took     int    `json:"took"`
+	TimedOut bool   `json:"timed_out"`
+	PitID    string `json:"pit_id"`
+	Shards   struct {
+		Total int `json:"total"`
+	} `json:"_shards"`
+	Hits struct {
+		Total struct {
+			Value    int    `json:"value"`
+			Relation string `json:"relation"`
+		} `json:"total"`
+		Hits []*searchHit `json:"hits"`
+	} `json:"hits"`
+	Aggregations json.RawMessage `json:"aggregations"`
+
+	// returned and last are the number of hits and the last of them, which are known
+	// also when the hits were streamed instead of kept
+	returned int
+	last     *searchHit
+}
+
+// decodeSearchResponse decodes the body of a search. Without each the hits are kept in
+// r.Hits.Hits; with it every hit is handed to each as soon as it is decoded and none is kept,
+// so that a page is never held in memory as a whole.
+func decodeSearchResponse(body io.Reader, each func(*searchHit) error) (*searchResponse, error) {
+	r := &searchResponse{}
+	d := json.NewDecoder(body)
+	// keep sort values such as long ids exactly as the backend returned them
+	d.UseNumber()
+	if each == nil {
+		if err := d.Decode(r); err != nil {
+			return nil, err
+		}
+		r.returned = len(r.Hits.Hits)
+		if r.returned > 0 {
+			r.last = r.Hits.Hits[r.returned-1]
+		}
+		return r, nil
+	}
+
+	// everything but the hits is small and decoded into r once the body is read
+	rest := map[string]json.RawMessage{}
+	err := decodeObject(d, func(key string) error {
+		if key != "hits" {
+			var v json.RawMessage
+			if err := d.Decode(&v); err != nil {
+				return err
+			}
+			rest[key] = v
+			return nil
+		}
+		return decodeObject(d, func(key string) error {
+			switch key {
+			case "total":
+				return d.Decode(&r.Hits.Total)
+			case "hits":
+				return decodeArray(d, func() error {
+					hit := &searchHit{}
+					if err := d.Decode(hit); err != nil {
+						return err
+					}
+					r.returned++
+					r.last = hit
+					return each(hit)
+				})
+			}
+			var v json.RawMessage
+			return d.Decode(&v)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(rest)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// decodeObject reads the object d is at, calling member at every key to decode its value.
+func decodeObject(d *json.Decoder, member func(key string) error) error {
+	if err := expectDelim(d, '{'); err != nil {
+		return err
+	}
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("unexpected %v in object", t)
+		}
+		if err := member(key); err != nil {
+			return err
+		}
+	}
+	return expectDelim(d, '}')
+}
+
+// decodeArray reads the array d is at, calling elem to decode every element.
+func decodeArray(d *json.Decoder, elem func() error) error {
+	if err := expectDelim(d, '['); err != nil {
+		return err
+	}
+	for d.More() {
+		if err := elem(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(d, ']')
+}
+
+func expectDelim(d *json.Decoder, delim json.Delim) error {
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return fmt.Errorf("expected %v, got %v", delim, t)
+	}
+	return nil
+}
+
+type searchHit struct {
+	Index     string                `json:"_index"`
+	ID        string                `json:"_id"`
+	Source    json.RawMessage       `json:"_source"`
+	Sort      []interface{}         `json:"sort"`
+	InnerHits map[string]*innerHits `json:"inner_hits"`
+}
+
+type innerHits struct {
+	Hits struct {
+		Hits []*searchHit `json:"hits"`
+	} `json:"hits"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// valueAggregation is the result of a single value metric such as avg, sum or cardinality.
+// Metrics over no documents are null and decode as zero.
+type valueAggregation struct {
+	Value float64 `json:"value"`
+}
+
+// decodeAggregations decodes the aggregations of r into v. A search on no existing index
+// returns no aggregations at all and leaves v empty.
+func (r *searchResponse) decodeAggregations(v interface{}) error {
+	if len(r.Aggregations) == 0 {
+		if r.Shards.Total == 0 {
+			return nil
+		}
+		return fmt.Errorf("response has no aggregations")
+	}
+	if err := json.Unmarshal(r.Aggregations, v); err != nil {
+		return fmt.Errorf("failed to decode aggregations: %s", err)
+	}
+	return nil
+}
+
+// decodeRaw decodes the aggregation called name out of aggregations kept as raw messages.
+// The aggregations of a search on no existing index are nil and leave v empty.
+func decodeRaw(aggs map[string]json.RawMessage, name string, v interface{}) error {
+	b, ok := aggs[name]
+	if !ok {
+		if aggs == nil {
+			return nil
+		}
+		return fmt.Errorf("response has no %s aggregation", name)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to decode %s aggregation: %s", name, err)
+	}
+	return nil
+}
+
+// sourceField records how a _source field looked while it was decoded.
+type sourceField struct {
+	present  bool   // the field exists and is not null
+	expected string // JSON type the schema expects
+	found    string // JSON type found instead of the expected one
+	usable   bool   // the value could still be used after conversion
+}
+
+type sourceString struct {
+	sourceField
+	Value string
+}
+
+type sourceNumber struct {
+	sourceField
+	Value float64
+}
+
+type sourceBool struct {
+	sourceField
+	Value bool
+}
+
+func (s *sourceString) UnmarshalJSON(b []byte) error {
+	s.expected = "string"
+	if s.present = !isNull(b); !s.present {
+		return nil
+	}
+	if err := json.Unmarshal(b, &s.Value); err == nil {
+		s.usable = true
+		return nil
+	}
+	s.found = jsonKind(b)
+	// ids are sometimes indexed as numbers
+	if s.found == "number" {
+		s.Value = string(b)
+		s.usable = true
+	}
+	return nil
+}
+
+func (n *sourceNumber) UnmarshalJSON(b []byte) error {
+	n.expected = "number"
+	if n.present = !isNull(b); !n.present {
+		return nil
+	}
+	if err := json.Unmarshal(b, &n.Value); err == nil {
+		n.usable = true
+		return nil
+	}
+	n.found = jsonKind(b)
+	var s string
+	if n.found == "string" && json.Unmarshal(b, &s) == nil {
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			n.Value = v
+			n.usable = true
+		}
+	}
+	return nil
+}
+
+func (v *sourceBool) UnmarshalJSON(b []byte) error {
+	v.expected = "boolean"
+	if v.present = !isNull(b); !v.present {
+		return nil
+	}
+	if err := json.Unmarshal(b, &v.Value); err == nil {
+		v.usable = true
+		return nil
+	}
+	v.found = jsonKind(b)
+	var s string
+	if v.found == "string" && json.Unmarshal(b, &s) == nil {
+		if p, err := strconv.ParseBool(s); err == nil {
+			v.Value = p
+			v.usable = true
+		}
+	}
+	return nil
+}
+
+func isNull(b []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(b), []byte("null"))
+}
+
+func jsonKind(b []byte) string {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return "nothing"
+	}
+	switch b[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// sourceDecoder decodes the _source of one hit and collects its schema violations.
+// A document is skipped when a required field is missing or unusable; any other
+// violation only produces a warning and leaves the zero value in place.
+type sourceDecoder struct {
+	hit      *searchHit
+	warnings []*domain.Warning
+	skip     bool
+}
+
+func newSourceDecoder(hit *searchHit) *sourceDecoder {
+	return &sourceDecoder{hit: hit}
+}
+
+func (d *sourceDecoder) decode(source json.RawMessage, v interface{}) bool {
+	if len(source) == 0 || isNull(source) {
+		d.warn("_source", "missing")
+		d.skip = true
+		return false
+	}
+	if err := json.Unmarshal(source, v); err != nil {
+		d.warn("_source", err.Error())
+		d.skip = true
+		return false
+	}
+	return true
+}
+
+func (d *sourceDecoder) warn(field, reason string) {
+	d.warnings = append(d.warnings, &domain.Warning{
+		Index:  d.hit.Index,
+		ID:     d.hit.ID,
+		Field:  field,
+		Reason: reason,
+	})
+}
+
+func (d *sourceDecoder) check(name string, f sourceField, required bool) {
+	switch {
+	case !f.present:
+		if required {
+			d.warn(name, "missing")
+			d.skip = true
+		}
+	case f.found != "" && f.usable:
+		d.warn(name, fmt.Sprintf("expected %s, got %s", f.expected, f.found))
+	case f.found != "":
+		d.warn(name, fmt.Sprintf("expected %s, got %s", f.expected, f.found))
+		if required {
+			d.skip = true
+		}
+	}
+}
+
+func (d *sourceDecoder) str(name string, f sourceString, required bool) string {
+	d.check(name, f.sourceField, required)
+	return f.Value
+}
+
+func (d *sourceDecoder) num(name string, f sourceNumber, required bool) float64 {
+	d.check(name, f.sourceField, required)
+	return f.Value
+}
+
+func (d *sourceDecoder) boolean(name string, f sourceBool, required bool) bool {
+	d.check(name, f.sourceField, required)
+	return f.Value
+}
+
+// done appends the collected warnings and reports whether the document is usable.
+func (d *sourceDecoder) done(warnings *[]*domain.Warning) bool {
+	*warnings = append(*warnings, d.warnings...)
+	return !d.skip
+}
@@ -0,0 +1,59 @@
+package elastic
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_decodeSearchResponse(t *testing.T) {
+	body := `{"pit_id":"p1","took":3,"timed_out":false,"_shards":{"total":2},` +
+		`"hits":{"total":{"value":5,"relation":"eq"},"max_score":null,"hits":[` +
+		`{"_index":"sns-2020.01","_id":"1","_source":{"id":"1"},"sort":[3,"1"]},` +
+		`{"_index":"sns-2020.01","_id":"2","_source":{"id":"2"},"sort":[2,"2"]}]},` +
+		`"aggregations":{"a":{"value":1}}}`
+
+	kept, err := decodeSearchResponse(strings.NewReader(body), nil)
+	if err != nil {
+		t.Fatalf("decodeSearchResponse() error = %v", err)
+	}
+
+	var ids []string
+	streamed, err := decodeSearchResponse(strings.NewReader(body), func(hit *searchHit) error {
+		ids = append(ids, hit.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("decodeSearchResponse() error = %v", err)
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("streamed hits = %v, want %v", ids, want)
+	}
+	if len(streamed.Hits.Hits) != 0 {
+		t.Errorf("streamed response kept %d hits", len(streamed.Hits.Hits))
+	}
+
+	for name, r := range map[string]*searchResponse{"保持": kept, "ストリーム": streamed} {
+		t.Run(name, func(t *testing.T) {
+			if r.PitID != "p1" || r.Took != 3 || r.Shards.Total != 2 || r.Hits.Total.Value != 5 {
+				t.Errorf("decodeSearchResponse() = %+v", r)
+			}
+			if r.returned != 2 || r.last.ID != "2" {
+				t.Errorf("returned = %d, last = %v, want 2 and 2", r.returned, r.last.ID)
+			}
+			if want := []interface{}{json.Number("2"), "2"}; !reflect.DeepEqual(r.last.Sort, want) {
+				t.Errorf("last sort = %#v, want %#v", r.last.Sort, want)
+			}
+			if string(r.Aggregations) != `{"a":{"value":1}}` {
+				t.Errorf("aggregations = %s", r.Aggregations)
+			}
+		})
+	}
+
+	stop := errors.New("stop")
+	if _, err := decodeSearchResponse(strings.NewReader(body), func(hit *searchHit) error { return stop }); err != stop {
+		t.Errorf("decodeSearchResponse() error = %v, want %v", err, stop)
+	}
+}
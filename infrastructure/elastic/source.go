@@ -0,0 +1,221 @@
+package elastic
+
+import (
+	"fmt"
+	"sns-api/domain"
+)
+
+// tweetSource is a document of the sns-* indices.
+type tweetSource struct {
+	ID             sourceString      `json:"id"`
+	UserID         sourceString      `json:"user_id"`
+	UserScreenName sourceString      `json:"user_screen_name"`
+	UserName       sourceString      `json:"user_name"`
+	Tweet          sourceString      `json:"tweet"`
+	QuoteCount     sourceNumber      `json:"quote_count"`
+	FavoriteCount  sourceNumber      `json:"favorite_count"`
+	RetweetCount   sourceNumber      `json:"retweet_count"`
+	ReplyCount     sourceNumber      `json:"reply_count"`
+	MediaType      sourceNumber      `json:"media_type"`
+	CreatedAt      sourceString      `json:"created_at"`
+	NestedURL      []nestedURLSource `json:"nested_url"`
+}
+
+type nestedURLSource struct {
+	CanonicalURL sourceString `json:"canonical_url"`
+	Domain       sourceString `json:"domain"`
+}
+
+// userSource is a document of the user-* indices.
+type userSource struct {
+	ID                   sourceString `json:"id"`
+	ScreenName           sourceString `json:"screen_name"`
+	Name                 sourceString `json:"name"`
+	Description          sourceString `json:"description"`
+	ProfileImageURLHttps sourceString `json:"profile_image_url_https"`
+	Verified             sourceBool   `json:"verified"`
+	FollowersCount       sourceNumber `json:"followers_count"`
+	StatusesCount        sourceNumber `json:"statuses_count"`
+	FavouritesCount      sourceNumber `json:"favourites_count"`
+	FriendsCount         sourceNumber `json:"friends_count"`
+	ListedCount          sourceNumber `json:"listed_count"`
+	SrScore              sourceNumber `json:"sr_score"`
+	CreatedAt            sourceString `json:"created_at"`
+}
+
+// urlSource is a document of the url-* indices.
+type urlSource struct {
+	CanonicalURL sourceString `json:"canonical_url"`
+	Unwound      *struct {
+		Title       sourceString `json:"title"`
+		Description sourceString `json:"description"`
+	} `json:"unwound"`
+}
+
+// mediaSource is a document of the media-* indices.
+type mediaSource struct {
+	SourceStatusID sourceString `json:"source_status_id"`
+	MediaURLHttps  sourceString `json:"media_url_https"`
+}
+
+// decodeTweet converts a sns-* hit, or returns nil when the document is unusable.
+// Schema violations are appended to warnings in both cases.
+func decodeTweet(hit *searchHit, warnings *[]*domain.Warning) *domain.Tweet {
+	var s tweetSource
+	d := newSourceDecoder(hit)
+	if !d.decode(hit.Source, &s) {
+		d.done(warnings)
+		return nil
+	}
+	tweet := &domain.Tweet{
+		UserID:         d.str("user_id", s.UserID, true),
+		UserScreenName: d.str("user_screen_name", s.UserScreenName, false),
+		UserName:       d.str("user_name", s.UserName, false),
+		TweetID:        hit.ID,
+		Text:           d.str("tweet", s.Tweet, false),
+		QuoteCount:     d.num("quote_count", s.QuoteCount, false),
+		FavoriteCount:  d.num("favorite_count", s.FavoriteCount, false),
+		RetweetCount:   d.num("retweet_count", s.RetweetCount, false),
+		ReplyCount:     d.num("reply_count", s.ReplyCount, false),
+		CreatedAt:      decodeCreatedAt(d, s.CreatedAt),
+	}
+	for _, u := range s.NestedURL {
+		tweet.NestedURL = append(tweet.NestedURL, &domain.TweetNestedURL{
+			CanonicalURL: d.str("nested_url.canonical_url", u.CanonicalURL, false),
+			Domain:       d.str("nested_url.domain", u.Domain, false),
+		})
+	}
+	if !d.done(warnings) {
+		return nil
+	}
+	return tweet
+}
+
+// decodeTweetMedia converts a sns-* hit into its media summary and the status id
+// used to look up the media documents.
+func decodeTweetMedia(hit *searchHit, warnings *[]*domain.Warning) (*domain.TweetMedia, string) {
+	var s tweetSource
+	d := newSourceDecoder(hit)
+	if !d.decode(hit.Source, &s) {
+		d.done(warnings)
+		return nil, ""
+	}
+	id := d.str("id", s.ID, true)
+	media := &domain.TweetMedia{
+		TweetID:       hit.ID,
+		MediaType:     d.num("media_type", s.MediaType, false),
+		FavoriteCount: d.num("favorite_count", s.FavoriteCount, false),
+		RetweetCount:  d.num("retweet_count", s.RetweetCount, false),
+	}
+	if !d.done(warnings) {
+		return nil, ""
+	}
+	return media, id
+}
+
+// decodeNestedURLs converts the nested_url inner hits of a sns-* hit.
+func decodeNestedURLs(hit *searchHit, warnings *[]*domain.Warning) []*domain.TweetNestedURL {
+	var urls []*domain.TweetNestedURL
+	inner, ok := hit.InnerHits["nested_url"]
+	if !ok {
+		return nil
+	}
+	for _, h := range inner.Hits.Hits {
+		var s nestedURLSource
+		// nested hits share the id of their parent document
+		d := newSourceDecoder(&searchHit{Index: hit.Index, ID: hit.ID})
+		if !d.decode(h.Source, &s) {
+			d.done(warnings)
+			continue
+		}
+		u := &domain.TweetNestedURL{
+			CanonicalURL: d.str("nested_url.canonical_url", s.CanonicalURL, true),
+			Domain:       d.str("nested_url.domain", s.Domain, false),
+		}
+		if d.done(warnings) {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// decodeUser converts a user-* hit, or returns nil when the document is unusable.
+func decodeUser(hit *searchHit, warnings *[]*domain.Warning) *domain.User {
+	var s userSource
+	d := newSourceDecoder(hit)
+	if !d.decode(hit.Source, &s) {
+		d.done(warnings)
+		return nil
+	}
+	user := &domain.User{
+		UserID:           d.str("id", s.ID, true),
+		UserScreenName:   d.str("screen_name", s.ScreenName, false),
+		UserName:         d.str("name", s.Name, false),
+		UserDescription:  d.str("description", s.Description, false),
+		UserImageProfile: d.str("profile_image_url_https", s.ProfileImageURLHttps, false),
+		Verified:         d.boolean("verified", s.Verified, false),
+		FollowerCount:    d.num("followers_count", s.FollowersCount, false),
+		StatusCount:      d.num("statuses_count", s.StatusesCount, false),
+		FavoriteCount:    d.num("favourites_count", s.FavouritesCount, false),
+		FollowCount:      d.num("friends_count", s.FriendsCount, false),
+		ListCount:        d.num("listed_count", s.ListedCount, false),
+		SrScore:          d.num("sr_score", s.SrScore, false),
+		CreatedAt:        d.str("created_at", s.CreatedAt, false),
+	}
+	if !d.done(warnings) {
+		return nil
+	}
+	return user
+}
+
+// decodeURL converts a url-* hit, or returns nil when the document is unusable.
+func decodeURL(hit *searchHit, warnings *[]*domain.Warning) *domain.URL {
+	var s urlSource
+	d := newSourceDecoder(hit)
+	if !d.decode(hit.Source, &s) {
+		d.done(warnings)
+		return nil
+	}
+	url := &domain.URL{
+		URL: d.str("canonical_url", s.CanonicalURL, true),
+	}
+	if s.Unwound != nil {
+		url.Title = d.str("unwound.title", s.Unwound.Title, false)
+		url.Description = d.str("unwound.description", s.Unwound.Description, false)
+	}
+	if !d.done(warnings) {
+		return nil
+	}
+	return url
+}
+
+// decodeMedia converts a media-* hit, or returns nil when the document is unusable.
+func decodeMedia(hit *searchHit, warnings *[]*domain.Warning) *domain.Media {
+	var s mediaSource
+	d := newSourceDecoder(hit)
+	if !d.decode(hit.Source, &s) {
+		d.done(warnings)
+		return nil
+	}
+	media := &domain.Media{
+		TweetID:  d.str("source_status_id", s.SourceStatusID, true),
+		MediaURL: d.str("media_url_https", s.MediaURLHttps, false),
+	}
+	if !d.done(warnings) {
+		return nil
+	}
+	return media
+}
+
+func decodeCreatedAt(d *sourceDecoder, f sourceString) string {
+	v := d.str("created_at", f, false)
+	if v == "" {
+		return ""
+	}
+	createdAt, err := normalizeTime(v)
+	if err != nil {
+		d.warn("created_at", fmt.Sprintf("unexpected format: %s", err))
+		return ""
+	}
+	return createdAt
+}
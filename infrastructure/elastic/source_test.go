@@ -0,0 +1,76 @@
+package elastic
+
+import (
+	"encoding/json"
+	"sns-api/domain"
+	"testing"
+)
+
+func Test_decodeUser(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       string
+		wantUser     bool
+		wantID       string
+		wantVerified bool
+		wantWarnings int
+	}{
+		{
+			name:         "正常系",
+			source:       `{"id":"1","screen_name":"a","name":"A","description":null,"profile_image_url_https":"https://","verified":true,"followers_count":1,"statuses_count":1,"favourites_count":1,"friends_count":1,"listed_count":1,"created_at":"2020-01-01 00:00:00"}`,
+			wantUser:     true,
+			wantID:       "1",
+			wantVerified: true,
+			wantWarnings: 0,
+		},
+		{
+			name:         "idが数値",
+			source:       `{"id":1234567890123456789,"screen_name":"a","verified":"true","followers_count":1}`,
+			wantUser:     true,
+			wantID:       "1234567890123456789",
+			wantVerified: true,
+			wantWarnings: 2,
+		},
+		{
+			name:         "カウントが文字列",
+			source:       `{"id":"1","followers_count":"abc"}`,
+			wantUser:     true,
+			wantID:       "1",
+			wantWarnings: 1,
+		},
+		{
+			name:         "idがない",
+			source:       `{"screen_name":"a"}`,
+			wantUser:     false,
+			wantWarnings: 1,
+		},
+		{
+			name:         "sourceがない",
+			source:       ``,
+			wantUser:     false,
+			wantWarnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hit := &searchHit{Index: "user-2020.01", ID: "x", Source: json.RawMessage(tt.source)}
+			var warnings []*domain.Warning
+			got := decodeUser(hit, &warnings)
+			if (got != nil) != tt.wantUser {
+				t.Fatalf("decodeUser() = %v, wantUser %v", got, tt.wantUser)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("decodeUser() warnings = %d, want %d", len(warnings), tt.wantWarnings)
+			}
+			if got == nil {
+				return
+			}
+			if got.UserID != tt.wantID {
+				t.Errorf("decodeUser() UserID = %v, want %v", got.UserID, tt.wantID)
+			}
+			if got.Verified != tt.wantVerified {
+				t.Errorf("decodeUser() Verified = %v, want %v", got.Verified, tt.wantVerified)
+			}
+		})
+	}
+}
@@ -3,509 +3,639 @@ package elastic
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v7"
 	"sns-api/domain"
+	"sns-api/infrastructure/elastic/query"
 	"sns-api/logger"
-	"strings"
 	"time"
 )
 
 const (
 	tweetTypeNormal int = 1
 
-	mediaTypeAll    int = -1
-	mediaTypePhoto  int = 2
-	mediaTypeVideo  int = 3
-	mediaTypeGif    int = 4
+	mediaTypeAll   int = -1
+	mediaTypePhoto int = 2
+	mediaTypeVideo int = 3
+	mediaTypeGif   int = 4
 )
 
 type tweetRepository struct {
-	l  logger.Logging
-	es *elasticsearch.Client
+	l       logger.Logging
+	es      *elasticsearch.Client
+	indices *IndexCatalog
 }
 
-func NewTweetRepository(logger logger.Logging, conn *elasticsearch.Client) *tweetRepository {
+func NewTweetRepository(logger logger.Logging, conn *elasticsearch.Client, indices *IndexCatalog) *tweetRepository {
 	return &tweetRepository{
-		l:  logger,
-		es: conn,
+		l:       logger,
+		es:      conn,
+		indices: indices,
 	}
 }
 
-func (t *tweetRepository) Get() ([]*domain.Tweet, error) {
+// distinctTweets hands each the hits of a search with every tweet once. A tweet may be indexed
+// twice, and collapse on id cannot be combined with search_after; copies on the following page
+// are skipped by search_after itself, since they sort the same.
+func distinctTweets(each func(*searchHit) error) func(*searchHit) error {
+	seen := map[string]bool{}
+	return func(hit *searchHit) error {
+		var s struct {
+			ID sourceString `json:"id"`
+		}
+		id := hit.ID
+		if err := json.Unmarshal(hit.Source, &s); err == nil && s.ID.usable {
+			id = s.ID.Value
+		}
+		if seen[id] {
+			return nil
+		}
+		seen[id] = true
+		return each(hit)
+	}
+}
+
+func (t *tweetRepository) Get(ctx context.Context) ([]*domain.Tweet, error) {
 	return []*domain.Tweet{}, nil
 }
 
-func (t *tweetRepository) GetByUser(userID uint64, startDate, endDate string, count int, orderBy string) ([]*domain.Tweet, int, error) {
-	var r map[string]interface{}
+func (t *tweetRepository) GetByUser(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error) {
 	var buf bytes.Buffer
-	var tweets []*domain.Tweet
-	ctx := context.Background()
 
-	query := map[string]interface{}{
-		"collapse": map[string]interface{}{
-			"field": "id",
-		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{
-						"match_phrase": map[string]interface{}{
-							"user_id": userID,
-						},
-					},
-				},
-				"filter": []map[string]interface{}{
-					{
-						"range": map[string]interface{}{
-							"created_at": map[string]interface{}{
-								"gte": fmt.Sprintf("%s:00", startDate),
-								"lte": fmt.Sprintf("%s:59", endDate),
-							},
-						},
-					},
-					{
-						"match": map[string]interface{}{
-							"tweet_type": tweetTypeNormal,
-						},
-					},
-				},
-			},
-		},
+	q := query.Bool().
+		Must(query.MatchPhrase("user_id", userID)).
+		Filter(
+			query.Range("created_at").Gte(startDate.Format("2006-01-02 15:04:00")).Lte(endDate.Format("2006-01-02 15:04:59")),
+			query.Match("tweet_type", tweetTypeNormal),
+		)
+
+	body := map[string]interface{}{
+		"query": query.Root(q),
 		"sort": []map[string]interface{}{
 			{
 				orderBy: "desc",
 			},
+			{
+				"id": "asc",
+			},
 		},
 	}
 
-	if err := encodeQuery(&buf, query); err != nil {
+	index := applyCursor(ctx, t.l, t.es, body, t.indices.Index(tweetIndex, startDate, endDate), cursor)
+	if err := encodeQuery(&buf, body); err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
-		return nil, 0, err
+		return nil, err
 	}
 
-	r, err := search(ctx, t.l, t.es, fmt.Sprintf("%s-*", tweetIndex), &buf, count)
+	var warnings []*domain.Warning
+	r, err := searchEach(ctx, t.l, t.es, "tweet.GetByUser", index, &buf, count, distinctTweets(func(hit *searchHit) error {
+		if tweet := decodeTweet(hit, &warnings); tweet != nil {
+			return each(tweet)
+		}
+		return nil
+	}))
 	if err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
-		return nil, 0, err
+		return nil, err
 	}
-
-	hits := int(r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
-
-	for _, hit := range r["hits"].(map[string]interface{})["hits"].([]interface{}) {
-		var tweetsUrls []*domain.TweetNestedURL
-		createdAt, err := convertTime(hit.(map[string]interface{})["_source"].(map[string]interface{})["created_at"].(string))
-		if err != nil {
-			t.l.Error(fmt.Sprintf("failed to convert tweet time: %s", err))
-		}
-		if hit.(map[string]interface{})["_source"].(map[string]interface{})["nested_url"] != nil {
-			for _, url := range hit.(map[string]interface{})["_source"].(map[string]interface{})["nested_url"].([]interface{}) {
-				tweetsUrl := domain.TweetNestedURL{
-					CanonicalURL: url.(map[string]interface{})["canonical_url"].(string),
-					Domain:       url.(map[string]interface{})["domain"].(string),
-				}
-				tweetsUrls = append(tweetsUrls, &tweetsUrl)
-			}
-		}
-		tweet := domain.Tweet{
-			UserID:         hit.(map[string]interface{})["_source"].(map[string]interface{})["user_id"].(string),
-			UserScreenName: hit.(map[string]interface{})["_source"].(map[string]interface{})["user_screen_name"].(string),
-			UserName:       hit.(map[string]interface{})["_source"].(map[string]interface{})["user_name"].(string),
-			TweetID:        hit.(map[string]interface{})["_id"].(string),
-			Text:           hit.(map[string]interface{})["_source"].(map[string]interface{})["tweet"].(string),
-			QuoteCount:     hit.(map[string]interface{})["_source"].(map[string]interface{})["quote_count"].(float64),
-			FavoriteCount:  hit.(map[string]interface{})["_source"].(map[string]interface{})["favorite_count"].(float64),
-			RetweetCount:   hit.(map[string]interface{})["_source"].(map[string]interface{})["retweet_count"].(float64),
-			ReplyCount:     hit.(map[string]interface{})["_source"].(map[string]interface{})["reply_count"].(float64),
-			CreatedAt:      createdAt,
-			NestedURL:      tweetsUrls,
-		}
-		tweets = append(tweets, &tweet)
+	logWarnings(t.l, "GetByUser", warnings)
+	page := &domain.Page{
+		Hits:       r.Hits.Total.Value,
+		NextCursor: nextCursor(r, count),
+		Warnings:   warnings,
 	}
-	return tweets, hits, nil
+	return page, nil
 }
 
-func (t *tweetRepository) GetByUsers(userIDs []uint64, startDate, endDate time.Time, count int, orderBy string) ([]*domain.Tweet, int, error) {
-	var r map[string]interface{}
+func (t *tweetRepository) GetByUsers(ctx context.Context, userIDs []uint64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error) {
 	var buf bytes.Buffer
-	var tweets []*domain.Tweet
-	var userQuery = make([]map[string]interface{}, 0, len(userIDs))
-	ctx := context.Background()
 
+	users := query.Bool().MinimumShouldMatch(1)
 	for _, id := range userIDs {
-		q := map[string]interface{}{
-			"match_phrase": map[string]interface{}{
-				"user_id": id,
-			},
-		}
-		userQuery = append(userQuery, q)
+		users.Should(query.MatchPhrase("user_id", id))
 	}
-
-	query := map[string]interface{}{
-		"collapse": map[string]interface{}{
-			"field": "id",
-		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"filter": []map[string]interface{}{
-					{
-						"bool": map[string]interface{}{
-							"should": userQuery,
-						},
-					},
-					{
-						"match": map[string]interface{}{
-							"tweet_type": tweetTypeNormal,
-						},
-					},
-				},
-			},
-		},
+	q := query.Bool().
+		Filter(
+			users,
+			query.Match("tweet_type", tweetTypeNormal),
+		)
+
+	body := map[string]interface{}{
+		"query": query.Root(q),
 		"sort": []map[string]interface{}{
 			{
 				orderBy: "desc",
 			},
+			{
+				"id": "asc",
+			},
 		},
 	}
 
-	if err := encodeQuery(&buf, query); err != nil {
+	index := applyCursor(ctx, t.l, t.es, body, t.indices.Index(tweetIndex, startDate, endDate), cursor)
+	if err := encodeQuery(&buf, body); err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
-		return nil, 0, err
+		return nil, err
 	}
 
-	mDiff := monthDiff(startDate, endDate)
-	monthList := buildIndexByTimeAdd(tweetIndex, startDate, mDiff)
-
-	r, err := search(ctx, t.l, t.es, strings.Join(monthList, ","), &buf, count)
+	var warnings []*domain.Warning
+	r, err := searchEach(ctx, t.l, t.es, "tweet.GetByUsers", index, &buf, count, distinctTweets(func(hit *searchHit) error {
+		if tweet := decodeTweet(hit, &warnings); tweet != nil {
+			return each(tweet)
+		}
+		return nil
+	}))
 	if err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
-		return nil, 0, err
+		return nil, err
 	}
-
-	hits := int(r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
-
-	for _, hit := range r["hits"].(map[string]interface{})["hits"].([]interface{}) {
-		createdAt, err := convertTime(hit.(map[string]interface{})["_source"].(map[string]interface{})["created_at"].(string))
-		if err != nil {
-			t.l.Error(fmt.Sprintf("failed to convert tweet time: %s", err))
-		}
-		tweet := domain.Tweet{
-			UserID:         hit.(map[string]interface{})["_source"].(map[string]interface{})["user_id"].(string),
-			UserScreenName: hit.(map[string]interface{})["_source"].(map[string]interface{})["user_screen_name"].(string),
-			UserName:       hit.(map[string]interface{})["_source"].(map[string]interface{})["user_name"].(string),
-			TweetID:        hit.(map[string]interface{})["_id"].(string),
-			Text:           hit.(map[string]interface{})["_source"].(map[string]interface{})["tweet"].(string),
-			QuoteCount:     hit.(map[string]interface{})["_source"].(map[string]interface{})["quote_count"].(float64),
-			FavoriteCount:  hit.(map[string]interface{})["_source"].(map[string]interface{})["favorite_count"].(float64),
-			RetweetCount:   hit.(map[string]interface{})["_source"].(map[string]interface{})["retweet_count"].(float64),
-			ReplyCount:     hit.(map[string]interface{})["_source"].(map[string]interface{})["reply_count"].(float64),
-			CreatedAt:      createdAt,
-		}
-		tweets = append(tweets, &tweet)
+	logWarnings(t.l, "GetByUsers", warnings)
+	page := &domain.Page{
+		Hits:       r.Hits.Total.Value,
+		NextCursor: nextCursor(r, count),
+		Warnings:   warnings,
 	}
-	return tweets, hits, nil
+	return page, nil
 }
 
-func (t *tweetRepository) GetByDomain(userID uint64, startDate string, endDate string, count int, orderBy string, domainName string) ([]*domain.Tweet, int, []*domain.URL, error) {
+func (t *tweetRepository) GetByDomain(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, domainName string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, []*domain.URL, error) {
 
-	var esResultDomain map[string]interface{}
-	var esResultURL map[string]interface{}
 	var buf bytes.Buffer
-	var tweets []*domain.Tweet
 	var url_info []*domain.URL
-	var tmpUrl map[string]interface{}
-	var queryURLParamsUrl []map[string]interface{}
 
-	ctx := context.Background()
+	q := query.Bool().
+		Must(
+			query.MatchPhrase("user_id", userID),
+			query.Nested("nested_url", query.MatchPhrase("nested_url.domain", domainName)).InnerHits(),
+		).
+		Filter(
+			query.Range("created_at").Gte(startDate.Format("2006-01-02 15:04:00")).Lte(endDate.Format("2006-01-02 15:04:59")),
+			query.Match("tweet_type", tweetTypeNormal),
+		)
 	queryDomain := map[string]interface{}{
-		"collapse": map[string]interface{}{
-			"field": "id",
-		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{
-						"match_phrase": map[string]interface{}{
-							"user_id": userID,
-						},
-					},
-					{
-						"nested": map[string]interface{}{
-							"path": "nested_url",
-							"inner_hits": map[string]interface{}{},
-							"query": map[string]interface{}{
-								"match_phrase": map[string]interface{}{
-									"nested_url.domain": domainName,
-								},
-							},
-						},
-					},
-				},
-				"filter": []map[string]interface{}{
-					{
-						"range": map[string]interface{}{
-							"created_at": map[string]interface{}{
-								"gte": fmt.Sprintf("%s:00", startDate),
-								"lte": fmt.Sprintf("%s:59", endDate),
-							},
-						},
-					},
-					{
-						"match": map[string]interface{}{
-							"tweet_type": tweetTypeNormal,
-						},
-					},
-				},
-			},
-		},
+		"query": query.Root(q),
 		"sort": []map[string]interface{}{
 			{
 				orderBy: "desc",
 			},
+			{
+				"id": "asc",
+			},
 		},
 	}
 
+	indexDomain := applyCursor(ctx, t.l, t.es, queryDomain, t.indices.Index(tweetIndex, startDate, endDate), cursor)
 	if errDomain := encodeQuery(&buf, queryDomain); errDomain != nil {
 		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", errDomain))
-		return nil, 0, nil, errDomain
+		return nil, nil, errDomain
 	}
 
-	esResultDomain, errDomain := search(ctx, t.l, t.es, fmt.Sprintf("%s-*", tweetIndex), &buf, count)
+	var warnings []*domain.Warning
+	urls := query.Bool().MinimumShouldMatch(1)
+	esResultDomain, errDomain := searchEach(ctx, t.l, t.es, "tweet.GetByDomain", indexDomain, &buf, count, distinctTweets(func(hit *searchHit) error {
+		tweet := decodeTweet(hit, &warnings)
+		if tweet == nil {
+			return nil
+		}
+		tweet.NestedURL = decodeNestedURLs(hit, &warnings)
+		for _, u := range tweet.NestedURL {
+			urls.Should(query.MatchPhrase("canonical_url", u.CanonicalURL))
+		}
+		return each(tweet)
+	}))
 	if errDomain != nil {
 		t.l.Errorf(fmt.Sprintf("failed to search: %s", errDomain))
-		return nil, 0, nil, errDomain
+		return nil, nil, errDomain
 	}
 
-	hits := int(esResultDomain["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
-
-	for _, hit := range esResultDomain["hits"].(map[string]interface{})["hits"].([]interface{}) {
-		var tweetsUrls []*domain.TweetNestedURL
-		createdAt, errDomain := convertTime(hit.(map[string]interface{})["_source"].(map[string]interface{})["created_at"].(string))
-		if errDomain != nil {
-			t.l.Error(fmt.Sprintf("failed to convert tweet time: %s", errDomain))
-		}
-		for _, url := range hit.(map[string]interface{})["inner_hits"].(map[string]interface{})["nested_url"].(map[string]interface{})["hits"].(map[string]interface{})["hits"].([]interface{}) {
-			tmpUrl = map[string]interface{}{
-				"match_phrase": map[string]interface{}{
-					"canonical_url": url.(map[string]interface{})["_source"].(map[string]interface{})["canonical_url"].(string),
-				},
-			}
-			tweetsUrl := domain.TweetNestedURL{
-				CanonicalURL: url.(map[string]interface{})["_source"].(map[string]interface{})["canonical_url"].(string),
-				Domain:       url.(map[string]interface{})["_source"].(map[string]interface{})["domain"].(string),
-			}
-			tweetsUrls = append(tweetsUrls, &tweetsUrl)
-			queryURLParamsUrl = append(queryURLParamsUrl, tmpUrl)
+	// without nested urls an empty should clause would match every url document
+	if urlQuery := urls.Source(); urlQuery != nil {
+		queryURL := map[string]interface{}{
+			"query": urlQuery,
 		}
 
-		tweet := domain.Tweet{
-			UserID:         hit.(map[string]interface{})["_source"].(map[string]interface{})["user_id"].(string),
-			UserScreenName: hit.(map[string]interface{})["_source"].(map[string]interface{})["user_screen_name"].(string),
-			UserName:       hit.(map[string]interface{})["_source"].(map[string]interface{})["user_name"].(string),
-			TweetID:        hit.(map[string]interface{})["_id"].(string),
-			Text:           hit.(map[string]interface{})["_source"].(map[string]interface{})["tweet"].(string),
-			QuoteCount:     hit.(map[string]interface{})["_source"].(map[string]interface{})["quote_count"].(float64),
-			FavoriteCount:  hit.(map[string]interface{})["_source"].(map[string]interface{})["favorite_count"].(float64),
-			RetweetCount:   hit.(map[string]interface{})["_source"].(map[string]interface{})["retweet_count"].(float64),
-			ReplyCount:     hit.(map[string]interface{})["_source"].(map[string]interface{})["reply_count"].(float64),
-			CreatedAt:      createdAt,
-			NestedURL:      tweetsUrls,
+		if errURL := encodeQuery(&buf, queryURL); errURL != nil {
+			t.l.Errorf(fmt.Sprintf("failed to encode query URL: %s", errURL))
+			return nil, nil, errURL
 		}
-		tweets = append(tweets, &tweet)
-	}
-
-	queryURL := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{
-						"bool": map[string]interface{}{
-							"should": queryURLParamsUrl,
-						},
-					},
-				},
-			},
-		},
-	}
-
-	if errURL := encodeQuery(&buf, queryURL); errURL != nil {
-		t.l.Errorf(fmt.Sprintf("failed to encode query URL: %s", errURL))
-		return nil, 0, nil, errURL
-	}
 
-	//上記Domainのクエリに対して複数のURLが想定されるのでMaxレコード数を増加
-	esResultURL, errURL := search(ctx, t.l, t.es, fmt.Sprintf("%s-*", urlIndex), &buf, 10000)
-	if errURL != nil {
-		t.l.Errorf(fmt.Sprintf("failed to search URL: %s", errURL))
-		return nil, 0, nil, errURL
-	}
+		//上記Domainのクエリに対して複数のURLが想定されるのでMaxレコード数を増加
+		esResultURL, errURL := search(ctx, t.l, t.es, "tweet.GetByDomain.url", fmt.Sprintf("%s-*", urlIndex), &buf, 10000)
+		if errURL != nil {
+			t.l.Errorf(fmt.Sprintf("failed to search URL: %s", errURL))
+			return nil, nil, errURL
+		}
 
-	hitsURL := int(esResultURL["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
-	if hitsURL > 0 {
-		for _, hitURL := range esResultURL["hits"].(map[string]interface{})["hits"].([]interface{}) {
-			var title = ""
-			var description = ""
-			if _, ok := hitURL.(map[string]interface{})["_source"].(map[string]interface{})["unwound"].(map[string]interface{}); ok {
-				if hitURL.(map[string]interface{})["_source"].(map[string]interface{})["unwound"].(map[string]interface{})["title"] != nil {
-					title = hitURL.(map[string]interface{})["_source"].(map[string]interface{})["unwound"].(map[string]interface{})["title"].(string)
-				}
-				if hitURL.(map[string]interface{})["_source"].(map[string]interface{})["unwound"].(map[string]interface{})["description"] != nil {
-					description = hitURL.(map[string]interface{})["_source"].(map[string]interface{})["unwound"].(map[string]interface{})["description"].(string)
-				}
+		for _, hitURL := range esResultURL.Hits.Hits {
+			if u := decodeURL(hitURL, &warnings); u != nil {
+				url_info = append(url_info, u)
 			}
-			tmpURL := domain.URL{
-				URL:         hitURL.(map[string]interface{})["_source"].(map[string]interface{})["canonical_url"].(string),
-				Title:       title,
-				Description: description,
-			}
-			url_info = append(url_info, &tmpURL)
 		}
 	}
+	logWarnings(t.l, "GetByDomain", warnings)
 
+	page := &domain.Page{
+		Hits:       esResultDomain.Hits.Total.Value,
+		NextCursor: nextCursor(esResultDomain, count),
+		Warnings:   warnings,
+	}
 	t.l.Info("function elastic.GetByDomain done")
-	return tweets, hits, url_info, nil
+	return page, url_info, nil
 }
 
-func (t *tweetRepository) GetByMediaType(userID uint64, startDate string, endDate string, count int, orderBy string, mediaType int) ([]*domain.TweetMedia, int, []*domain.Media, error) {
+func (t *tweetRepository) GetByMediaType(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, mediaType int, cursor *domain.Cursor, each func(*domain.TweetMedia) error) (*domain.Page, []*domain.Media, error) {
 
-	var esResultTweet map[string]interface{}
-	var esResultMedia map[string]interface{}
 	var buf bytes.Buffer
-	var tweets []*domain.TweetMedia
 	var media []*domain.Media
-	var queryMediaParamsTweetID []map[string]interface{}
-	var queryTweetParamsMediaType []map[string]interface{}
-	ctx := context.Background()
+	mediaTypes := []int{mediaType}
 	if mediaType == mediaTypeAll {
-		queryTweetParamsMediaType = []map[string]interface{}{
-			{
-				"match_phrase": map[string]interface{}{
-					"media_type": mediaTypePhoto,
-				},
-			},
-			{
-				"match_phrase": map[string]interface{}{
-					"media_type": mediaTypeVideo,
-				},
-			},
-			{
-				"match_phrase": map[string]interface{}{
-					"media_type": mediaTypeGif,
-				},
-			},
-		}
-	} else {
-		queryTweetParamsMediaType = []map[string]interface{}{
-			{
-				"match_phrase": map[string]interface{}{
-					"media_type": mediaType,
-				},
-			},
-		}
+		mediaTypes = []int{mediaTypePhoto, mediaTypeVideo, mediaTypeGif}
+	}
+	types := query.Bool().MinimumShouldMatch(1)
+	for _, mt := range mediaTypes {
+		types.Should(query.MatchPhrase("media_type", mt))
 	}
+	q := query.Bool().
+		Must(
+			query.MatchPhrase("user_id", userID),
+			types,
+		).
+		Filter(
+			query.Range("created_at").Gte(startDate.Format("2006-01-02 15:04:00")).Lte(endDate.Format("2006-01-02 15:04:59")),
+			query.Match("tweet_type", tweetTypeNormal),
+		)
 
 	queryTweet := map[string]interface{}{
-		"collapse": map[string]interface{}{
-			"field": "id",
-		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{
-						"match_phrase": map[string]interface{}{
-							"user_id": userID,
-						},
-					},
-					{
-						"bool": map[string]interface{}{
-							"should": queryTweetParamsMediaType,
-						},
-					},
-				},
-				"filter": []map[string]interface{}{
-					{
-						"range": map[string]interface{}{
-							"created_at": map[string]interface{}{
-								"gte": fmt.Sprintf("%s:00", startDate),
-								"lte": fmt.Sprintf("%s:59", endDate),
-							},
-						},
-					},
-					{
-						"match": map[string]interface{}{
-							"tweet_type": tweetTypeNormal,
-						},
-					},
-				},
-			},
-		},
+		"query": query.Root(q),
 		"sort": []map[string]interface{}{
 			{
 				orderBy: "desc",
 			},
+			{
+				"id": "asc",
+			},
 		},
 	}
 
+	indexTweet := applyCursor(ctx, t.l, t.es, queryTweet, t.indices.Index(tweetIndex, startDate, endDate), cursor)
 	if errTweet := encodeQuery(&buf, queryTweet); errTweet != nil {
 		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", errTweet))
-		return nil, 0, nil, errTweet
+		return nil, nil, errTweet
 	}
 
-	esResultTweet, errTweet := search(ctx, t.l, t.es, fmt.Sprintf("%s-*", tweetIndex), &buf, count)
+	var warnings []*domain.Warning
+	statuses := query.Bool().MinimumShouldMatch(1)
+	found := 0
+	esResultTweet, errTweet := searchEach(ctx, t.l, t.es, "tweet.GetByMediaType", indexTweet, &buf, count, distinctTweets(func(hit *searchHit) error {
+		m, id := decodeTweetMedia(hit, &warnings)
+		if m == nil {
+			return nil
+		}
+		found++
+		statuses.Should(query.MatchPhrase("source_status_id", id))
+		return each(m)
+	}))
 	if errTweet != nil {
 		t.l.Errorf(fmt.Sprintf("failed to search: %s", errTweet))
-		return nil, 0, nil, errTweet
+		return nil, nil, errTweet
 	}
 
-	hits := int(esResultTweet["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
+	// without tweets an empty should clause would match every media document
+	if found > 0 {
+		queryMedia := map[string]interface{}{
+			"collapse": map[string]interface{}{
+				"field": "id",
+			},
+			"query": statuses.Source(),
+		}
 
-	for _, hit := range esResultTweet["hits"].(map[string]interface{})["hits"].([]interface{}) {
+		if errMedia := encodeQuery(&buf, queryMedia); errMedia != nil {
+			t.l.Errorf(fmt.Sprintf("failed to encode query URL: %s", errMedia))
+			return nil, nil, errMedia
+		}
 
-		tmptweetID := map[string]interface{}{
-			"match_phrase": map[string]interface{}{
-				"source_status_id": hit.(map[string]interface{})["_source"].(map[string]interface{})["id"].(string),
-			},
+		esResultMedia, errMedia := search(ctx, t.l, t.es, "tweet.GetByMediaType.media", fmt.Sprintf("%s-*", mediaIndex), &buf, count)
+		if errMedia != nil {
+			t.l.Errorf(fmt.Sprintf("failed to search URL: %s", errMedia))
+			return nil, nil, errMedia
 		}
 
-		Media := domain.TweetMedia{
-			TweetID:       hit.(map[string]interface{})["_id"].(string),
-			MediaType:     hit.(map[string]interface{})["_source"].(map[string]interface{})["media_type"].(float64),
-			FavoriteCount: hit.(map[string]interface{})["_source"].(map[string]interface{})["favorite_count"].(float64),
-			RetweetCount:  hit.(map[string]interface{})["_source"].(map[string]interface{})["retweet_count"].(float64),
+		for _, hitMedia := range esResultMedia.Hits.Hits {
+			if m := decodeMedia(hitMedia, &warnings); m != nil {
+				media = append(media, m)
+			}
 		}
-		tweets = append(tweets, &Media)
-		queryMediaParamsTweetID = append(queryMediaParamsTweetID, tmptweetID)
 	}
+	logWarnings(t.l, "GetByMediaType", warnings)
+	page := &domain.Page{
+		Hits:       esResultTweet.Hits.Total.Value,
+		NextCursor: nextCursor(esResultTweet, count),
+		Warnings:   warnings,
+	}
+	t.l.Info("function elastic.GetByMedia done")
+	return page, media, nil
+}
 
-	queryMedia := map[string]interface{}{
-		"collapse": map[string]interface{}{
-			"field": "id",
-		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should": queryMediaParamsTweetID,
+func (t *tweetRepository) Search(ctx context.Context, sq *domain.SearchQuery, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error) {
+	var buf bytes.Buffer
+
+	q := query.Bool().
+		Must(buildSearchQuery(sq)).
+		Filter(
+			query.Range("created_at").Gte(startDate.Format("2006-01-02 15:04:00")).Lte(endDate.Format("2006-01-02 15:04:59")),
+			query.Match("tweet_type", tweetTypeNormal),
+		)
+
+	body := map[string]interface{}{
+		"query": query.Root(q),
+		"sort": []map[string]interface{}{
+			{
+				orderBy: "desc",
+			},
+			{
+				"id": "asc",
 			},
 		},
 	}
 
-	if errMedia := encodeQuery(&buf, queryMedia); errMedia != nil {
-		t.l.Errorf(fmt.Sprintf("failed to encode query URL: %s", errMedia))
-		return nil, 0, nil, errMedia
+	index := applyCursor(ctx, t.l, t.es, body, t.indices.Index(tweetIndex, startDate, endDate), cursor)
+	if err := encodeQuery(&buf, body); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
+		return nil, err
+	}
+
+	var warnings []*domain.Warning
+	r, err := searchEach(ctx, t.l, t.es, "tweet.Search", index, &buf, count, distinctTweets(func(hit *searchHit) error {
+		if tweet := decodeTweet(hit, &warnings); tweet != nil {
+			return each(tweet)
+		}
+		return nil
+	}))
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
+		return nil, err
+	}
+	logWarnings(t.l, "Search", warnings)
+	page := &domain.Page{
+		Hits:       r.Hits.Total.Value,
+		NextCursor: nextCursor(r, count),
+		Warnings:   warnings,
 	}
+	return page, nil
+}
 
-	esResultMedia, errMedia := search(ctx, t.l, t.es, fmt.Sprintf("%s-*", mediaIndex), &buf, count)
-	if errMedia != nil {
-		t.l.Errorf(fmt.Sprintf("failed to search URL: %s", errMedia))
-		return nil, 0, nil, errMedia
+// buildSearchQuery translates a parsed search expression into an Elasticsearch query clause.
+func buildSearchQuery(q *domain.SearchQuery) query.Query {
+	switch q.Operator {
+	case domain.SearchAnd, domain.SearchOr, domain.SearchNot:
+		children := make([]query.Query, 0, len(q.Children))
+		for _, c := range q.Children {
+			children = append(children, buildSearchQuery(c))
+		}
+		switch q.Operator {
+		case domain.SearchAnd:
+			return query.Bool().Must(children...)
+		case domain.SearchOr:
+			return query.Bool().Should(children...).MinimumShouldMatch(1)
+		default:
+			return query.Bool().MustNot(children...)
+		}
 	}
 
-	for _, hitMedia := range esResultMedia["hits"].(map[string]interface{})["hits"].([]interface{}) {
-		tmpMedia := domain.Media{
-			TweetID:  hitMedia.(map[string]interface{})["_source"].(map[string]interface{})["source_status_id"].(string),
-			MediaURL: hitMedia.(map[string]interface{})["_source"].(map[string]interface{})["media_url_https"].(string),
+	switch q.Field {
+	case domain.SearchFieldFrom:
+		return query.Term("user_screen_name", q.Value)
+	case domain.SearchFieldHashtag:
+		return query.Match("hashtag", q.Value)
+	case domain.SearchFieldDomain:
+		return query.Nested("nested_url", query.MatchPhrase("nested_url.domain", q.Value))
+	case domain.SearchFieldHas:
+		var mediaTypes []int
+		switch q.Value {
+		case "photo":
+			mediaTypes = []int{mediaTypePhoto}
+		case "video":
+			mediaTypes = []int{mediaTypeVideo}
+		case "gif":
+			mediaTypes = []int{mediaTypeGif}
+		default:
+			mediaTypes = []int{mediaTypePhoto, mediaTypeVideo, mediaTypeGif}
 		}
-		media = append(media, &tmpMedia)
+		return query.Terms("media_type", mediaTypes)
 	}
-	t.l.Info("function elastic.GetByMedia done")
-	return tweets, hits, media, nil
+
+	if q.Phrase {
+		return query.MatchPhrase("tweet", q.Value)
+	}
+	return query.Match("tweet", q.Value).Operator("and")
+}
+
+// tweetHourlyAggregations is the aggregations part of the hourly activity responses.
+type tweetHourlyAggregations struct {
+	Hourly struct {
+		Buckets []struct {
+			Key         int64            `json:"key"`
+			DocCount    uint64           `json:"doc_count"`
+			Tweets      valueAggregation `json:"tweets"`
+			FavoriteSum valueAggregation `json:"favorite_sum"`
+			RetweetSum  valueAggregation `json:"retweet_sum"`
+		} `json:"buckets"`
+	} `json:"hourly"`
+}
+
+// HourlyCounts lets Elasticsearch bucket by the hours of loc, which also handles zones whose offset
+// is not a whole number of hours, and counts distinct tweet ids since a tweet may be indexed twice.
+func (t *tweetRepository) HourlyCounts(ctx context.Context, userID uint64, startDate, endDate time.Time, loc *time.Location) ([]*domain.TweetHourlyCount, error) {
+	var buf bytes.Buffer
+
+	if int(endDate.Sub(startDate)/time.Hour)+1 > maxBuckets {
+		return nil, domain.ErrTooManyBuckets
+	}
+	q := query.Bool().
+		Must(query.MatchPhrase("user_id", userID)).
+		Filter(
+			query.Range("created_at").Gte(startDate.Format("2006-01-02 15:04:00")).Lte(endDate.Format("2006-01-02 15:04:59")),
+			query.Match("tweet_type", tweetTypeNormal),
+		)
+	body := map[string]interface{}{
+		"query": query.Root(q),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"hourly": query.DateHistogram("created_at", "1h").
+				TimeZone(loc.String()).
+				SubAggregation("tweets", query.Cardinality("id")).
+				SubAggregation("favorite_sum", query.Sum("favorite_count")).
+				SubAggregation("retweet_sum", query.Sum("retweet_count")),
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
+		return nil, err
+	}
+
+	index := t.indices.Index(tweetIndex, startDate, endDate)
+	r, err := search(ctx, t.l, t.es, "tweet.HourlyCounts", index, &buf, 0)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
+		return nil, err
+	}
+
+	var aggs tweetHourlyAggregations
+	if err := r.decodeAggregations(&aggs); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, err
+	}
+	counts := make([]*domain.TweetHourlyCount, 0, len(aggs.Hourly.Buckets))
+	for _, b := range aggs.Hourly.Buckets {
+		if b.DocCount == 0 {
+			continue
+		}
+		counts = append(counts, &domain.TweetHourlyCount{
+			Hour:        time.Unix(0, b.Key*int64(time.Millisecond)).UTC(),
+			StatusCount: uint64(b.Tweets.Value),
+			DocCount:    b.DocCount,
+			FavoriteSum: b.FavoriteSum.Value,
+			RetweetSum:  b.RetweetSum.Value,
+		})
+	}
+	return counts, nil
+}
+
+// tweetStatsMetrics are the engagement counts summarized by Stats, by name in the aggregations.
+var tweetStatsMetrics = []struct {
+	name  string
+	field string
+	stats func(s *domain.TweetStats) *domain.TweetMetricStats
+}{
+	{"favorite", "favorite_count", func(s *domain.TweetStats) *domain.TweetMetricStats { return &s.Favorite }},
+	{"retweet", "retweet_count", func(s *domain.TweetStats) *domain.TweetMetricStats { return &s.Retweet }},
+	{"reply", "reply_count", func(s *domain.TweetStats) *domain.TweetMetricStats { return &s.Reply }},
+	{"quote", "quote_count", func(s *domain.TweetStats) *domain.TweetMetricStats { return &s.Quote }},
+}
+
+type statsAggregation struct {
+	Count uint64  `json:"count"`
+	Avg   float64 `json:"avg"`
+	Sum   float64 `json:"sum"`
+}
+
+type percentilesAggregation struct {
+	Values []struct {
+		Key   float64 `json:"key"`
+		Value float64 `json:"value"`
+	} `json:"values"`
+}
+
+func (p percentilesAggregation) value(key float64) float64 {
+	for _, v := range p.Values {
+		if v.Key == key {
+			return v.Value
+		}
+	}
+	return 0
+}
+
+type countBuckets struct {
+	Buckets []struct {
+		Key    sourceString     `json:"key"`
+		Tweets valueAggregation `json:"tweets"`
+	} `json:"buckets"`
+}
+
+func (b countBuckets) counts() map[string]uint64 {
+	m := make(map[string]uint64, len(b.Buckets))
+	for _, c := range b.Buckets {
+		m[c.Key.Value] = uint64(c.Tweets.Value)
+	}
+	return m
+}
+
+// Stats counts distinct tweet ids since a tweet may be indexed twice; the engagement statistics
+// are computed over the documents.
+func (t *tweetRepository) Stats(ctx context.Context, userID uint64, startDate, endDate time.Time) (*domain.TweetStats, error) {
+	var buf bytes.Buffer
+
+	q := query.Bool().
+		Must(query.MatchPhrase("user_id", userID)).
+		Filter(query.Range("created_at").Gte(startDate.Format("2006-01-02 15:04:00")).Lte(endDate.Format("2006-01-02 15:04:59")))
+	normal := query.FilterAgg(query.Match("tweet_type", tweetTypeNormal)).
+		SubAggregation("tweets", query.Cardinality("id")).
+		SubAggregation("by_media_type", query.TermsAgg("media_type").
+			SubAggregation("tweets", query.Cardinality("id")))
+	for _, m := range tweetStatsMetrics {
+		normal.SubAggregation(m.name+"_stats", query.Stats(m.field))
+		normal.SubAggregation(m.name+"_percentiles", query.Percentiles(m.field, 50, 90))
+	}
+	body := map[string]interface{}{
+		"query": query.Root(q),
+		"aggs": query.Aggregations(map[string]query.Aggregation{
+			"by_tweet_type": query.TermsAgg("tweet_type").
+				SubAggregation("tweets", query.Cardinality("id")),
+			"normal": normal,
+		}),
+	}
+
+	if err := encodeQuery(&buf, body); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
+		return nil, err
+	}
+
+	index := t.indices.Index(tweetIndex, startDate, endDate)
+	r, err := search(ctx, t.l, t.es, "tweet.Stats", index, &buf, 0)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to search: %s", err))
+		return nil, err
+	}
+
+	var aggs struct {
+		ByTweetType countBuckets               `json:"by_tweet_type"`
+		Normal      map[string]json.RawMessage `json:"normal"`
+	}
+	if err := r.decodeAggregations(&aggs); err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, err
+	}
+	stats, err := decodeTweetStats(aggs.Normal)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to decode aggregations: %s", err))
+		return nil, err
+	}
+	stats.StartDate = startDate
+	stats.EndDate = endDate
+	stats.ByTweetType = aggs.ByTweetType.counts()
+	return stats, nil
+}
+
+// decodeTweetStats decodes the sub aggregations of the normal tweets bucket of Stats.
+func decodeTweetStats(normal map[string]json.RawMessage) (*domain.TweetStats, error) {
+	var tweets valueAggregation
+	var byMediaType countBuckets
+	if err := decodeRaw(normal, "tweets", &tweets); err != nil {
+		return nil, err
+	}
+	if err := decodeRaw(normal, "by_media_type", &byMediaType); err != nil {
+		return nil, err
+	}
+	stats := &domain.TweetStats{
+		StatusCount: uint64(tweets.Value),
+		ByMediaType: byMediaType.counts(),
+	}
+	for _, m := range tweetStatsMetrics {
+		var s statsAggregation
+		var p percentilesAggregation
+		if err := decodeRaw(normal, m.name+"_stats", &s); err != nil {
+			return nil, err
+		}
+		if err := decodeRaw(normal, m.name+"_percentiles", &p); err != nil {
+			return nil, err
+		}
+		*m.stats(stats) = domain.TweetMetricStats{
+			Total:  s.Sum,
+			Avg:    s.Avg,
+			Median: p.value(50),
+			P90:    p.value(90),
+		}
+	}
+	return stats, nil
 }
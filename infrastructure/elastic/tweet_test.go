@@ -0,0 +1,71 @@
+package elastic
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_decodeTweetStats(t *testing.T) {
+	normal := `{
+		"doc_count": 4,
+		"tweets": {"value": 3},
+		"by_media_type": {"buckets": [{"key": 2, "doc_count": 2, "tweets": {"value": 2}}]},
+		"favorite_stats": {"count": 4, "min": 0, "max": 10, "avg": 4.5, "sum": 18},
+		"favorite_percentiles": {"values": [{"key": 50.0, "value": 4.0}, {"key": 90.0, "value": 9.5}]},
+		"retweet_stats": {"count": 4, "min": 0, "max": 1, "avg": 0.5, "sum": 2},
+		"retweet_percentiles": {"values": [{"key": 50.0, "value": 0.5}, {"key": 90.0, "value": 1.0}]},
+		"reply_stats": {"count": 0, "min": null, "max": null, "avg": null, "sum": 0},
+		"reply_percentiles": {"values": [{"key": 50.0, "value": null}, {"key": 90.0, "value": null}]},
+		"quote_stats": {"count": 0, "min": null, "max": null, "avg": null, "sum": 0},
+		"quote_percentiles": {"values": [{"key": 50.0, "value": null}, {"key": 90.0, "value": null}]}
+	}`
+	var aggs map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(normal), &aggs); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := decodeTweetStats(aggs)
+	if err != nil {
+		t.Fatalf("decodeTweetStats() error = %v", err)
+	}
+	if stats.StatusCount != 3 || stats.ByMediaType["2"] != 2 {
+		t.Errorf("counts = %d, %v", stats.StatusCount, stats.ByMediaType)
+	}
+	if f := stats.Favorite; f.Total != 18 || f.Avg != 4.5 || f.Median != 4 || f.P90 != 9.5 {
+		t.Errorf("Favorite = %+v", f)
+	}
+	if stats.Reply.Avg != 0 || stats.Reply.P90 != 0 {
+		t.Errorf("Reply = %+v, want zero without replies", stats.Reply)
+	}
+
+	delete(aggs, "quote_stats")
+	if _, err := decodeTweetStats(aggs); err == nil {
+		t.Errorf("decodeTweetStats() without quote_stats succeeded")
+	}
+}
+
+func Test_distinctTweets(t *testing.T) {
+	// the same tweet in two monthly indices, once with a numeric id
+	body := `{"hits":{"total":{"value":4,"relation":"eq"},"hits":[` +
+		`{"_index":"sns-2020.01","_id":"a","_source":{"id":"10"},"sort":[5,"10"]},` +
+		`{"_index":"sns-2020.02","_id":"b","_source":{"id":10},"sort":[5,"10"]},` +
+		`{"_index":"sns-2020.02","_id":"c","_source":{"id":"11"},"sort":[4,"11"]},` +
+		`{"_index":"sns-2020.02","_id":"d","_source":{},"sort":[3,"12"]}]}}`
+
+	var got []string
+	r, err := decodeSearchResponse(strings.NewReader(body), distinctTweets(func(hit *searchHit) error {
+		got = append(got, hit.Index+"/"+hit.ID)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("decodeSearchResponse() error = %v", err)
+	}
+	if want := []string{"sns-2020.01/a", "sns-2020.02/c", "sns-2020.02/d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hits = %v, want %v", got, want)
+	}
+	// the skipped copy still counts for the page, so that the cursor continues after it
+	if c := nextCursor(r, 4); c == nil || !reflect.DeepEqual(c.SearchAfter, []interface{}{json.Number("3"), "12"}) {
+		t.Errorf("nextCursor() = %+v", c)
+	}
+}
@@ -6,126 +6,94 @@ import (
 	"fmt"
 	"github.com/elastic/go-elasticsearch/v7"
 	"sns-api/domain"
+	"sns-api/infrastructure/elastic/query"
 	"sns-api/logger"
-	"strings"
 	"time"
 )
 
 type userRepository struct {
-	l  logger.Logging
-	es *elasticsearch.Client
+	l       logger.Logging
+	es      *elasticsearch.Client
+	indices *IndexCatalog
 }
 
-func NewUserRepository(logger logger.Logging, conn *elasticsearch.Client) *userRepository {
+func NewUserRepository(logger logger.Logging, conn *elasticsearch.Client, indices *IndexCatalog) *userRepository {
 	return &userRepository{
-		l:  logger,
-		es: conn,
+		l:       logger,
+		es:      conn,
+		indices: indices,
 	}
 }
 
-func (u *userRepository) Search(name, description, language string, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax int, srScoreMin, srScoreMax float64, startDate, endDate time.Time, count int, orderBy string) ([]*domain.User, int, error) {
+func (u *userRepository) Search(ctx context.Context, name, description, language string, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax int, srScoreMin, srScoreMax float64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.User) error) (*domain.Page, error) {
 	var buf bytes.Buffer
-	var users []*domain.User
-	var filterQuery []map[string]interface{}
-	var shouldQuery []map[string]interface{}
-
-	buildQuery(&shouldQuery, name, "match_phrase", "screen_name")
-	buildQuery(&shouldQuery, name, "match_phrase", "name")
-	buildQuery(&shouldQuery, description, "match", "description")
-	buildQuery(&filterQuery, language, "term", "language")
-	buildQuery(&filterQuery, followerMin, "followers_count", "gte")
-	buildQuery(&filterQuery, followerMax, "followers_count", "lte")
-	buildQuery(&filterQuery, statusMin, "statuses_count", "gte")
-	buildQuery(&filterQuery, statusMax, "statuses_count", "lte")
-	buildQuery(&filterQuery, favoriteMin, "favourites_count", "gte")
-	buildQuery(&filterQuery, favoriteMax, "favourites_count", "lte")
-	buildQuery(&filterQuery, followMin, "friends_count", "gte")
-	buildQuery(&filterQuery, followMax, "friends_count", "lte")
-	buildQuery(&filterQuery, listMin, "listed_count", "gte")
-	buildQuery(&filterQuery, listMax, "listed_count", "lte")
-	buildQuery(&filterQuery, srScoreMin, "sr_score", "gte")
-	buildQuery(&filterQuery, srScoreMax, "sr_score", "lte")
-
-	ctx := context.Background()
-
-	query := map[string]interface{}{
+	q := query.Bool().
+		Should(
+			query.MatchPhrase("screen_name", name),
+			query.MatchPhrase("name", name),
+			query.Match("description", description),
+		).
+		MinimumShouldMatch(1).
+		Filter(
+			query.Term("language", language),
+			countRange("followers_count", followerMin, followerMax),
+			countRange("statuses_count", statusMin, statusMax),
+			countRange("favourites_count", favoriteMin, favoriteMax),
+			countRange("friends_count", followMin, followMax),
+			countRange("listed_count", listMin, listMax),
+			scoreRange("sr_score", srScoreMin, srScoreMax),
+		)
+
+	// a user has a document in every monthly index, so the hits are collapsed by id on every
+	// page; collapse cannot be combined with search_after, the walk is paged by offset instead
+	body := map[string]interface{}{
 		"collapse": map[string]interface{}{
 			"field": "id",
 		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should":               shouldQuery,
-				"filter":               filterQuery,
-				"minimum_should_match": 1,
-			},
-		},
+		"query": query.Root(q),
 		"sort": []map[string]interface{}{
 			{
 				orderBy: "desc",
 			},
+			{
+				"id": "asc",
+			},
 		},
 	}
 
-	if err := encodeQuery(&buf, query); err != nil {
+	index, offset := applyOffsetCursor(ctx, u.l, u.es, body, u.indices.Index(userIndex, startDate, endDate), cursor)
+	count = offsetPageSize(offset, count)
+	if err := encodeQuery(&buf, body); err != nil {
 		u.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
-		return nil, 0, err
+		return nil, err
 	}
 
-	mDiff := monthDiff(startDate, endDate)
-	monthList := buildIndexByTimeAdd(userIndex, startDate, mDiff)
-
-	r, err := search(ctx, u.l, u.es, strings.Join(monthList, ","), &buf, count)
+	var warnings []*domain.Warning
+	r, err := searchEach(ctx, u.l, u.es, "user.Search", index, &buf, count, func(hit *searchHit) error {
+		if user := decodeUser(hit, &warnings); user != nil {
+			return each(user)
+		}
+		return nil
+	})
 	if err != nil {
 		u.l.Errorf(fmt.Sprintf("failed to search: %s", err))
-		return nil, 0, err
+		return nil, err
 	}
-
-	hits := int(r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
-	for _, hit := range r["hits"].(map[string]interface{})["hits"].([]interface{}) {
-		description := ""
-		score := 0.0
-		if _, ok := hit.(map[string]interface{})["_source"].(map[string]interface{})["description"].(string); ok {
-			description = hit.(map[string]interface{})["_source"].(map[string]interface{})["description"].(string)
-		}
-		if _, ok := hit.(map[string]interface{})["_source"].(map[string]interface{})["sr_score"].(float64); ok {
-			score = hit.(map[string]interface{})["_source"].(map[string]interface{})["sr_score"].(float64)
-		}
-		user := domain.User{
-			UserID:           hit.(map[string]interface{})["_source"].(map[string]interface{})["id"].(string),
-			UserScreenName:   hit.(map[string]interface{})["_source"].(map[string]interface{})["screen_name"].(string),
-			UserName:         hit.(map[string]interface{})["_source"].(map[string]interface{})["name"].(string),
-			UserDescription:  description,
-			UserImageProfile: hit.(map[string]interface{})["_source"].(map[string]interface{})["profile_image_url_https"].(string),
-			Verified:         hit.(map[string]interface{})["_source"].(map[string]interface{})["verified"].(bool),
-			FollowerCount:    hit.(map[string]interface{})["_source"].(map[string]interface{})["followers_count"].(float64),
-			StatusCount:      hit.(map[string]interface{})["_source"].(map[string]interface{})["statuses_count"].(float64),
-			FavoriteCount:    hit.(map[string]interface{})["_source"].(map[string]interface{})["favourites_count"].(float64),
-			FollowCount:      hit.(map[string]interface{})["_source"].(map[string]interface{})["friends_count"].(float64),
-			ListCount:        hit.(map[string]interface{})["_source"].(map[string]interface{})["listed_count"].(float64),
-			SrScore:          score,
-			CreatedAt:        hit.(map[string]interface{})["_source"].(map[string]interface{})["created_at"].(string),
-		}
-		users = append(users, &user)
+	logWarnings(u.l, "Search", warnings)
+	page := &domain.Page{
+		Hits:       r.Hits.Total.Value,
+		NextCursor: nextOffsetCursor(r, offset, count),
+		Warnings:   warnings,
 	}
-	return users, hits, nil
+	return page, nil
 }
 
-func (u *userRepository) GetById(userID uint64, startDate, endDate time.Time) (*domain.User, int, error) {
+func (u *userRepository) GetById(ctx context.Context, userID uint64, startDate, endDate time.Time) (*domain.User, *domain.Page, error) {
 	var buf bytes.Buffer
 	var user *domain.User
-	ctx := context.Background()
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"filter": []map[string]interface{}{
-					{
-						"match_phrase": map[string]interface{}{
-							"id": userID,
-						},
-					},
-				},
-			},
-		},
+	q := query.Bool().Filter(query.MatchPhrase("id", userID))
+	body := map[string]interface{}{
+		"query": query.Root(q),
 		"sort": []map[string]interface{}{
 			{
 				"inserted_at": "desc",
@@ -133,119 +101,66 @@ func (u *userRepository) GetById(userID uint64, startDate, endDate time.Time) (*
 		},
 	}
 
-	if err := encodeQuery(&buf, query); err != nil {
+	if err := encodeQuery(&buf, body); err != nil {
 		u.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
-		return nil, 0, err
+		return nil, nil, err
 	}
 
-	mDiff := monthDiff(startDate, endDate)
-	monthList := buildIndexByTimeAdd(userIndex, startDate, mDiff)
+	index := u.indices.Index(userIndex, startDate, endDate)
 
-	r, err := search(ctx, u.l, u.es, strings.Join(monthList, ","), &buf, 1)
+	r, err := search(ctx, u.l, u.es, "user.GetById", index, &buf, 1)
 	if err != nil {
 		u.l.Errorf(fmt.Sprintf("failed to search: %s", err))
-		return nil, 0, err
+		return nil, nil, err
 	}
 
-	hits := int(r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
-	for _, hit := range r["hits"].(map[string]interface{})["hits"].([]interface{}) {
-		description := ""
-		score := 0.0
-		if _, ok := hit.(map[string]interface{})["_source"].(map[string]interface{})["description"].(string); ok {
-			description = hit.(map[string]interface{})["_source"].(map[string]interface{})["description"].(string)
-		}
-		if _, ok := hit.(map[string]interface{})["_source"].(map[string]interface{})["sr_score"].(float64); ok {
-			score = hit.(map[string]interface{})["_source"].(map[string]interface{})["sr_score"].(float64)
-		}
-		user = &domain.User{
-			UserID:           hit.(map[string]interface{})["_source"].(map[string]interface{})["id"].(string),
-			UserScreenName:   hit.(map[string]interface{})["_source"].(map[string]interface{})["screen_name"].(string),
-			UserName:         hit.(map[string]interface{})["_source"].(map[string]interface{})["name"].(string),
-			UserDescription:  description,
-			UserImageProfile: hit.(map[string]interface{})["_source"].(map[string]interface{})["profile_image_url_https"].(string),
-			Verified:         hit.(map[string]interface{})["_source"].(map[string]interface{})["verified"].(bool),
-			FollowerCount:    hit.(map[string]interface{})["_source"].(map[string]interface{})["followers_count"].(float64),
-			StatusCount:      hit.(map[string]interface{})["_source"].(map[string]interface{})["statuses_count"].(float64),
-			FavoriteCount:    hit.(map[string]interface{})["_source"].(map[string]interface{})["favourites_count"].(float64),
-			FollowCount:      hit.(map[string]interface{})["_source"].(map[string]interface{})["friends_count"].(float64),
-			ListCount:        hit.(map[string]interface{})["_source"].(map[string]interface{})["listed_count"].(float64),
-			SrScore:          score,
-			CreatedAt:        hit.(map[string]interface{})["_source"].(map[string]interface{})["created_at"].(string),
+	var warnings []*domain.Warning
+	for _, hit := range r.Hits.Hits {
+		if v := decodeUser(hit, &warnings); v != nil {
+			user = v
 		}
 	}
-	return user, hits, nil
+	logWarnings(u.l, "GetById", warnings)
+	return user, &domain.Page{Hits: r.Hits.Total.Value, Warnings: warnings}, nil
 }
 
-func (u *userRepository) GetByIds(userIDs []uint64, startDate, endDate time.Time) ([]*domain.User, int, error) {
+func (u *userRepository) GetByIds(ctx context.Context, userIDs []uint64, startDate, endDate time.Time, each func(*domain.User) error) (*domain.Page, error) {
 	var buf bytes.Buffer
-	var users []*domain.User
-	var userQuery = make([]map[string]interface{}, 0, len(userIDs))
-	ctx := context.Background()
 
+	q := query.Bool().MinimumShouldMatch(1)
 	for _, id := range userIDs {
-		q := map[string]interface{}{
-			"match_phrase": map[string]interface{}{
-				"id": id,
-			},
-		}
-		userQuery = append(userQuery, q)
+		q.Should(query.MatchPhrase("id", id))
 	}
 
-	query := map[string]interface{}{
+	body := map[string]interface{}{
 		"collapse": map[string]interface{}{
 			"field": "id",
 		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should": userQuery,
-			},
-		},
+		"query": query.Root(q),
 		"sort": []map[string]interface{}{
 			{
 				"inserted_at": "desc",
 			},
 		},
 	}
-	if err := encodeQuery(&buf, query); err != nil {
+	if err := encodeQuery(&buf, body); err != nil {
 		u.l.Errorf(fmt.Sprintf("failed to encode query: %s", err))
-		return nil, 0, err
+		return nil, err
 	}
 
-	mDiff := monthDiff(startDate, endDate)
-	monthList := buildIndexByTimeAdd(userIndex, startDate, mDiff)
+	index := u.indices.Index(userIndex, startDate, endDate)
 
-	r, err := search(ctx, u.l, u.es, strings.Join(monthList, ","), &buf, len(userIDs))
+	var warnings []*domain.Warning
+	r, err := searchEach(ctx, u.l, u.es, "user.GetByIds", index, &buf, len(userIDs), func(hit *searchHit) error {
+		if user := decodeUser(hit, &warnings); user != nil {
+			return each(user)
+		}
+		return nil
+	})
 	if err != nil {
 		u.l.Errorf(fmt.Sprintf("failed to search: %s", err))
-		return nil, 0, err
-	}
-
-	hits := int(r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
-	for _, hit := range r["hits"].(map[string]interface{})["hits"].([]interface{}) {
-		description := ""
-		score := 0.0
-		if _, ok := hit.(map[string]interface{})["_source"].(map[string]interface{})["description"].(string); ok {
-			description = hit.(map[string]interface{})["_source"].(map[string]interface{})["description"].(string)
-		}
-		if _, ok := hit.(map[string]interface{})["_source"].(map[string]interface{})["sr_score"].(float64); ok {
-			score = hit.(map[string]interface{})["_source"].(map[string]interface{})["sr_score"].(float64)
-		}
-		user := domain.User{
-			UserID:           hit.(map[string]interface{})["_source"].(map[string]interface{})["id"].(string),
-			UserScreenName:   hit.(map[string]interface{})["_source"].(map[string]interface{})["screen_name"].(string),
-			UserName:         hit.(map[string]interface{})["_source"].(map[string]interface{})["name"].(string),
-			UserDescription:  description,
-			UserImageProfile: hit.(map[string]interface{})["_source"].(map[string]interface{})["profile_image_url_https"].(string),
-			Verified:         hit.(map[string]interface{})["_source"].(map[string]interface{})["verified"].(bool),
-			FollowerCount:    hit.(map[string]interface{})["_source"].(map[string]interface{})["followers_count"].(float64),
-			StatusCount:      hit.(map[string]interface{})["_source"].(map[string]interface{})["statuses_count"].(float64),
-			FavoriteCount:    hit.(map[string]interface{})["_source"].(map[string]interface{})["favourites_count"].(float64),
-			FollowCount:      hit.(map[string]interface{})["_source"].(map[string]interface{})["friends_count"].(float64),
-			ListCount:        hit.(map[string]interface{})["_source"].(map[string]interface{})["listed_count"].(float64),
-			SrScore:          score,
-			CreatedAt:        hit.(map[string]interface{})["_source"].(map[string]interface{})["created_at"].(string),
-		}
-		users = append(users, &user)
+		return nil, err
 	}
-	return users, hits, nil
+	logWarnings(u.l, "GetByIds", warnings)
+	return &domain.Page{Hits: r.Hits.Total.Value, Warnings: warnings}, nil
 }
@@ -0,0 +1,144 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sns-api/domain"
+	"sns-api/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// apiKeyRepository keeps the api keys in a JSON file, for deployments without the corpus database.
+// The file is read once and rewritten on every change.
+type apiKeyRepository struct {
+	l    logger.Logging
+	path string
+
+	mu   sync.RWMutex
+	keys map[string]*domain.APIKey
+}
+
+func NewAPIKeyRepository(logger logger.Logging, path string) (*apiKeyRepository, error) {
+	r := &apiKeyRepository{
+		l:    logger,
+		path: path,
+		keys: map[string]*domain.APIKey{},
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []*domain.APIKey
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		r.keys[k.ID] = k
+	}
+	return r, nil
+}
+
+func (r *apiKeyRepository) Get(ctx context.Context, id string) (*domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.keys[id]
+	if !ok {
+		return nil, domain.ErrAPIKeyNotFound
+	}
+	c := *k
+	return &c, nil
+}
+
+func (r *apiKeyRepository) List(ctx context.Context) ([]*domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sorted(), nil
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := *key
+	r.keys[key.ID] = &c
+	if err := r.save(); err != nil {
+		delete(r.keys, key.ID)
+		return err
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) Rotate(ctx context.Context, id, secretHash string, rotatedAt time.Time) error {
+	return r.update(id, func(k *domain.APIKey) {
+		k.SecretHash = secretHash
+		k.RotatedAt = &rotatedAt
+	})
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, id string, revokedAt time.Time) error {
+	return r.update(id, func(k *domain.APIKey) {
+		k.RevokedAt = &revokedAt
+	})
+}
+
+// update applies f to a copy of an active key and keeps it only if the file could be written.
+func (r *apiKeyRepository) update(id string, f func(k *domain.APIKey)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, ok := r.keys[id]
+	if !ok || prev.Revoked() {
+		return domain.ErrAPIKeyNotFound
+	}
+	k := *prev
+	f(&k)
+	r.keys[id] = &k
+	if err := r.save(); err != nil {
+		r.keys[id] = prev
+		return err
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) sorted() []*domain.APIKey {
+	keys := make([]*domain.APIKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		c := *k
+		keys = append(keys, &c)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// save writes the keys to a temporary file first so that a failed write never truncates the store.
+func (r *apiKeyRepository) save() error {
+	b, err := json.MarshalIndent(r.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
@@ -0,0 +1,58 @@
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sns-api/domain"
+)
+
+// exportFileStore writes the export files as <id>.<format>.gz in a local directory.
+type exportFileStore struct {
+	dir string
+}
+
+func NewExportFileStore(dir string) (*exportFileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &exportFileStore{dir: dir}, nil
+}
+
+func (s *exportFileStore) Path(job *domain.ExportJob) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s.%s.gz", job.ID, job.Format))
+}
+
+// Create writes to a temporary file that Close compresses, syncs and renames into place,
+// so that a download never sees a partial file.
+func (s *exportFileStore) Create(job *domain.ExportJob) (io.WriteCloser, error) {
+	path := s.Path(job)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &gzipFile{Writer: gzip.NewWriter(f), f: f, path: path}, nil
+}
+
+type gzipFile struct {
+	*gzip.Writer
+	f    *os.File
+	path string
+}
+
+func (g *gzipFile) Close() error {
+	err := g.Writer.Close()
+	if err == nil {
+		err = g.f.Sync()
+	}
+	if cerr := g.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(g.f.Name())
+		return err
+	}
+	return os.Rename(g.f.Name(), g.path)
+}
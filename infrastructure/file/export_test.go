@@ -0,0 +1,53 @@
+package file
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"sns-api/domain"
+	"testing"
+)
+
+func TestExportFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewExportFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &domain.ExportJob{ID: "abc", Format: "ndjson"}
+
+	w, err := s.Create(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.Path(job)); !os.IsNotExist(err) {
+		t.Errorf("file exists before Close: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(s.Path(job))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "{}\n" {
+		t.Errorf("file = %q, want %q", b, "{}\n")
+	}
+}
@@ -0,0 +1,154 @@
+package corpus
+
+import (
+	"context"
+	"database/sql"
+	"sns-api/domain"
+	"sns-api/logger"
+	"sns-api/metrics"
+	"strings"
+	"time"
+)
+
+// apiKeyRepository keeps the api keys in the corpus database:
+//
+//	CREATE TABLE api_keys (
+//	  id          VARCHAR(32)  NOT NULL PRIMARY KEY,
+//	  name        VARCHAR(255) NOT NULL,
+//	  secret_hash CHAR(64)     NOT NULL,
+//	  scopes      VARCHAR(255) NOT NULL,
+//	  created_at  DATETIME     NOT NULL,
+//	  rotated_at  DATETIME     NULL,
+//	  revoked_at  DATETIME     NULL
+//	);
+//
+// scopes is a comma separated list and the times are UTC.
+type apiKeyRepository struct {
+	l  logger.Logging
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(logger logger.Logging, db *sql.DB) *apiKeyRepository {
+	return &apiKeyRepository{
+		l:  logger,
+		db: db,
+	}
+}
+
+const apiKeyColumns = `id, name, secret_hash, scopes, created_at, rotated_at, revoked_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// datetimeLayout is how DATETIME columns are read; the connection does not set parseTime
+// because the other corpus queries hand the column through as a string.
+const datetimeLayout = "2006-01-02 15:04:05"
+
+func scanAPIKey(row rowScanner) (*domain.APIKey, error) {
+	k := &domain.APIKey{}
+	var scopes, createdAt string
+	var rotatedAt, revokedAt sql.NullString
+	if err := row.Scan(&k.ID, &k.Name, &k.SecretHash, &scopes, &createdAt, &rotatedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+	var err error
+	if k.CreatedAt, err = time.Parse(datetimeLayout, createdAt); err != nil {
+		return nil, err
+	}
+	if k.RotatedAt, err = parseNullTime(rotatedAt); err != nil {
+		return nil, err
+	}
+	if k.RevokedAt, err = parseNullTime(revokedAt); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func parseNullTime(s sql.NullString) (*time.Time, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	t, err := time.Parse(datetimeLayout, s.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *apiKeyRepository) Get(ctx context.Context, id string) (*domain.APIKey, error) {
+	start := time.Now()
+	row := r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id)
+	k, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		metrics.ObserveQuery("corpus.GetAPIKey", time.Since(start), nil)
+		return nil, domain.ErrAPIKeyNotFound
+	}
+	metrics.ObserveQuery("corpus.GetAPIKey", time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (r *apiKeyRepository) List(ctx context.Context) ([]*domain.APIKey, error) {
+	start := time.Now()
+	rows, err := r.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at`)
+	metrics.ObserveQuery("corpus.ListAPIKeys", time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []*domain.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *domain.APIKey) error {
+	start := time.Now()
+	_, err := r.db.ExecContext(ctx, `INSERT INTO api_keys (id, name, secret_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?)`,
+		key.ID, key.Name, key.SecretHash, strings.Join(key.Scopes, ","), key.CreatedAt.UTC().Format(datetimeLayout))
+	metrics.ObserveQuery("corpus.CreateAPIKey", time.Since(start), err)
+	return err
+}
+
+func (r *apiKeyRepository) Rotate(ctx context.Context, id, secretHash string, rotatedAt time.Time) error {
+	start := time.Now()
+	res, err := r.db.ExecContext(ctx, `UPDATE api_keys SET secret_hash = ?, rotated_at = ? WHERE id = ? AND revoked_at IS NULL`, secretHash, rotatedAt.UTC().Format(datetimeLayout), id)
+	metrics.ObserveQuery("corpus.RotateAPIKey", time.Since(start), err)
+	return affectedOne(res, err)
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, id string, revokedAt time.Time) error {
+	start := time.Now()
+	res, err := r.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, revokedAt.UTC().Format(datetimeLayout), id)
+	metrics.ObserveQuery("corpus.RevokeAPIKey", time.Since(start), err)
+	return affectedOne(res, err)
+}
+
+// affectedOne maps an update that matched no active key to domain.ErrAPIKeyNotFound.
+func affectedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+	return nil
+}
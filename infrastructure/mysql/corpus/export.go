@@ -0,0 +1,120 @@
+package corpus
+
+import (
+	"context"
+	"database/sql"
+	"sns-api/domain"
+	"sns-api/logger"
+	"sns-api/metrics"
+	"time"
+)
+
+// exportJobRepository tracks the export jobs in the corpus database:
+//
+//	CREATE TABLE export_jobs (
+//	  id          VARCHAR(32)   NOT NULL PRIMARY KEY,
+//	  key_id      VARCHAR(32)   NOT NULL,
+//	  kind        VARCHAR(32)   NOT NULL,
+//	  format      VARCHAR(16)   NOT NULL,
+//	  bom         TINYINT(1)    NOT NULL,
+//	  params      TEXT          NOT NULL,
+//	  status      VARCHAR(16)   NOT NULL,
+//	  row_count   BIGINT        NOT NULL,
+//	  error       VARCHAR(1024) NOT NULL,
+//	  created_at  DATETIME      NOT NULL,
+//	  updated_at  DATETIME      NOT NULL,
+//	  finished_at DATETIME      NULL,
+//	  INDEX (status)
+//	);
+//
+// key_id is empty for jobs created without authentication and the times are UTC.
+type exportJobRepository struct {
+	l  logger.Logging
+	db *sql.DB
+}
+
+func NewExportJobRepository(logger logger.Logging, db *sql.DB) *exportJobRepository {
+	return &exportJobRepository{
+		l:  logger,
+		db: db,
+	}
+}
+
+// exportErrorSize is the length of the error column.
+const exportErrorSize = 1024
+
+func (r *exportJobRepository) Create(ctx context.Context, job *domain.ExportJob) error {
+	start := time.Now()
+	_, err := r.db.ExecContext(ctx, `INSERT INTO export_jobs (id, key_id, kind, format, bom, params, status, row_count, error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.KeyID, job.Kind, job.Format, job.BOM, string(job.Params), job.Status, job.Rows, truncate(job.Error, exportErrorSize),
+		job.CreatedAt.UTC().Format(datetimeLayout), job.UpdatedAt.UTC().Format(datetimeLayout))
+	metrics.ObserveQuery("corpus.CreateExportJob", time.Since(start), err)
+	return err
+}
+
+func (r *exportJobRepository) Get(ctx context.Context, id string) (*domain.ExportJob, error) {
+	start := time.Now()
+	row := r.db.QueryRowContext(ctx, `SELECT id, key_id, kind, format, bom, params, status, row_count, error, created_at, updated_at, finished_at
+		FROM export_jobs WHERE id = ?`, id)
+	job := &domain.ExportJob{}
+	var params, createdAt, updatedAt string
+	var finishedAt sql.NullString
+	err := row.Scan(&job.ID, &job.KeyID, &job.Kind, &job.Format, &job.BOM, &params, &job.Status, &job.Rows, &job.Error, &createdAt, &updatedAt, &finishedAt)
+	if err == sql.ErrNoRows {
+		metrics.ObserveQuery("corpus.GetExportJob", time.Since(start), nil)
+		return nil, domain.ErrExportNotFound
+	}
+	metrics.ObserveQuery("corpus.GetExportJob", time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	job.Params = []byte(params)
+	if job.CreatedAt, err = time.Parse(datetimeLayout, createdAt); err != nil {
+		return nil, err
+	}
+	if job.UpdatedAt, err = time.Parse(datetimeLayout, updatedAt); err != nil {
+		return nil, err
+	}
+	if job.FinishedAt, err = parseNullTime(finishedAt); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (r *exportJobRepository) Update(ctx context.Context, job *domain.ExportJob) error {
+	var finishedAt interface{}
+	if job.FinishedAt != nil {
+		finishedAt = job.FinishedAt.UTC().Format(datetimeLayout)
+	}
+	start := time.Now()
+	_, err := r.db.ExecContext(ctx, `UPDATE export_jobs SET status = ?, row_count = ?, error = ?, updated_at = ?, finished_at = ? WHERE id = ?`,
+		job.Status, job.Rows, truncate(job.Error, exportErrorSize), job.UpdatedAt.UTC().Format(datetimeLayout), finishedAt, job.ID)
+	metrics.ObserveQuery("corpus.UpdateExportJob", time.Since(start), err)
+	// MySQL counts unchanged rows as unaffected, so a progress update within the same second
+	// cannot be told from a missing job and the row count is not checked
+	return err
+}
+
+func (r *exportJobRepository) FailUnfinished(ctx context.Context, reason string, at time.Time) (int64, error) {
+	t := at.UTC().Format(datetimeLayout)
+	start := time.Now()
+	res, err := r.db.ExecContext(ctx, `UPDATE export_jobs SET status = ?, error = ?, updated_at = ?, finished_at = ? WHERE status IN (?, ?)`,
+		domain.ExportFailed, truncate(reason, exportErrorSize), t, t, domain.ExportQueued, domain.ExportRunning)
+	metrics.ObserveQuery("corpus.FailUnfinishedExportJobs", time.Since(start), err)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
@@ -1,10 +1,13 @@
 package corpus
 
 import (
+	"context"
 	"database/sql"
 	_ "github.com/go-sql-driver/mysql"
 	"sns-api/domain"
 	"sns-api/logger"
+	"sns-api/metrics"
+	"time"
 )
 
 type tweetRepository struct {
@@ -19,28 +22,60 @@ func NewTweetRepository(logger logger.Logging, db *sql.DB) *tweetRepository {
 	}
 }
 
-func (t *tweetRepository) GetTransitionByUser(userID uint64, startDate, endDate string, count int) ([]*domain.TweetTransition, error) {
-	sql := `SELECT user_id, followers_count, friends_count, listed_count, favourites_count, statuses_count, created_at
-			FROM tw_fullarchive_user_data
+func (t *tweetRepository) GetTransitionByUser(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, cursor *domain.Cursor) ([]*domain.TweetTransition, *domain.Page, error) {
+	where := `
 			WHERE user_id = ?
-			  AND created_at BETWEEN ? AND ?
-			ORDER BY created_at DESC
+			  AND created_at BETWEEN ? AND ?`
+	args := []interface{}{userID, startDate.UTC().Format(datetimeLayout), endDate.UTC().Format(datetimeLayout)}
+
+	start := time.Now()
+	var hits int
+	err := t.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM tw_fullarchive_user_data`+where, args...).Scan(&hits)
+	metrics.ObserveQuery("corpus.CountTransitionByUser", time.Since(start), err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sql := `SELECT id, user_id, followers_count, friends_count, listed_count, favourites_count, statuses_count, created_at
+			FROM tw_fullarchive_user_data` + where
+	if cursor != nil {
+		if len(cursor.SearchAfter) != 2 {
+			return nil, nil, domain.ErrInvalidCursor
+		}
+		// snapshots can share created_at, so the id breaks the tie across page boundaries
+		sql += `
+			  AND (created_at, id) < (?, ?)`
+		args = append(args, cursor.SearchAfter...)
+	}
+	sql += `
+			ORDER BY created_at DESC, id DESC
 			LIMIT ?`
-	rows, err := t.db.Query(sql, userID, startDate, endDate, count)
+	args = append(args, count)
+
+	start = time.Now()
+	rows, err := t.db.QueryContext(ctx, sql, args...)
+	metrics.ObserveQuery("corpus.GetTransitionByUser", time.Since(start), err)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 	var tts []*domain.TweetTransition
+	var lastID uint64
 	for rows.Next() {
 		tt := &domain.TweetTransition{}
-		if err = rows.Scan(&tt.UserID, &tt.FollowerCount, &tt.FriendCount, &tt.ListedCount, &tt.FavoriteCount, &tt.StatusCount, &tt.CreatedAt); err != nil {
-			return nil, err
+		if err = rows.Scan(&lastID, &tt.UserID, &tt.FollowerCount, &tt.FriendCount, &tt.ListedCount, &tt.FavoriteCount, &tt.StatusCount, &tt.CreatedAt); err != nil {
+			return nil, nil, err
 		}
 		tts = append(tts, tt)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	page := &domain.Page{
+		Hits: hits,
+	}
+	if len(tts) == count {
+		page.NextCursor = &domain.Cursor{SearchAfter: []interface{}{tts[len(tts)-1].CreatedAt, lastID}}
 	}
-	return tts, nil
+	return tts, page, nil
 }
@@ -23,7 +23,7 @@ func main() {
 	}
 }
 
-func setup() (*gin.Engine, *config.Config) {
+func load() (*config.Config, logger.Logging) {
 	c, err := config.NewConfig(AppEnvironment)
 	if err != nil {
 		log.Fatalf("cannot load config: %v", err)
@@ -35,8 +35,18 @@ func setup() (*gin.Engine, *config.Config) {
 	if c.Env == "prod" {
 		gin.SetMode(gin.ReleaseMode)
 	}
+	return c, l
+}
+
+func newEngine() *gin.Engine {
 	r := gin.New()
 	r.Use(gin.Recovery())
+	return r
+}
+
+func setup() (*gin.Engine, *config.Config) {
+	c, l := load()
+	r := newEngine()
 
 	server := api.NewServer(r, c, l)
 	server.NewRouter()
@@ -44,6 +54,9 @@ func setup() (*gin.Engine, *config.Config) {
 }
 
 func run() error {
-	r, c := setup()
-	return r.Run(fmt.Sprintf(":%s", c.Port))
+	c, l := load()
+
+	server := api.NewServer(newEngine(), c, l)
+	server.NewRouter()
+	return server.Run()
 }
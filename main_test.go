@@ -6,13 +6,15 @@ import (
 	"github.com/go-playground/assert/v2"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
 
 type TestResp struct {
-	Hits int
-	Res  interface{}
+	Hits       int
+	Res        interface{}
+	NextCursor string `json:"next_cursor"`
 }
 
 var (
@@ -58,12 +60,35 @@ func TestHealth(t *testing.T) {
 				assert.Equal(t, "{\"message\":\"success\"}", rec.Body.String())
 			},
 		},
+		{
+			name: "live",
+			call: func(t *testing.T) {
+				router, _ := setup()
+				req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", apiV1, "health/live"), nil)
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "{\"status\":\"ok\"}", rec.Body.String())
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, tt.call)
 	}
 }
 
+func TestMetrics(t *testing.T) {
+	router, _ := setup()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", apiV1, "health/live"), nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, true, strings.Contains(rec.Body.String(), `sns_api_http_requests_total{method="GET",route="/api/v1/health/live",status="200"}`))
+}
+
 func TestTweetsUser(t *testing.T) {
 	t.Helper()
 	tests := []struct {
@@ -107,6 +132,55 @@ func TestTweetsUser(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "invalid cursor",
+			call: func(t *testing.T) {
+				router, _ := setup()
+				req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", apiV1, "tweets/user"), nil)
+				params := req.URL.Query()
+				params.Add("user_id", userID)
+				params.Add("start_date", startDatetime)
+				params.Add("end_date", endDatetime)
+				params.Add("cursor", "not a cursor")
+				req.URL.RawQuery = params.Encode()
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			},
+		},
+		{
+			name: "ok with cursor",
+			call: func(t *testing.T) {
+				router, _ := setup()
+				var pages []TestResp
+				cursor := ""
+				for i := 0; i < 2; i++ {
+					req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", apiV1, "tweets/user"), nil)
+					params := req.URL.Query()
+					params.Add("user_id", userID)
+					params.Add("start_date", startDatetime)
+					params.Add("end_date", endDatetime)
+					params.Add("count", "1")
+					params.Add("cursor", cursor)
+					req.URL.RawQuery = params.Encode()
+					rec := httptest.NewRecorder()
+					router.ServeHTTP(rec, req)
+					var resp TestResp
+					if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+						t.Errorf("error=%s", err)
+					}
+					assert.Equal(t, http.StatusOK, rec.Code)
+					if resp.NextCursor == "" {
+						t.Fatalf("page %d: next_cursor is empty", i)
+					}
+					pages = append(pages, resp)
+					cursor = resp.NextCursor
+				}
+				if pages[0].NextCursor == pages[1].NextCursor {
+					t.Errorf("next_cursor = %v for both pages, want different", pages[0].NextCursor)
+				}
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, tt.call)
@@ -317,6 +391,56 @@ func TestTweetsTransition(t *testing.T) {
 	}
 }
 
+func TestTweetsSearch(t *testing.T) {
+	t.Helper()
+	tests := []struct {
+		name string
+		call func(t *testing.T)
+	}{
+		{
+			name: "invalid query",
+			call: func(t *testing.T) {
+				router, _ := setup()
+				req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", apiV1, "tweets/search"), nil)
+				params := req.URL.Query()
+				params.Add("q", fmt.Sprintf("(\"%s\" OR", keyword))
+				params.Add("start_date", startDatetime)
+				params.Add("end_date", endDatetime)
+				req.URL.RawQuery = params.Encode()
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			},
+		},
+		{
+			name: "ok",
+			call: func(t *testing.T) {
+				router, _ := setup()
+				req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", apiV1, "tweets/search"), nil)
+				params := req.URL.Query()
+				params.Add("q", fmt.Sprintf("%s from:%s -has:media", keyword, screenName))
+				params.Add("start_date", startDatetime)
+				params.Add("end_date", endDatetime)
+				params.Add("count", count)
+				req.URL.RawQuery = params.Encode()
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				var resp TestResp
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Errorf("error=%s", err)
+				}
+				assert.Equal(t, http.StatusOK, rec.Code)
+				if resp.Hits <= 0 {
+					t.Errorf("hits = %v, want > 0", resp.Hits)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, tt.call)
+	}
+}
+
 func TestHashtags(t *testing.T) {
 	t.Helper()
 	tests := []struct {
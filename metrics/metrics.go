@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "sns_api"
+
+// backend latencies reach well past the default buckets when a search fans out over many monthly indices
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   latencyBuckets,
+	}, []string{"route", "method", "status"})
+
+	httpRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Number of HTTP requests rejected for exceeding the client's budget by route.",
+	}, []string{"route"})
+
+	esDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "elasticsearch",
+		Name:      "search_duration_seconds",
+		Help:      "Round trip latency of Elasticsearch searches by repository method, index pattern and result.",
+		Buckets:   latencyBuckets,
+	}, []string{"op", "index", "result"})
+
+	esTook = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "elasticsearch",
+		Name:      "search_took_seconds",
+		Help:      "Search time reported by Elasticsearch (took) by repository method and index pattern.",
+		Buckets:   latencyBuckets,
+	}, []string{"op", "index"})
+
+	esHits = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "elasticsearch",
+		Name:      "search_hits",
+		Help:      "Total hits of Elasticsearch searches by repository method and index pattern.",
+		Buckets:   prometheus.ExponentialBuckets(1, 10, 8),
+	}, []string{"op", "index"})
+
+	esIndices = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "elasticsearch",
+		Name:      "search_indices",
+		Help:      "Number of indices a search fans out to by repository method.",
+		Buckets:   []float64{1, 2, 3, 6, 12, 24, 36, 60, 120},
+	}, []string{"op"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Number of repository cache lookups by repository method and result.",
+	}, []string{"op", "result"})
+
+	mysqlDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "mysql",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of corpus queries by repository method and result.",
+		Buckets:   latencyBuckets,
+	}, []string{"op", "result"})
+)
+
+// Handler serves the collected metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records one served HTTP request. route is the matched route pattern,
+// never the raw path, so that the label set stays bounded.
+func ObserveRequest(route, method string, status int, d time.Duration) {
+	s := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, s).Inc()
+	httpDuration.WithLabelValues(route, method, s).Observe(d.Seconds())
+}
+
+// ObserveRateLimited records one request rejected by the rate limiter.
+func ObserveRateLimited(route string) {
+	httpRateLimited.WithLabelValues(route).Inc()
+}
+
+// ObserveSearch records the client side latency and the fan-out of one search.
+func ObserveSearch(op, index string, indices int, d time.Duration, err error) {
+	esDuration.WithLabelValues(op, index, result(err)).Observe(d.Seconds())
+	esIndices.WithLabelValues(op).Observe(float64(indices))
+}
+
+// ObserveSearchResponse records what Elasticsearch reported for one successful search.
+func ObserveSearchResponse(op, index string, took int, hits int) {
+	esTook.WithLabelValues(op, index).Observe(float64(took) / 1000)
+	esHits.WithLabelValues(op, index).Observe(float64(hits))
+}
+
+// ObserveQuery records the latency of one corpus query.
+func ObserveQuery(op string, d time.Duration, err error) {
+	mysqlDuration.WithLabelValues(op, result(err)).Observe(d.Seconds())
+}
+
+// ObserveCache records one repository cache lookup.
+func ObserveCache(op string, hit bool) {
+	r := "miss"
+	if hit {
+		r = "hit"
+	}
+	cacheLookups.WithLabelValues(op, r).Inc()
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,139 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sns-api/datetime"
+	"sns-api/domain"
+	"sns-api/logger"
+	"time"
+)
+
+type APIKeyUseCase interface {
+	Authenticate(ctx context.Context, token string) (*domain.APIKey, error)
+	List(ctx context.Context) ([]*domain.APIKey, error)
+	Create(ctx context.Context, name string, scopes []string) (*domain.APIKey, string, error)
+	Rotate(ctx context.Context, id string) (*domain.APIKey, string, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+type apiKeyUseCase struct {
+	l                logger.Logging
+	apiKeyRepository domain.APIKeyRepository
+}
+
+func NewAPIKeyUseCase(l logger.Logging, ar domain.APIKeyRepository) APIKeyUseCase {
+	return &apiKeyUseCase{
+		l:                l,
+		apiKeyRepository: ar,
+	}
+}
+
+// Authenticate returns the active key the token was issued for, or domain.ErrInvalidAPIKey.
+func (au *apiKeyUseCase) Authenticate(ctx context.Context, token string) (*domain.APIKey, error) {
+	id, secret, err := domain.ParseAPIKey(token)
+	if err != nil {
+		return nil, err
+	}
+	key, err := au.apiKeyRepository.Get(ctx, id)
+	if err == domain.ErrAPIKeyNotFound {
+		return nil, domain.ErrInvalidAPIKey
+	}
+	if err != nil {
+		au.l.Errorf(fmt.Sprintf("failed to Get api key: %v", err))
+		return nil, err
+	}
+	if key.Revoked() || !key.Verify(secret) {
+		return nil, domain.ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+func (au *apiKeyUseCase) List(ctx context.Context) ([]*domain.APIKey, error) {
+	keys, err := au.apiKeyRepository.List(ctx)
+	if err != nil {
+		au.l.Errorf(fmt.Sprintf("failed to List api keys: %v", err))
+		return nil, err
+	}
+	localized := make([]*domain.APIKey, len(keys))
+	for i, key := range keys {
+		localized[i] = localizeKey(ctx, key)
+	}
+	return localized, nil
+}
+
+// Create issues a new key and returns it with its token, which is not stored and cannot be shown again.
+func (au *apiKeyUseCase) Create(ctx context.Context, name string, scopes []string) (*domain.APIKey, string, error) {
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	key := &domain.APIKey{
+		ID:         id,
+		Name:       name,
+		SecretHash: domain.HashAPIKeySecret(secret),
+		Scopes:     scopes,
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	if err := au.apiKeyRepository.Create(ctx, key); err != nil {
+		au.l.Errorf(fmt.Sprintf("failed to Create api key: %v", err))
+		return nil, "", err
+	}
+	au.l.Infof(fmt.Sprintf("api key %s created with scopes %v", key.ID, key.Scopes))
+	return localizeKey(ctx, key), domain.FormatAPIKey(id, secret), nil
+}
+
+// Rotate replaces the secret of a key; the previous token stops working immediately.
+func (au *apiKeyUseCase) Rotate(ctx context.Context, id string) (*domain.APIKey, string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := au.apiKeyRepository.Rotate(ctx, id, domain.HashAPIKeySecret(secret), time.Now().UTC().Truncate(time.Second)); err != nil {
+		au.l.Errorf(fmt.Sprintf("failed to Rotate api key %s: %v", id, err))
+		return nil, "", err
+	}
+	key, err := au.apiKeyRepository.Get(ctx, id)
+	if err != nil {
+		au.l.Errorf(fmt.Sprintf("failed to Get api key %s: %v", id, err))
+		return nil, "", err
+	}
+	au.l.Infof(fmt.Sprintf("api key %s rotated", id))
+	return localizeKey(ctx, key), domain.FormatAPIKey(id, secret), nil
+}
+
+// localizeKey returns a copy of key in the zone of the request. The stores may hand out the
+// keys they hold, which Authenticate reads concurrently, so they are not changed in place.
+func localizeKey(ctx context.Context, key *domain.APIKey) *domain.APIKey {
+	localized := *key
+	localized.Localize(datetime.LocationFromContext(ctx))
+	return &localized
+}
+
+func (au *apiKeyUseCase) Revoke(ctx context.Context, id string) error {
+	if err := au.apiKeyRepository.Revoke(ctx, id, time.Now().UTC().Truncate(time.Second)); err != nil {
+		au.l.Errorf(fmt.Sprintf("failed to Revoke api key %s: %v", id, err))
+		return err
+	}
+	au.l.Infof(fmt.Sprintf("api key %s revoked", id))
+	return nil
+}
+
+func newSecret() (string, error) {
+	return randomString(32, base64.RawURLEncoding.EncodeToString)
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
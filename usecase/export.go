@@ -0,0 +1,313 @@
+package usecase
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sns-api/datetime"
+	"sns-api/domain"
+	"sns-api/export"
+	"sns-api/logger"
+	"sync"
+	"time"
+)
+
+type ExportUseCase interface {
+	ExportTweets(ctx context.Context, format string, bom bool, params *domain.ExportTweetsParams) (*domain.ExportJob, error)
+	ExportHashtags(ctx context.Context, format string, bom bool, filter *domain.HashtagFilter) (*domain.ExportJob, error)
+	Get(ctx context.Context, id string) (*domain.ExportJob, error)
+	// File returns a succeeded job and the path of its file.
+	File(ctx context.Context, id string) (*domain.ExportJob, string, error)
+	// Start fails the jobs a previous process left unfinished and starts the workers.
+	Start()
+	// Close stops the workers, failing the jobs they were running.
+	Close()
+}
+
+// exportPageSize is how many documents an export job reads per search.
+const exportPageSize = 1000
+
+// exportSaveTimeout bounds the status updates, which also run after the job context is cancelled.
+const exportSaveTimeout = 10 * time.Second
+
+// exportTask is a queued job and the function writing its rows, which reports the rows
+// written so far to progress after every page.
+type exportTask struct {
+	job   *domain.ExportJob
+	row   interface{}
+	write func(ctx context.Context, enc export.Encoder, progress func(rows int64)) (int64, error)
+}
+
+type exportUseCase struct {
+	l                 logger.Logging
+	jobRepository     domain.ExportJobRepository
+	files             domain.ExportFileStore
+	tweetRepository   domain.TweetRepository
+	hashtagRepository domain.HashtagRepository
+	workers           int
+	timeout           time.Duration
+
+	queue  chan *exportTask
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewExportUseCase runs the jobs on workers goroutines, with up to queueSize jobs waiting
+// and each job bounded by timeout.
+func NewExportUseCase(l logger.Logging, jr domain.ExportJobRepository, fs domain.ExportFileStore, tr domain.TweetRepository, hr domain.HashtagRepository, workers, queueSize int, timeout time.Duration) ExportUseCase {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &exportUseCase{
+		l:                 l,
+		jobRepository:     jr,
+		files:             fs,
+		tweetRepository:   tr,
+		hashtagRepository: hr,
+		workers:           workers,
+		timeout:           timeout,
+		queue:             make(chan *exportTask, queueSize),
+		ctx:               ctx,
+		cancel:            cancel,
+	}
+}
+
+func (eu *exportUseCase) Start() {
+	ctx, cancel := context.WithTimeout(eu.ctx, exportSaveTimeout)
+	defer cancel()
+	n, err := eu.jobRepository.FailUnfinished(ctx, "interrupted by a restart", time.Now().UTC().Truncate(time.Second))
+	if err != nil {
+		eu.l.Warnf(fmt.Sprintf("failed to fail unfinished exports: %v", err))
+	} else if n > 0 {
+		eu.l.Infof(fmt.Sprintf("%d unfinished exports failed", n))
+	}
+	for i := 0; i < eu.workers; i++ {
+		eu.wg.Add(1)
+		go eu.work()
+	}
+}
+
+func (eu *exportUseCase) Close() {
+	eu.cancel()
+	eu.wg.Wait()
+}
+
+func (eu *exportUseCase) work() {
+	defer eu.wg.Done()
+	for {
+		select {
+		case <-eu.ctx.Done():
+			return
+		case t := <-eu.queue:
+			eu.run(t)
+		}
+	}
+}
+
+func (eu *exportUseCase) ExportTweets(ctx context.Context, format string, bom bool, params *domain.ExportTweetsParams) (*domain.ExportJob, error) {
+	loc, err := datetime.LoadLocation(params.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	job, err := eu.create(ctx, domain.ExportTweets, format, bom, params)
+	if err != nil {
+		return nil, err
+	}
+	return eu.enqueue(ctx, &exportTask{
+		job: job,
+		row: (*domain.Tweet)(nil),
+		write: func(ctx context.Context, enc export.Encoder, progress func(rows int64)) (int64, error) {
+			var rows int64
+			var cursor *domain.Cursor
+			for {
+				page, err := eu.tweetRepository.GetByUsers(ctx, params.UserIDs, params.StartDate, params.EndDate, exportPageSize, params.OrderBy, cursor, func(t *domain.Tweet) error {
+					t.Localize(loc)
+					if err := enc.Encode(t); err != nil {
+						return err
+					}
+					rows++
+					return nil
+				})
+				if err != nil {
+					return rows, err
+				}
+				progress(rows)
+				if page.NextCursor == nil {
+					return rows, nil
+				}
+				cursor = page.NextCursor
+			}
+		},
+	})
+}
+
+func (eu *exportUseCase) ExportHashtags(ctx context.Context, format string, bom bool, filter *domain.HashtagFilter) (*domain.ExportJob, error) {
+	job, err := eu.create(ctx, domain.ExportHashtags, format, bom, filter)
+	if err != nil {
+		return nil, err
+	}
+	return eu.enqueue(ctx, &exportTask{
+		job: job,
+		row: (*domain.Hashtag)(nil),
+		write: func(ctx context.Context, enc export.Encoder, progress func(rows int64)) (int64, error) {
+			var rows int64
+			var cursor *domain.Cursor
+			for {
+				// the ranking of Get ends at the bucket limit, so the export walks the hashtags by name
+				hashtags, page, err := eu.hashtagRepository.GetByName(ctx, filter, exportPageSize, cursor)
+				if err != nil {
+					return rows, err
+				}
+				for _, h := range hashtags {
+					if err := enc.Encode(h); err != nil {
+						return rows, err
+					}
+					rows++
+				}
+				progress(rows)
+				if page.NextCursor == nil {
+					return rows, nil
+				}
+				cursor = page.NextCursor
+			}
+		},
+	})
+}
+
+func (eu *exportUseCase) Get(ctx context.Context, id string) (*domain.ExportJob, error) {
+	job, err := eu.jobRepository.Get(ctx, id)
+	if err != nil {
+		if !errors.Is(err, domain.ErrExportNotFound) {
+			eu.l.Errorf(fmt.Sprintf("failed to Get export %s: %v", id, err))
+		}
+		return nil, err
+	}
+	// the jobs of other keys are not found rather than forbidden, so their ids are not confirmed
+	if key := domain.APIKeyFromContext(ctx); job.KeyID != keyID(key) && (key == nil || !key.HasScope(domain.ScopeAdmin)) {
+		return nil, domain.ErrExportNotFound
+	}
+	job.Localize(datetime.LocationFromContext(ctx))
+	return job, nil
+}
+
+func (eu *exportUseCase) File(ctx context.Context, id string) (*domain.ExportJob, string, error) {
+	job, err := eu.Get(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if job.Status != domain.ExportSucceeded {
+		return nil, "", domain.ErrExportNotReady
+	}
+	return job, eu.files.Path(job), nil
+}
+
+func keyID(key *domain.APIKey) string {
+	if key == nil {
+		return ""
+	}
+	return key.ID
+}
+
+func (eu *exportUseCase) create(ctx context.Context, kind, format string, bom bool, params interface{}) (*domain.ExportJob, error) {
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	job := &domain.ExportJob{
+		ID:        id,
+		KeyID:     keyID(domain.APIKeyFromContext(ctx)),
+		Kind:      kind,
+		Format:    format,
+		BOM:       bom,
+		Params:    b,
+		Status:    domain.ExportQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := eu.jobRepository.Create(ctx, job); err != nil {
+		eu.l.Errorf(fmt.Sprintf("failed to Create export: %v", err))
+		return nil, err
+	}
+	return job, nil
+}
+
+// enqueue hands the task to the workers and returns a copy of its job, which the worker owns from then on.
+func (eu *exportUseCase) enqueue(ctx context.Context, t *exportTask) (*domain.ExportJob, error) {
+	job := *t.job
+	select {
+	case eu.queue <- t:
+		eu.l.Infof(fmt.Sprintf("export %s of %s queued", job.ID, job.Kind))
+		job.Localize(datetime.LocationFromContext(ctx))
+		return &job, nil
+	default:
+	}
+	t.job.Error = domain.ErrExportQueueFull.Error()
+	eu.finish(t.job, domain.ExportFailed)
+	return nil, domain.ErrExportQueueFull
+}
+
+func (eu *exportUseCase) run(t *exportTask) {
+	job := t.job
+	ctx, cancel := context.WithTimeout(eu.ctx, eu.timeout)
+	defer cancel()
+
+	job.Status = domain.ExportRunning
+	eu.save(job)
+	start := time.Now()
+	rows, err := eu.write(ctx, t)
+	job.Rows = rows
+	if err != nil {
+		eu.l.Errorf(fmt.Sprintf("export %s failed after %d rows: %v", job.ID, rows, err))
+		job.Error = err.Error()
+		eu.finish(job, domain.ExportFailed)
+		return
+	}
+	eu.l.Infof(fmt.Sprintf("export %s wrote %d rows in %s", job.ID, rows, time.Since(start)))
+	eu.finish(job, domain.ExportSucceeded)
+}
+
+func (eu *exportUseCase) write(ctx context.Context, t *exportTask) (int64, error) {
+	w, err := eu.files.Create(t.job)
+	if err != nil {
+		return 0, err
+	}
+	enc, err := export.NewEncoder(w, t.job.Format, t.row, t.job.BOM)
+	if err != nil {
+		_ = w.Close()
+		return 0, err
+	}
+	rows, err := t.write(ctx, enc, func(rows int64) {
+		t.job.Rows = rows
+		eu.save(t.job)
+	})
+	if err == nil {
+		err = enc.Flush()
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return rows, err
+}
+
+func (eu *exportUseCase) finish(job *domain.ExportJob, status string) {
+	now := time.Now().UTC().Truncate(time.Second)
+	job.Status = status
+	job.FinishedAt = &now
+	eu.save(job)
+}
+
+// save records the job, logging failures: a job is not failed because its progress could not be saved.
+func (eu *exportUseCase) save(job *domain.ExportJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportSaveTimeout)
+	defer cancel()
+	job.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := eu.jobRepository.Update(ctx, job); err != nil {
+		eu.l.Errorf(fmt.Sprintf("failed to Update export %s: %v", job.ID, err))
+	}
+}
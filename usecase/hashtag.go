@@ -1,43 +1,145 @@
 package usecase
 
 import (
+	"context"
 	"fmt"
 	"sns-api/domain"
 	"sns-api/logger"
+	"strconv"
 	"time"
 )
 
 type HashtagUseCase interface {
-	Get(keyword string, hashtag []string, tweetType []int, retweetMin, retweetMax, quoteMin, quoteMax, favoriteMin, favoriteMax int, userInclude, userExclude, hashtagInclude, hashtagExclude []string, userFollowerMin, userFollowerMax, userStatusMin, userStatusMax, count int, startDate, endDate time.Time) ([]*domain.Hashtag, int, error)
-	Search(hashtag string, startDate, endDate time.Time, count int) ([]*domain.HashtagBySearch, int, error)
+	Get(ctx context.Context, filter *domain.HashtagFilter, count int, cursor *domain.Cursor) ([]*domain.Hashtag, *domain.Page, error)
+	Search(ctx context.Context, hashtag string, startDate, endDate time.Time, count int, cursor *domain.Cursor) ([]*domain.HashtagBySearch, *domain.Page, error)
+	Timeseries(ctx context.Context, hashtags []string, filter *domain.HashtagFilter, interval domain.HashtagInterval) ([]*domain.HashtagTimeseries, error)
+	Trending(ctx context.Context, filter *domain.HashtagFilter, targetStart time.Time, minCount, count int) ([]*domain.HashtagTrend, error)
+	Cooccurrence(ctx context.Context, seeds []string, filter *domain.HashtagFilter, count, hops, minCount int) (*domain.HashtagGraph, error)
+	Contributors(ctx context.Context, hashtag string, filter *domain.HashtagFilter, count int) (*domain.HashtagContributors, error)
+	Suggest(ctx context.Context, prefix string, startDate, endDate time.Time, count int) ([]*domain.HashtagBySearch, error)
 }
 
+// trendingCandidates is how many of the hashtags most used in the target window are scored.
+// A burst large enough to matter puts a hashtag among them.
+const trendingCandidates = 1000
+
 type hashtagUseCase struct {
 	l                 logger.Logging
 	hashtagRepository domain.HashtagRepository
+	userRepository    domain.UserRepository
 }
 
-func NewHashtagUseCase(l logger.Logging, hr domain.HashtagRepository) HashtagUseCase {
+func NewHashtagUseCase(l logger.Logging, hr domain.HashtagRepository, ur domain.UserRepository) HashtagUseCase {
 	return &hashtagUseCase{
 		l:                 l,
 		hashtagRepository: hr,
+		userRepository:    ur,
 	}
 }
 
-func (h *hashtagUseCase) Get(keyword string, hashtag []string, tweetType []int, retweetMin, retweetMax, quoteMin, quoteMax, favoriteMin, favoriteMax int, userInclude, userExclude, hashtagInclude, hashtagExclude []string, userFollowerMin, userFollowerMax, userStatusMin, userStatusMax, count int, startDate, endDate time.Time) ([]*domain.Hashtag, int, error) {
-	hashtags, hits, err := h.hashtagRepository.Get(keyword, hashtag, tweetType, retweetMin, retweetMax, quoteMin, quoteMax, favoriteMin, favoriteMax, userInclude, userExclude, hashtagInclude, hashtagExclude, userFollowerMin, userFollowerMax, userStatusMin, userStatusMax, count, startDate, endDate)
+func (h *hashtagUseCase) Get(ctx context.Context, filter *domain.HashtagFilter, count int, cursor *domain.Cursor) ([]*domain.Hashtag, *domain.Page, error) {
+	hashtags, page, err := h.hashtagRepository.Get(ctx, filter, count, cursor)
 	if err != nil {
 		h.l.Errorf(fmt.Sprintf("failed to Get: %v", err))
-		return nil, 0, err
+		return nil, nil, err
 	}
-	return hashtags, hits, nil
+	return hashtags, page, nil
 }
 
-func (h *hashtagUseCase) Search(hashtag string, startDate, endDate time.Time, count int) ([]*domain.HashtagBySearch, int, error) {
-	hashtags, hits, err := h.hashtagRepository.Search(hashtag, startDate, endDate, count)
+func (h *hashtagUseCase) Search(ctx context.Context, hashtag string, startDate, endDate time.Time, count int, cursor *domain.Cursor) ([]*domain.HashtagBySearch, *domain.Page, error) {
+	hashtags, page, err := h.hashtagRepository.Search(ctx, hashtag, startDate, endDate, count, cursor)
 	if err != nil {
 		h.l.Errorf(fmt.Sprintf("failed to Search: %v", err))
-		return nil, 0, err
+		return nil, nil, err
+	}
+	return hashtags, page, nil
+}
+
+func (h *hashtagUseCase) Timeseries(ctx context.Context, hashtags []string, filter *domain.HashtagFilter, interval domain.HashtagInterval) ([]*domain.HashtagTimeseries, error) {
+	series, err := h.hashtagRepository.Timeseries(ctx, hashtags, filter, interval)
+	if err != nil {
+		h.l.Errorf(fmt.Sprintf("failed to Timeseries: %v", err))
+		return nil, err
+	}
+	return series, nil
+}
+
+func (h *hashtagUseCase) Trending(ctx context.Context, filter *domain.HashtagFilter, targetStart time.Time, minCount, count int) ([]*domain.HashtagTrend, error) {
+	counts, err := h.hashtagRepository.Trending(ctx, filter, targetStart, trendingCandidates)
+	if err != nil {
+		h.l.Errorf(fmt.Sprintf("failed to Trending: %v", err))
+		return nil, err
+	}
+	trends := domain.ScoreHashtagTrends(counts, minCount)
+	if len(trends) > count {
+		trends = trends[:count]
+	}
+	return trends, nil
+}
+
+// Cooccurrence builds the graph around seeds, expanding from the hashtags each hop added.
+func (h *hashtagUseCase) Cooccurrence(ctx context.Context, seeds []string, filter *domain.HashtagFilter, count, hops, minCount int) (*domain.HashtagGraph, error) {
+	graph := domain.NewHashtagGraph(seeds)
+	frontier := seeds
+	for hop := 1; hop <= hops && len(frontier) > 0; hop++ {
+		co, err := h.hashtagRepository.Cooccurrence(ctx, frontier, filter, count)
+		if err != nil {
+			h.l.Errorf(fmt.Sprintf("failed to Cooccurrence: %v", err))
+			return nil, err
+		}
+		frontier = graph.Expand(co, hop, minCount)
+	}
+	return graph, nil
+}
+
+// Contributors ranks the accounts of hashtag and joins their latest profile in the range.
+func (h *hashtagUseCase) Contributors(ctx context.Context, hashtag string, filter *domain.HashtagFilter, count int) (*domain.HashtagContributors, error) {
+	contributors, err := h.hashtagRepository.Contributors(ctx, hashtag, filter, count)
+	if err != nil {
+		h.l.Errorf(fmt.Sprintf("failed to Contributors: %v", err))
+		return nil, err
+	}
+	var userIDs []uint64
+	seen := map[uint64]bool{}
+	for _, c := range append(append([]*domain.HashtagContributor{}, contributors.ByStatus...), contributors.ByEngagement...) {
+		id, err := strconv.ParseUint(c.UserID, 10, 64)
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		userIDs = append(userIDs, id)
+	}
+	if len(userIDs) > 0 {
+		byID := map[string]*domain.User{}
+		_, err := h.userRepository.GetByIds(ctx, userIDs, filter.StartDate, filter.EndDate, localizeUsers(ctx, func(user *domain.User) error {
+			byID[user.UserID] = user
+			return nil
+		}))
+		if err != nil {
+			h.l.Errorf(fmt.Sprintf("failed to GetByIds: %v", err))
+			return nil, err
+		}
+		for _, list := range [][]*domain.HashtagContributor{contributors.ByStatus, contributors.ByEngagement} {
+			for _, c := range list {
+				c.User = byID[c.UserID]
+			}
+		}
+	}
+	contributors.SetShares()
+	return contributors, nil
+}
+
+// Suggest completes prefix with the hashtags used most from startDate to endDate,
+// whichever width and kana the prefix and the hashtags are written in.
+func (h *hashtagUseCase) Suggest(ctx context.Context, prefix string, startDate, endDate time.Time, count int) ([]*domain.HashtagBySearch, error) {
+	variants := domain.HashtagPrefixVariants(prefix)
+	if len(variants) == 0 {
+		return []*domain.HashtagBySearch{}, nil
+	}
+	suggestions, err := h.hashtagRepository.Suggest(ctx, variants, startDate, endDate, count)
+	if err != nil {
+		h.l.Errorf(fmt.Sprintf("failed to Suggest: %v", err))
+		return nil, err
 	}
-	return hashtags, hits, nil
+	return suggestions, nil
 }
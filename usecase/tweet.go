@@ -1,37 +1,46 @@
 package usecase
 
 import (
+	"context"
 	"fmt"
+	"sns-api/datetime"
 	"sns-api/domain"
 	"sns-api/logger"
 	"time"
 )
 
 type TweetUseCase interface {
-	Get() ([]*domain.Tweet, error)
-	GetByUser(userID uint64, startDate, endDate string, count int, orderBy string) ([]*domain.Tweet, int, error)
-	GetByUsers(userIDs []uint64, startDate, endDate time.Time, count int, orderBy string) ([]*domain.Tweet, int, error)
-	GetByDomain(userID uint64, startDate, endDate string, count int, orderBy string, domainName string) ([]*domain.Tweet, int, []*domain.URL, error)
-	GetByMediaType(userID uint64, startDate, endDate string, count int, orderBy string, mediaType int) ([]*domain.TweetMedia, int, []*domain.Media, error)
-	GetTransitionByUser(userID uint64, startDate, endDate string, count int) ([]*domain.TweetTransition, error)
+	Get(ctx context.Context) ([]*domain.Tweet, error)
+	// GetByUser, GetByUsers, GetByDomain, GetByMediaType and Search hand every tweet to each,
+	// localized, as soon as it is read.
+	GetByUser(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error)
+	GetByUsers(ctx context.Context, userIDs []uint64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error)
+	GetByDomain(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, domainName string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, []*domain.URL, error)
+	GetByMediaType(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, mediaType int, cursor *domain.Cursor, each func(*domain.TweetMedia) error) (*domain.Page, []*domain.Media, error)
+	GetTransitionByUser(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, cursor *domain.Cursor) ([]*domain.TweetTransition, *domain.Page, error)
+	Search(ctx context.Context, query *domain.SearchQuery, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error)
+	Heatmap(ctx context.Context, userID uint64, startDate, endDate time.Time, loc *time.Location) (*domain.TweetHeatmap, error)
+	Stats(ctx context.Context, userID uint64, startDate, endDate time.Time) (*domain.TweetStatsComparison, error)
 }
 
 type tweetUseCase struct {
 	l                    logger.Logging
 	tweetRepository      domain.TweetRepository
 	transitionRepository domain.TransitionRepository
+	userRepository       domain.UserRepository
 }
 
-func NewTweetUseCase(l logger.Logging, tr domain.TweetRepository, tts domain.TransitionRepository) TweetUseCase {
+func NewTweetUseCase(l logger.Logging, tr domain.TweetRepository, tts domain.TransitionRepository, ur domain.UserRepository) TweetUseCase {
 	return &tweetUseCase{
 		l:                    l,
 		tweetRepository:      tr,
 		transitionRepository: tts,
+		userRepository:       ur,
 	}
 }
 
-func (t *tweetUseCase) Get() ([]*domain.Tweet, error) {
-	tweets, err := t.tweetRepository.Get()
+func (t *tweetUseCase) Get(ctx context.Context) ([]*domain.Tweet, error) {
+	tweets, err := t.tweetRepository.Get(ctx)
 	if err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to Get: %v", err))
 		return nil, err
@@ -39,48 +48,112 @@ func (t *tweetUseCase) Get() ([]*domain.Tweet, error) {
 	return tweets, nil
 }
 
-func (t *tweetUseCase) GetByUser(userID uint64, startDate, endDate string, count int, orderBy string) ([]*domain.Tweet, int, error) {
-	tweets, hits, err := t.tweetRepository.GetByUser(userID, startDate, endDate, count, orderBy)
+func (t *tweetUseCase) GetByUser(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error) {
+	page, err := t.tweetRepository.GetByUser(ctx, userID, startDate, endDate, count, orderBy, cursor, localizeTweets(ctx, each))
 	if err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to GetByUser: %v", err))
-		return nil, 0, err
+		return nil, err
 	}
-	return tweets, hits, nil
+	return page, nil
 }
 
-func (t *tweetUseCase) GetByUsers(userIDs []uint64, startDate, endDate time.Time, count int, orderBy string) ([]*domain.Tweet, int, error) {
-	tweets, hits, err := t.tweetRepository.GetByUsers(userIDs, startDate, endDate, count, orderBy)
+func (t *tweetUseCase) GetByUsers(ctx context.Context, userIDs []uint64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error) {
+	page, err := t.tweetRepository.GetByUsers(ctx, userIDs, startDate, endDate, count, orderBy, cursor, localizeTweets(ctx, each))
 	if err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to GetByUsers: %v", err))
-		return nil, 0, err
+		return nil, err
 	}
-	return tweets, hits, nil
+	return page, nil
 }
 
-func (t *tweetUseCase) GetByDomain(userID uint64, startDate, endDate string, count int, orderBy string, domainName string) ([]*domain.Tweet, int, []*domain.URL, error) {
-	tweets, hits, urlInfo, err := t.tweetRepository.GetByDomain(userID, startDate, endDate, count, orderBy, domainName)
+func (t *tweetUseCase) GetByDomain(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, domainName string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, []*domain.URL, error) {
+	page, urlInfo, err := t.tweetRepository.GetByDomain(ctx, userID, startDate, endDate, count, orderBy, domainName, cursor, localizeTweets(ctx, each))
 	if err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to GetByDomain: %v", err))
-		return nil, 0, nil, err
+		return nil, nil, err
 	}
-	return tweets, hits, urlInfo, nil
+	return page, urlInfo, nil
 }
 
-func (t *tweetUseCase) GetByMediaType(userID uint64, startDate, endDate string, count int, orderBy string, mediaType int) ([]*domain.TweetMedia, int, []*domain.Media, error) {
-	tweets, hits, media, err := t.tweetRepository.GetByMediaType(userID, startDate, endDate, count, orderBy, mediaType)
+func (t *tweetUseCase) GetByMediaType(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, orderBy string, mediaType int, cursor *domain.Cursor, each func(*domain.TweetMedia) error) (*domain.Page, []*domain.Media, error) {
+	page, media, err := t.tweetRepository.GetByMediaType(ctx, userID, startDate, endDate, count, orderBy, mediaType, cursor, each)
 	t.l.Info("function usecase.GetByMedia done")
 	if err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to GetByMediaType: %v", err))
-		return nil, 0, nil, err
+		return nil, nil, err
 	}
-	return tweets, hits, media, nil
+	return page, media, nil
 }
 
-func (t *tweetUseCase) GetTransitionByUser(userID uint64, startDate, endDate string, count int) ([]*domain.TweetTransition, error) {
-	tts, err := t.transitionRepository.GetTransitionByUser(userID, startDate, endDate, count)
+func (t *tweetUseCase) GetTransitionByUser(ctx context.Context, userID uint64, startDate, endDate time.Time, count int, cursor *domain.Cursor) ([]*domain.TweetTransition, *domain.Page, error) {
+	tts, page, err := t.transitionRepository.GetTransitionByUser(ctx, userID, startDate, endDate, count, cursor)
 	if err != nil {
 		t.l.Errorf(fmt.Sprintf("failed to GetTransitionByUser: %v", err))
+		return nil, nil, err
+	}
+	domain.LocalizeTransitions(tts, datetime.LocationFromContext(ctx))
+	return tts, page, nil
+}
+
+func (t *tweetUseCase) Search(ctx context.Context, query *domain.SearchQuery, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.Tweet) error) (*domain.Page, error) {
+	page, err := t.tweetRepository.Search(ctx, query, startDate, endDate, count, orderBy, cursor, localizeTweets(ctx, each))
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to Search: %v", err))
+		return nil, err
+	}
+	return page, nil
+}
+
+// localizeTweets localizes every tweet in the zone of the request before handing it to each.
+func localizeTweets(ctx context.Context, each func(*domain.Tweet) error) func(*domain.Tweet) error {
+	loc := datetime.LocationFromContext(ctx)
+	return func(tweet *domain.Tweet) error {
+		tweet.Localize(loc)
+		return each(tweet)
+	}
+}
+
+func (t *tweetUseCase) Heatmap(ctx context.Context, userID uint64, startDate, endDate time.Time, loc *time.Location) (*domain.TweetHeatmap, error) {
+	counts, err := t.tweetRepository.HourlyCounts(ctx, userID, startDate, endDate, loc)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to Heatmap: %v", err))
 		return nil, err
 	}
-	return tts, nil
+	return domain.NewTweetHeatmap(counts, loc), nil
+}
+
+// Stats compares the range with the range of the same length ending the minute before it.
+func (t *tweetUseCase) Stats(ctx context.Context, userID uint64, startDate, endDate time.Time) (*domain.TweetStatsComparison, error) {
+	previousEnd := startDate.Add(-time.Minute)
+	previousStart := previousEnd.Add(-endDate.Sub(startDate))
+	current, err := t.periodStats(ctx, userID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := t.periodStats(ctx, userID, previousStart, previousEnd)
+	if err != nil {
+		return nil, err
+	}
+	loc := datetime.LocationFromContext(ctx)
+	current.Localize(loc)
+	previous.Localize(loc)
+	return domain.CompareTweetStats(current, previous), nil
+}
+
+// periodStats adds the follower count of the latest profile in the range to the statistics.
+func (t *tweetUseCase) periodStats(ctx context.Context, userID uint64, startDate, endDate time.Time) (*domain.TweetStats, error) {
+	stats, err := t.tweetRepository.Stats(ctx, userID, startDate, endDate)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to Stats: %v", err))
+		return nil, err
+	}
+	user, _, err := t.userRepository.GetById(ctx, userID, startDate, endDate)
+	if err != nil {
+		t.l.Errorf(fmt.Sprintf("failed to GetById: %v", err))
+		return nil, err
+	}
+	if user != nil {
+		stats.SetFollowerCount(user.FollowerCount)
+	}
+	return stats, nil
 }
@@ -1,53 +1,195 @@
 package usecase
 
 import (
+	"context"
 	"fmt"
+	"sns-api/datetime"
 	"sns-api/domain"
 	"sns-api/logger"
+	"sync"
 	"time"
 )
 
 type UserUseCase interface {
-	Search(name, description, language string, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax int, srScoreMin, srScoreMax float64, startDate, endDate time.Time, count int, orderBy string) ([]*domain.User, int, error)
-	GetById(userID uint64, startDate, endDate time.Time) (*domain.User, int, error)
-	GetByIds(userIDs []uint64, startDate, endDate time.Time) ([]*domain.User, int, error)
+	// Search and GetByIds hand every user to each, localized, as soon as it is read.
+	Search(ctx context.Context, name, description, language string, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax int, srScoreMin, srScoreMax float64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.User) error) (*domain.Page, error)
+	GetById(ctx context.Context, userID uint64, startDate, endDate time.Time) (*domain.User, *domain.Page, error)
+	GetByIds(ctx context.Context, userIDs []uint64, startDate, endDate time.Time, each func(*domain.User) error) (*domain.Page, error)
+	Growth(ctx context.Context, userID uint64, startDate, endDate time.Time, interval string, window int, threshold float64) (*domain.UserGrowth, error)
+	Compare(ctx context.Context, userIDs []uint64, startDate, endDate time.Time) (*domain.UserComparison, error)
 }
 
+// growthPageSize is how many daily snapshots Growth reads per query.
+const growthPageSize = 1000
+
 type userUseCase struct {
-	l              logger.Logging
-	userRepository domain.UserRepository
+	l                    logger.Logging
+	userRepository       domain.UserRepository
+	transitionRepository domain.TransitionRepository
+	tweetRepository      domain.TweetRepository
 }
 
-func NewUserUseCase(l logger.Logging, ur domain.UserRepository) UserUseCase {
+func NewUserUseCase(l logger.Logging, ur domain.UserRepository, tts domain.TransitionRepository, tr domain.TweetRepository) UserUseCase {
 	return &userUseCase{
-		l:              l,
-		userRepository: ur,
+		l:                    l,
+		userRepository:       ur,
+		transitionRepository: tts,
+		tweetRepository:      tr,
 	}
 }
 
-func (uu *userUseCase) Search(name, description, language string, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax int, srScoreMin, srScoreMax float64, startDate, endDate time.Time, count int, orderBy string) ([]*domain.User, int, error) {
-	users, hits, err := uu.userRepository.Search(name, description, language, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax, srScoreMin, srScoreMax, startDate, endDate, count, orderBy)
+func (uu *userUseCase) Search(ctx context.Context, name, description, language string, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax int, srScoreMin, srScoreMax float64, startDate, endDate time.Time, count int, orderBy string, cursor *domain.Cursor, each func(*domain.User) error) (*domain.Page, error) {
+	page, err := uu.userRepository.Search(ctx, name, description, language, followerMin, followerMax, statusMin, statusMax, favoriteMin, favoriteMax, followMin, followMax, listMin, listMax, srScoreMin, srScoreMax, startDate, endDate, count, orderBy, cursor, localizeUsers(ctx, each))
 	if err != nil {
 		uu.l.Errorf(fmt.Sprintf("failed to GetById: %v", err))
-		return nil, 0, err
+		return nil, err
 	}
-	return users, hits, nil
+	return page, nil
 }
 
-func (uu *userUseCase) GetById(userID uint64, startDate, endDate time.Time) (*domain.User, int, error) {
-	user, hits, err := uu.userRepository.GetById(userID, startDate, endDate)
+func (uu *userUseCase) GetById(ctx context.Context, userID uint64, startDate, endDate time.Time) (*domain.User, *domain.Page, error) {
+	user, page, err := uu.userRepository.GetById(ctx, userID, startDate, endDate)
 	if err != nil {
 		uu.l.Errorf(fmt.Sprintf("failed to GetById: %v", err))
-		return nil, 0, err
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, domain.ErrUserNotFound
 	}
-	return user, hits, nil
+	user.Localize(datetime.LocationFromContext(ctx))
+	return user, page, nil
 }
 
-func (uu *userUseCase) GetByIds(userIDs []uint64, startDate, endDate time.Time) ([]*domain.User, int, error) {
-	users, hits, err := uu.userRepository.GetByIds(userIDs, startDate, endDate)
+func (uu *userUseCase) GetByIds(ctx context.Context, userIDs []uint64, startDate, endDate time.Time, each func(*domain.User) error) (*domain.Page, error) {
+	page, err := uu.userRepository.GetByIds(ctx, userIDs, startDate, endDate, localizeUsers(ctx, each))
 	if err != nil {
 		uu.l.Errorf(fmt.Sprintf("failed to GetById: %v", err))
-		return nil, 0, err
+		return nil, err
+	}
+	return page, nil
+}
+
+// localizeUsers localizes every user in the zone of the request before handing it to each.
+func localizeUsers(ctx context.Context, each func(*domain.User) error) func(*domain.User) error {
+	loc := datetime.LocationFromContext(ctx)
+	return func(user *domain.User) error {
+		user.Localize(loc)
+		return each(user)
+	}
+}
+
+// Growth reads every snapshot of the user between the dates and summarizes them per interval
+// of the zone of the request. Anomalies are always looked for in the daily changes.
+func (uu *userUseCase) Growth(ctx context.Context, userID uint64, startDate, endDate time.Time, interval string, window int, threshold float64) (*domain.UserGrowth, error) {
+	daily, err := uu.dailyGrowth(ctx, userID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	points, err := domain.ResampleGrowth(daily, interval)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.UserGrowth{
+		UserID:    userID,
+		Interval:  interval,
+		Points:    points,
+		Anomalies: domain.DetectGrowthAnomalies(daily, window, threshold),
+	}, nil
+}
+
+// dailyGrowth reads every snapshot of the user between the dates into a series of the days
+// of the zone of the request.
+func (uu *userUseCase) dailyGrowth(ctx context.Context, userID uint64, startDate, endDate time.Time) ([]*domain.UserGrowthPoint, error) {
+	var tts []*domain.TweetTransition
+	var cursor *domain.Cursor
+	for {
+		page, next, err := uu.transitionRepository.GetTransitionByUser(ctx, userID, startDate, endDate, growthPageSize, cursor)
+		if err != nil {
+			uu.l.Errorf(fmt.Sprintf("failed to GetTransitionByUser: %v", err))
+			return nil, err
+		}
+		tts = append(tts, page...)
+		if next.NextCursor == nil {
+			break
+		}
+		cursor = next.NextCursor
+	}
+	daily, err := domain.DailyGrowth(tts, datetime.LocationFromContext(ctx))
+	if err != nil {
+		uu.l.Errorf(fmt.Sprintf("failed to DailyGrowth: %v", err))
+		return nil, err
+	}
+	return daily, nil
+}
+
+// Compare fetches the profiles, the tweet statistics and the growth between startDate and endDate
+// of the users at the same time. The sections that fail are reported in the comparison; an error
+// is returned only when every section failed.
+func (uu *userUseCase) Compare(ctx context.Context, userIDs []uint64, startDate, endDate time.Time) (*domain.UserComparison, error) {
+	loc := datetime.LocationFromContext(ctx)
+	comparison := domain.NewUserComparison(userIDs)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := func(userID uint64, section string, err error) {
+		uu.l.Errorf(fmt.Sprintf("failed to compare %s of %d: %v", section, userID, err))
+		mu.Lock()
+		defer mu.Unlock()
+		comparison.AddError(userID, section, err)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var users []*domain.User
+		_, err := uu.userRepository.GetByIds(ctx, userIDs, startDate, endDate, localizeUsers(ctx, func(user *domain.User) error {
+			users = append(users, user)
+			return nil
+		}))
+		if err != nil {
+			failed(0, domain.ComparisonProfiles, err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		comparison.SetProfiles(users)
+	}()
+	for _, e := range comparison.Users {
+		wg.Add(2)
+		go func(e *domain.UserComparisonEntry) {
+			defer wg.Done()
+			stats, err := uu.tweetRepository.Stats(ctx, e.UserID, startDate, endDate)
+			if err != nil {
+				failed(e.UserID, domain.ComparisonStats, err)
+				return
+			}
+			stats.Localize(loc)
+			mu.Lock()
+			defer mu.Unlock()
+			e.Stats = stats
+		}(e)
+		go func(e *domain.UserComparisonEntry) {
+			defer wg.Done()
+			daily, err := uu.dailyGrowth(ctx, e.UserID, startDate, endDate)
+			if err != nil {
+				failed(e.UserID, domain.ComparisonGrowth, err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			e.Growth = domain.SummarizeGrowth(daily)
+		}(e)
+	}
+	wg.Wait()
+
+	comparison.SortErrors()
+	if len(comparison.Errors) == 1+2*len(userIDs) {
+		return nil, fmt.Errorf("every section failed, first: %s", comparison.Errors[0].Error)
+	}
+	for _, e := range comparison.Users {
+		if e.Stats != nil && e.User != nil {
+			e.Stats.SetFollowerCount(e.User.FollowerCount)
+		}
 	}
-	return users, hits, nil
+	comparison.SetShares()
+	return comparison, nil
 }